@@ -0,0 +1,168 @@
+package main
+
+import (
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"example/subsonic/bilibili"
+)
+
+// 音频区的歌曲 ID 为 "au<sid>"，歌单 ID 为 "am<menuId>"，与 bilibili 上的编号相同。
+// 视频的 ID 是去掉 "BV" 的 bvid，总是以 1 开头，不会与之冲突
+const (
+	audioIDPrefix = "au"
+	menuIDPrefix  = "am"
+)
+
+// PlaylistKindMenu 指向音频区歌单的歌单，歌曲列表来自上游，只读
+const PlaylistKindMenu = "menu"
+
+func parseAudioID(id string) (sid int, ok bool) {
+	return parseNumberedID(id, audioIDPrefix)
+}
+
+func parseMenuID(id string) (menuID int, ok bool) {
+	return parseNumberedID(id, menuIDPrefix)
+}
+
+func parseNumberedID(id string, prefix string) (int, bool) {
+	if !strings.HasPrefix(id, prefix) {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(id, prefix))
+	return n, err == nil && n > 0
+}
+
+// isAudioID reports whether id is an audio song rather than a video.
+func isAudioID(id string) bool {
+	_, ok := parseAudioID(id)
+	return ok
+}
+
+// videoFromAudio converts an audio song into the video model used for every
+// song. The singer is the artist name; the artist ID is the uploader's.
+func videoFromAudio(a *bilibili.BilibiliAudio) bilibili.BilibiliVideo {
+	author := a.Author
+	if author == "" {
+		author = a.Uname
+	}
+	return bilibili.BilibiliVideo{
+		ID:       audioIDPrefix + strconv.Itoa(a.SID),
+		Title:    a.Title,
+		Author:   author,
+		MID:      a.UID,
+		Pic:      a.Cover,
+		Duration: a.Duration,
+		Pubdate:  a.Passtime,
+	}
+}
+
+// getSongInfo fetches the details of a song, either a video or an audio song.
+func getSongInfo(client *bilibili.BilibiliClient, id string) (*bilibili.BilibiliVideo, error) {
+	sid, ok := parseAudioID(id)
+	if !ok {
+		return client.GetVideoInfo(id)
+	}
+	a, err := client.GetAudioInfo(sid)
+	if err != nil {
+		return nil, err
+	}
+	v := videoFromAudio(a)
+	return &v, nil
+}
+
+// openSongStream opens the audio of a song, returning its Content-Length.
+// The format of the audio is recorded the first time the song is played.
+func openSongStream(client *bilibili.BilibiliClient, id string) (io.ReadCloser, string, error) {
+	var rc io.ReadCloser
+	var contentLength string
+	var play *bilibili.PlayInfo
+	var err error
+	if sid, ok := parseAudioID(id); ok {
+		rc, contentLength, err = client.GetAudioSongStream(sid)
+	} else {
+		rc, contentLength, play, err = client.GetAudioStream(id)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return sniffStream(client, id, rc, play), contentLength, nil
+}
+
+// songURL returns the bilibili page of a song.
+func songURL(id string) string {
+	if isAudioID(id) {
+		return "https://www.bilibili.com/audio/" + id
+	}
+	return "https://www.bilibili.com/video/BV" + id
+}
+
+// searchAudioSongs returns the first page of the audio search, caching the
+// songs' metadata.
+func searchAudioSongs(client *bilibili.BilibiliClient, query string) ([]SongMeta, error) {
+	songs, _, err := client.SearchAudio(query, 1)
+	if err != nil {
+		return nil, err
+	}
+	metas := make([]SongMeta, 0, len(songs))
+	for _, a := range songs {
+		v := videoFromAudio(&a)
+		if err := saveVideoMeta(&v); err != nil {
+			log.Println("save song meta error:", err)
+		}
+		metas = append(metas, SongMeta{BilibiliVideo: v})
+	}
+	return metas, nil
+}
+
+// menuPlaylist returns a playlist for an audio menu, which is not saved.
+func menuPlaylist(client *bilibili.BilibiliClient, menuID int) (PlaylistInfo, error) {
+	menu, err := client.GetMenu(menuID)
+	if err != nil {
+		return PlaylistInfo{}, err
+	}
+	created := menu.Created
+	if created.IsZero() {
+		created = time.Now()
+	}
+	return PlaylistInfo{
+		ID:      menuIDPrefix + strconv.Itoa(menuID),
+		Name:    menu.Title,
+		MediaID: strconv.Itoa(menuID),
+		Kind:    PlaylistKindMenu,
+		Comment: menu.Intro,
+		Public:  true,
+		Created: created,
+		Changed: created,
+	}, nil
+}
+
+// createMenuPlaylist links an audio menu as a playlist.
+func createMenuPlaylist(client *bilibili.BilibiliClient, menuID int) (PlaylistInfo, error) {
+	p, err := menuPlaylist(client, menuID)
+	if err != nil {
+		return PlaylistInfo{}, err
+	}
+	return p, repo.CreatePlaylist(p)
+}
+
+// menuSongs returns the songs of an audio menu, caching their metadata.
+func menuSongs(client *bilibili.BilibiliClient, p *PlaylistInfo) ([]bilibili.BilibiliVideo, error) {
+	menuID, _ := strconv.Atoi(p.MediaID)
+	songs, err := client.GetMenuSongs(menuID)
+	if err != nil {
+		return nil, err
+	}
+	videos := make([]bilibili.BilibiliVideo, 0, len(songs))
+	for _, a := range songs {
+		v := videoFromAudio(&a)
+		if err := saveVideoMeta(&v); err != nil {
+			log.Println("save song meta error:", err)
+		}
+		videos = append(videos, v)
+	}
+	return videos, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAudioSongs(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addAudio(1, "晴天")
+	cfg := defaultConfig()
+	router := newTestRouter(fake.client(), &cfg)
+	router.GET("/rest/getSong", GetSongXML)
+	router.GET("/rest/stream", StreamHandlerXML)
+	router.GET("/rest/star", StarHandlerXML)
+	router.GET("/rest/getStarred2", GetStarred2HandlerXML)
+
+	w := doGet(router, "/rest/getSong", url.Values{"id": {"au1"}})
+	var resp SubsonicResponseXML
+	if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad xml: %v", err)
+	}
+	if resp.Song == nil || resp.Song.Title != "晴天" || resp.Song.Artist != "singer" || resp.Song.ArtistID != "ar-7" || resp.Song.Duration != 240 {
+		t.Fatalf("unexpected song: %s", w.Body)
+	}
+
+	// Stream 需要真实的连接，不能用 ResponseRecorder
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	res, err := http.Get(srv.URL + "/rest/stream?id=au1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "audio1" {
+		t.Fatalf("stream = %d %q", res.StatusCode, body)
+	}
+
+	// 收藏音频使用音频区的元数据
+	doGet(router, "/rest/star", url.Values{"id": {"au1"}})
+	w = doGet(router, "/rest/getStarred2", nil)
+	if !strings.Contains(w.Body.String(), `id="au1" title="晴天"`) {
+		t.Fatalf("starred audio missing: %s", w.Body)
+	}
+
+	if _, err := fetchSongMeta(fake.client(), "au2", SongMeta{}); err != nil {
+		t.Fatalf("missing audio should be cached as unavailable: %v", err)
+	}
+	if m, ok, _ := repo.SongMeta("au2"); !ok || !m.Unavailable {
+		t.Fatalf("missing audio meta = %+v", m)
+	}
+}
+
+func TestSearch3IncludesAudio(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addAudio(1, "晴天")
+	fake.addAudio(2, "晴天 live")
+	for _, id := range []string{"a", "b"} {
+		fake.addVideo(id, "晴天 "+id)
+	}
+	cfg := defaultConfig()
+	router := newTestRouter(fake.client(), &cfg)
+	router.GET("/rest/search3", Search3HandlerXML)
+
+	songIDs := func(query url.Values) []string {
+		query.Set("query", "晴天")
+		var ids []string
+		for _, s := range searchXML(t, router, "/rest/search3", query).Song {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+
+	if ids := songIDs(url.Values{}); !slices.Equal(ids, []string{"au1", "au2", "a", "b"}) {
+		t.Fatalf("songs = %v", ids)
+	}
+	if ids := songIDs(url.Values{"songOffset": {"1"}, "songCount": {"2"}}); !slices.Equal(ids, []string{"au2", "a"}) {
+		t.Fatalf("songs across audio and videos = %v", ids)
+	}
+	if ids := songIDs(url.Values{"songOffset": {"3"}}); !slices.Equal(ids, []string{"b"}) {
+		t.Fatalf("songs past the audio = %v", ids)
+	}
+
+	cfg.Search.Audio = false
+	if ids := songIDs(url.Values{}); !slices.Equal(ids, []string{"a", "b"}) {
+		t.Fatalf("songs without audio = %v", ids)
+	}
+}
+
+func TestMenuPlaylist(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addAudio(1, "one")
+	fake.addAudio(2, "two")
+	fake.setMenu(5, 2, 1)
+	cfg := defaultConfig()
+	router := newPlaylistRouter(fake.client(), &cfg)
+	router.GET("/rest/getPlaylist", GetPlaylistHandlerXML)
+	router.GET("/rest/getPlaylists", GetPlaylistsHandlerXML)
+
+	playlist := func(w string) *PlaylistXML {
+		var resp SubsonicResponseXML
+		if err := xml.Unmarshal([]byte(w), &resp); err != nil {
+			t.Fatalf("bad xml: %v", err)
+		}
+		if resp.Playlist == nil {
+			t.Fatalf("unexpected response: %s", w)
+		}
+		return resp.Playlist
+	}
+
+	// 未关联的歌单也可以直接访问
+	p := playlist(doGet(router, "/rest/getPlaylist", url.Values{"id": {"am5"}}).Body.String())
+	var ids []string
+	for _, e := range p.Entry {
+		ids = append(ids, e.ID)
+	}
+	if p.Name != "menu5" || !slices.Equal(ids, []string{"au2", "au1"}) {
+		t.Fatalf("menu playlist = %s %v", p.Name, ids)
+	}
+
+	p = playlist(doGet(router, "/rest/createPlaylist", url.Values{"name": {"am5"}}).Body.String())
+	if p.ID != "am5" || p.SongCount != 2 {
+		t.Fatalf("linked menu = %+v", p)
+	}
+	w := doGet(router, "/rest/getPlaylists", nil)
+	if !strings.Contains(w.Body.String(), `id="am5" name="menu5"`) {
+		t.Fatalf("menu missing from playlists: %s", w.Body)
+	}
+
+	w = doGet(router, "/rest/updatePlaylist", url.Values{"playlistId": {"am5"}, "songIdToAdd": {"au1"}})
+	if !strings.Contains(w.Body.String(), `code="50"`) {
+		t.Fatalf("menu should be read-only: %s", w.Body)
+	}
+}
@@ -0,0 +1,157 @@
+package bilibili
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LikeVideo 点赞或取消点赞视频，需要登录
+func (client *BilibiliClient) LikeVideo(aid int, like bool) error {
+	form := url.Values{}
+	form.Add("aid", strconv.Itoa(aid))
+	if like {
+		form.Add("like", "1")
+	} else {
+		form.Add("like", "2")
+	}
+
+	_, err := client.postForm("/x/web-interface/archive/like", form)
+	return err
+}
+
+// AddCoin 给视频投币，count 为 1 或 2，需要登录
+func (client *BilibiliClient) AddCoin(aid int, count int) error {
+	form := url.Values{}
+	form.Add("aid", strconv.Itoa(aid))
+	form.Add("multiply", strconv.Itoa(count))
+	form.Add("select_like", "0")
+
+	_, err := client.postForm("/x/web-interface/coin/add", form)
+	return err
+}
+
+// Heartbeat 上报播放进度，使播放出现在账号的历史记录中，需要登录。
+// played 为已播放的秒数，start 为开始播放的时间
+func (client *BilibiliClient) Heartbeat(v *BilibiliVideo, start time.Time, played int) error {
+	form := url.Values{}
+	form.Add("aid", strconv.Itoa(v.AVID))
+	form.Add("bvid", "BV"+v.ID)
+	form.Add("cid", strconv.Itoa(v.CID))
+	form.Add("played_time", strconv.Itoa(played))
+	form.Add("real_played_time", strconv.Itoa(played))
+	form.Add("start_ts", strconv.FormatInt(start.Unix(), 10))
+	form.Add("type", "3")
+	form.Add("dt", "2")
+	if played == 0 {
+		form.Add("play_type", "1")
+	} else {
+		form.Add("play_type", "0")
+	}
+
+	_, err := client.postForm("/x/click-interface/web/heartbeat", form)
+	return err
+}
+
+// archiveJSON 是相关推荐和排行榜中的视频
+type archiveJSON struct {
+	AID      int    `json:"aid"`
+	BvID     string `json:"bvid"`
+	Title    string `json:"title"`
+	Pic      string `json:"pic"`
+	Duration int    `json:"duration"`
+	TID      int    `json:"tid"`
+	CID      int    `json:"cid"`
+	Pubdate  int64  `json:"pubdate"`
+	Ctime    int64  `json:"ctime"`
+	Owner    struct {
+		Mid  int    `json:"mid"`
+		Name string `json:"name"`
+	} `json:"owner"`
+	Stat statJSON `json:"stat"`
+}
+
+// statJSON 是视频接口中的统计数据
+type statJSON struct {
+	View     int `json:"view"`
+	Like     int `json:"like"`
+	Favorite int `json:"favorite"`
+}
+
+func (s statJSON) stat() VideoStat {
+	return VideoStat{View: s.View, Like: s.Like, Favorite: s.Favorite}
+}
+
+func (v *archiveJSON) video() BilibiliVideo {
+	return BilibiliVideo{
+		ID:       strings.TrimPrefix(v.BvID, "BV"),
+		Title:    removeHTMLTags(v.Title),
+		AVID:     v.AID,
+		Author:   v.Owner.Name,
+		MID:      v.Owner.Mid,
+		Pic:      v.Pic,
+		Duration: v.Duration,
+		CID:      v.CID,
+		TID:      v.TID,
+		Pubdate:  unixTime(v.Pubdate),
+		Ctime:    unixTime(v.Ctime),
+		Stat:     v.Stat.stat(),
+	}
+}
+
+// GetRelatedVideos 获取视频的相关推荐
+func (client *BilibiliClient) GetRelatedVideos(bvid string) ([]BilibiliVideo, error) {
+	queryParams := url.Values{}
+	queryParams.Add("bvid", "BV"+bvid)
+
+	var data []archiveJSON
+	if err := client.getJSON("/x/web-interface/archive/related", queryParams, &data); err != nil {
+		return nil, err
+	}
+
+	videos := make([]BilibiliVideo, 0, len(data))
+	for _, v := range data {
+		videos = append(videos, v.video())
+	}
+	return videos, nil
+}
+
+// GetVideoTags 获取视频的标签名
+func (client *BilibiliClient) GetVideoTags(bvid string) ([]string, error) {
+	queryParams := url.Values{}
+	queryParams.Add("bvid", "BV"+bvid)
+
+	var data []struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := client.getJSON("/x/tag/archive/tags", queryParams, &data); err != nil {
+		return nil, err
+	}
+
+	tags := make([]string, 0, len(data))
+	for _, t := range data {
+		tags = append(tags, t.TagName)
+	}
+	return tags, nil
+}
+
+// GetRanking 获取分区的排行榜，rid 为分区 ID，例如音乐区为 3
+func (client *BilibiliClient) GetRanking(rid int) ([]BilibiliVideo, error) {
+	queryParams := url.Values{}
+	queryParams.Add("rid", strconv.Itoa(rid))
+	queryParams.Add("type", "all")
+
+	var data struct {
+		List []archiveJSON `json:"list"`
+	}
+	if err := client.getJSON("/x/web-interface/ranking/v2", queryParams, &data); err != nil {
+		return nil, err
+	}
+
+	videos := make([]BilibiliVideo, 0, len(data.List))
+	for _, v := range data.List {
+		videos = append(videos, v.video())
+	}
+	return videos, nil
+}
@@ -0,0 +1,250 @@
+package bilibili
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// audioPageSize 是音频区分页接口每页的条数
+const audioPageSize = 100
+
+// BilibiliAudio 是音频区（music.bilibili.com）的一首歌曲，SID 为 au 号的数字部分
+type BilibiliAudio struct {
+	SID   int
+	Title string
+	// Author 为歌手，上传的 UP 主为 UID 和 Uname
+	Author   string
+	UID      int
+	Uname    string
+	Cover    string
+	Duration int
+	// Lyric 为 LRC 歌词的地址，没有歌词时为空
+	Lyric    string
+	Passtime time.Time
+}
+
+// BilibiliMenu 是音频区的歌单，ID 为 am 号的数字部分
+type BilibiliMenu struct {
+	ID        int
+	Title     string
+	Intro     string
+	Cover     string
+	UID       int
+	Uname     string
+	SongCount int
+	Created   time.Time
+}
+
+// audioSongJSON 是音频区接口中的歌曲
+type audioSongJSON struct {
+	ID       int    `json:"id"`
+	UID      int    `json:"uid"`
+	Uname    string `json:"uname"`
+	Author   string `json:"author"`
+	Title    string `json:"title"`
+	Cover    string `json:"cover"`
+	Lyric    string `json:"lyric"`
+	Duration int    `json:"duration"`
+	Passtime int64  `json:"passtime"`
+}
+
+func (a *audioSongJSON) audio() BilibiliAudio {
+	return BilibiliAudio{
+		SID:      a.ID,
+		Title:    removeHTMLTags(a.Title),
+		Author:   a.Author,
+		UID:      a.UID,
+		Uname:    a.Uname,
+		Cover:    a.Cover,
+		Duration: a.Duration,
+		Lyric:    a.Lyric,
+		Passtime: unixTime(a.Passtime),
+	}
+}
+
+// wwwBase 返回 www.bilibili.com 上的接口地址
+func (client *BilibiliClient) wwwBase() string {
+	if client.WWWBase != "" {
+		return client.WWWBase
+	}
+	return client.APIBase
+}
+
+// GetAudioInfo 获取音频区歌曲的信息，歌曲不存在或已下架时返回 ErrVideoUnavailable
+func (client *BilibiliClient) GetAudioInfo(sid int) (*BilibiliAudio, error) {
+	queryParams := url.Values{}
+	queryParams.Add("sid", strconv.Itoa(sid))
+
+	r, raw, err := client.getRaw(client.wwwBase()+"/audio/music-service-c/web/song/info", queryParams)
+	if err != nil {
+		return nil, err
+	}
+	// 歌曲不存在时 code 为 72000000，data 为空
+	var song *audioSongJSON
+	if r.Code == 0 && len(raw) > 0 {
+		if err := json.Unmarshal(raw, &song); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %v", err)
+		}
+	}
+	if song == nil || song.ID == 0 {
+		if r.Code == 0 || r.Code == 72000000 {
+			return nil, fmt.Errorf("%w: au%d", ErrVideoUnavailable, sid)
+		}
+		return nil, r.err()
+	}
+	a := song.audio()
+	return &a, nil
+}
+
+// SearchAudio 搜索音频区的歌曲，page 从 1 开始
+func (client *BilibiliClient) SearchAudio(keyword string, page int) ([]BilibiliAudio, SearchPage, error) {
+	queryParams := url.Values{}
+	queryParams.Add("search_type", "music")
+	queryParams.Add("keyword", keyword)
+	queryParams.Add("page", strconv.Itoa(page))
+	queryParams.Add("pagesize", "20")
+
+	var data struct {
+		PageSize  int `json:"pagesize"`
+		NumPages  int `json:"num_pages"`
+		NumResult int `json:"num_result"`
+		Result    []struct {
+			audioSongJSON
+			UpName string `json:"up_name"`
+		} `json:"result"`
+	}
+	if err := client.getJSON("/audio/music-service-c/s", queryParams, &data); err != nil {
+		return nil, SearchPage{}, err
+	}
+
+	info := SearchPage{PageSize: data.PageSize, NumResults: data.NumResult, NumPages: data.NumPages}
+	songs := make([]BilibiliAudio, 0, len(data.Result))
+	for _, s := range data.Result {
+		if s.Uname == "" {
+			s.Uname = s.UpName
+		}
+		songs = append(songs, s.audio())
+	}
+	return songs, info, nil
+}
+
+// GetMenu 获取音频区歌单的信息
+func (client *BilibiliClient) GetMenu(menuID int) (*BilibiliMenu, error) {
+	queryParams := url.Values{}
+	queryParams.Add("sid", strconv.Itoa(menuID))
+
+	var data struct {
+		MenuID int    `json:"menuId"`
+		UID    int    `json:"uid"`
+		Uname  string `json:"uname"`
+		Title  string `json:"title"`
+		Cover  string `json:"cover"`
+		Intro  string `json:"intro"`
+		Snum   int    `json:"snum"`
+		Ctime  int64  `json:"ctime"`
+	}
+	if err := client.getJSONFrom(client.wwwBase(), "/audio/music-service-c/web/menu/info", queryParams, &data); err != nil {
+		return nil, err
+	}
+	return &BilibiliMenu{
+		ID:        data.MenuID,
+		Title:     data.Title,
+		Intro:     data.Intro,
+		Cover:     data.Cover,
+		UID:       data.UID,
+		Uname:     data.Uname,
+		SongCount: data.Snum,
+		Created:   unixTime(data.Ctime),
+	}, nil
+}
+
+// GetMenuSongs 获取音频区歌单中的所有歌曲
+func (client *BilibiliClient) GetMenuSongs(menuID int) ([]BilibiliAudio, error) {
+	var songs []BilibiliAudio
+	for pn := 1; ; pn++ {
+		queryParams := url.Values{}
+		queryParams.Add("sid", strconv.Itoa(menuID))
+		queryParams.Add("pn", strconv.Itoa(pn))
+		queryParams.Add("ps", strconv.Itoa(audioPageSize))
+
+		var data struct {
+			PageCount int             `json:"pageCount"`
+			Data      []audioSongJSON `json:"data"`
+		}
+		if err := client.getJSONFrom(client.wwwBase(), "/audio/music-service-c/web/song/of-menu", queryParams, &data); err != nil {
+			return nil, err
+		}
+		for _, s := range data.Data {
+			songs = append(songs, s.audio())
+		}
+		if pn >= data.PageCount || len(data.Data) == 0 {
+			return songs, nil
+		}
+	}
+}
+
+// GetAudioSongURL 获取音频区歌曲的音频地址
+func (client *BilibiliClient) GetAudioSongURL(sid int) (string, error) {
+	queryParams := url.Values{}
+	queryParams.Add("sid", strconv.Itoa(sid))
+	queryParams.Add("privilege", "2")
+	queryParams.Add("quality", "2")
+
+	var data struct {
+		CDNs []string `json:"cdns"`
+	}
+	if err := client.getJSONFrom(client.wwwBase(), "/audio/music-service-c/web/url", queryParams, &data); err != nil {
+		return "", err
+	}
+	if len(data.CDNs) == 0 {
+		return "", fmt.Errorf("no audio url for au%d", sid)
+	}
+	return data.CDNs[0], nil
+}
+
+// GetAudioSongStream 打开音频区歌曲的音频流，同时返回 Content-Length
+func (client *BilibiliClient) GetAudioSongStream(sid int) (io.ReadCloser, string, error) {
+	audioURL, err := client.GetAudioSongURL(sid)
+	if err != nil {
+		return nil, "", err
+	}
+
+	req, _ := http.NewRequest("GET", audioURL, nil)
+	req.Header.Set("Referer", "https://www.bilibili.com")
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	resp, err := client.Client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("get audio stream: %s", resp.Status)
+	}
+	return resp.Body, resp.Header.Get("Content-Length"), nil
+}
+
+// GetAudioLyric downloads the LRC lyrics of an audio song, which are empty
+// when it has none.
+func (client *BilibiliClient) GetAudioLyric(a *BilibiliAudio) (string, error) {
+	if a.Lyric == "" {
+		return "", nil
+	}
+	req, _ := http.NewRequest("GET", a.Lyric, nil)
+	req.Header.Set("Referer", "https://www.bilibili.com")
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	resp, err := client.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("get audio lyric: %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	return string(data), err
+}
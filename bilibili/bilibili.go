@@ -2,6 +2,7 @@ package bilibili
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,11 +12,22 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
+)
+
+const (
+	DefaultAPIBase = "https://api.bilibili.com"
+	DefaultWWWBase = "https://www.bilibili.com"
 )
 
 type BilibiliClient struct {
-	Client *http.Client // HTTP 客户端
+	Client  *http.Client // HTTP 客户端
+	APIBase string       // 接口地址，测试时可指向本地服务器
+	WWWBase string       // 音频区等 www.bilibili.com 上的接口地址，为空时同 APIBase
+	// DryRun 为 true 时写操作（收藏、建收藏夹等）只记录日志，不发送请求
+	DryRun bool
 
+	wbi wbiKeys // WBI 签名用的密钥，按需获取
 }
 
 // NewBilibiliClient 创建一个新的 BilibiliClient
@@ -23,11 +35,15 @@ func NewBilibiliClient() *BilibiliClient {
 	jar, _ := cookiejar.New(nil)
 	client := &BilibiliClient{Client: &http.Client{
 		Jar: jar,
-	}}
+	}, APIBase: DefaultAPIBase, WWWBase: DefaultWWWBase}
 
 	req, _ := http.NewRequest("GET", "https://www.bilibili.com", nil)
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/107.0.0.0 Safari/537.36 Edg/107.0.1418.56")
-	res, _ := client.Client.Do(req)
+	res, err := client.Client.Do(req)
+	if err != nil {
+		log.Println("get cookie error:", err)
+		return client
+	}
 	defer res.Body.Close()
 
 	log.Println(res.Header.Get("set-cookie"))
@@ -35,34 +51,163 @@ func NewBilibiliClient() *BilibiliClient {
 	return client
 }
 
+// SetCookie 设置登录 cookie，格式同浏览器请求头，例如 "SESSDATA=xxx; bili_jct=xxx"
+func (client *BilibiliClient) SetCookie(cookie string) error {
+	cookies, err := http.ParseCookie(cookie)
+	if err != nil {
+		return err
+	}
+	for _, c := range cookies {
+		c.Domain = ".bilibili.com"
+		c.Path = "/"
+	}
+	host, _ := url.Parse("https://www.bilibili.com")
+	client.Client.Jar.SetCookies(host, cookies)
+	return nil
+}
+
+// CSRF 返回登录 cookie 中的 bili_jct，写操作需要作为 csrf 参数提交
+func (client *BilibiliClient) CSRF() string {
+	host, _ := url.Parse("https://www.bilibili.com")
+	for _, c := range client.Client.Jar.Cookies(host) {
+		if c.Name == "bili_jct" {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+// ErrVideoUnavailable 表示视频已删除或不可见
+var ErrVideoUnavailable = errors.New("video unavailable")
+
+// videoError 将获取视频信息时的返回码转换为错误，视频不存在或不可见时包装 ErrVideoUnavailable
+func videoError(code int, message string) error {
+	switch code {
+	case -404, 62002, 62004, 62012:
+		return fmt.Errorf("%w: %d %s", ErrVideoUnavailable, code, message)
+	}
+	r := apiResponse{Code: code, Message: message}
+	if err := r.err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("unexpected response without data")
+}
+
+// apiResponse 是 bilibili 接口通用的返回码
+type apiResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (r *apiResponse) err() error {
+	if r.Code != 0 {
+		return fmt.Errorf("bilibili api error %d: %s", r.Code, r.Message)
+	}
+	return nil
+}
+
+// SearchPage 是搜索结果的分页信息
+type SearchPage struct {
+	PageSize   int `json:"pagesize"`
+	NumResults int `json:"numResults"`
+	NumPages   int `json:"numPages"`
+}
+
+// 视频搜索的排序方式
+const (
+	SearchOrderTotalRank = "totalrank" // 综合排序
+	SearchOrderClick     = "click"     // 最多播放
+	SearchOrderPubdate   = "pubdate"   // 最新发布
+	SearchOrderDanmaku   = "dm"        // 最多弹幕
+	SearchOrderStow      = "stow"      // 最多收藏
+)
+
+// 视频搜索的时长分档
+const (
+	SearchDurationAll     = 0
+	SearchDurationUnder10 = 1 // 10 分钟以下
+	SearchDuration10To30  = 2 // 10-30 分钟
+	SearchDuration30To60  = 3 // 30-60 分钟
+	SearchDurationOver60  = 4 // 60 分钟以上
+)
+
+// SearchFilter 是视频搜索的过滤条件，零值表示不过滤
+type SearchFilter struct {
+	// TIDs 为分区 ID，主分区包括其子分区，例如 3 为音乐区
+	TIDs int
+	// Duration 为时长分档 SearchDuration*
+	Duration int
+	// Order 为排序方式 SearchOrder*，为空时为综合排序
+	Order string
+}
+
+// Validate checks that the filter uses a known duration bucket and order.
+func (f SearchFilter) Validate() error {
+	if f.TIDs < 0 {
+		return fmt.Errorf("invalid tids: %d", f.TIDs)
+	}
+	if f.Duration < SearchDurationAll || f.Duration > SearchDurationOver60 {
+		return fmt.Errorf("invalid duration: %d", f.Duration)
+	}
+	switch f.Order {
+	case "", SearchOrderTotalRank, SearchOrderClick, SearchOrderPubdate, SearchOrderDanmaku, SearchOrderStow:
+		return nil
+	}
+	return fmt.Errorf("invalid order: %s", f.Order)
+}
+
+// searchType 搜索一页 searchType 类型的结果，结果解析到 result 中
+func (client *BilibiliClient) searchType(queryParams url.Values, searchType string, page int, result interface{}) (SearchPage, error) {
+	queryParams.Set("search_type", searchType)
+	queryParams.Set("page", strconv.Itoa(page))
+
+	var data struct {
+		SearchPage
+		Result json.RawMessage `json:"result"`
+	}
+	if err := client.getJSON("/x/web-interface/search/type", queryParams, &data); err != nil {
+		return SearchPage{}, err
+	}
+	// 没有结果时 result 可能缺失
+	if len(data.Result) > 0 {
+		if err := json.Unmarshal(data.Result, result); err != nil {
+			return SearchPage{}, fmt.Errorf("failed to parse response: %v", err)
+		}
+	}
+	return data.SearchPage, nil
+}
+
 // Search 通过关键词搜索音频
 func (client *BilibiliClient) Search(keyword string) ([]BilibiliVideo, error) {
-	queryURL := "http://api.bilibili.com/x/web-interface/search/type"
+	videos, _, err := client.SearchVideos(keyword, 1, SearchFilter{})
+	return videos, err
+}
+
+// SearchVideos 按过滤条件搜索视频，page 从 1 开始
+func (client *BilibiliClient) SearchVideos(keyword string, page int, filter SearchFilter) ([]BilibiliVideo, SearchPage, error) {
 	queryParams := url.Values{}
 	queryParams.Add("keyword", keyword)
-	queryParams.Add("search_type", "video")
-
-	req, _ := http.NewRequest("GET", queryURL+"?"+queryParams.Encode(), nil)
-
-	resp, err := client.Client.Do(req)
-	if err != nil {
-		return nil, err
+	if filter.TIDs != 0 {
+		queryParams.Add("tids", strconv.Itoa(filter.TIDs))
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	var jsonResponse map[string]interface{}
-	if err := json.Unmarshal(body, &jsonResponse); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %v", err)
+	if filter.Duration != 0 {
+		queryParams.Add("duration", strconv.Itoa(filter.Duration))
+	}
+	if filter.Order != "" {
+		queryParams.Add("order", filter.Order)
 	}
 
-	results := jsonResponse["data"].(map[string]interface{})["result"].([]interface{})
-	return BilibiliVideoModelFromList(results), nil
+	var results []interface{}
+	info, err := client.searchType(queryParams, "video", page, &results)
+	if err != nil {
+		return nil, info, err
+	}
+	return BilibiliVideoModelFromList(results), info, nil
 }
 
 // GetVideoInfo 获取视频信息
 func (client *BilibiliClient) GetVideoInfo(bvid string) (*BilibiliVideo, error) {
-	queryURL := "https://api.bilibili.com/x/web-interface/view"
+	queryURL := client.APIBase + "/x/web-interface/view"
 	queryParams := url.Values{}
 	queryParams.Add("bvid", bvid)
 
@@ -81,9 +226,22 @@ func (client *BilibiliClient) GetVideoInfo(bvid string) (*BilibiliVideo, error)
 		return nil, fmt.Errorf("failed to parse response: %v", err)
 	}
 
-	video := jsonResponse["data"].(map[string]interface{})
+	video, ok := jsonResponse["data"].(map[string]interface{})
+	if !ok {
+		code, _ := jsonResponse["code"].(float64)
+		message, _ := jsonResponse["message"].(string)
+		return nil, videoError(int(code), message)
+	}
 
 	seconds := int(video["duration"].(float64))
+	cid, _ := video["cid"].(float64)
+	tid, _ := video["tid"].(float64)
+	pubdate, _ := video["pubdate"].(float64)
+	ctime, _ := video["ctime"].(float64)
+	stat, _ := video["stat"].(map[string]interface{})
+	view, _ := stat["view"].(float64)
+	like, _ := stat["like"].(float64)
+	favorite, _ := stat["favorite"].(float64)
 	owner := video["owner"].(map[string]interface{})
 	return &BilibiliVideo{
 		ID:       bvid,
@@ -93,6 +251,11 @@ func (client *BilibiliClient) GetVideoInfo(bvid string) (*BilibiliVideo, error)
 		MID:      int(owner["mid"].(float64)),
 		Pic:      video["pic"].(string),
 		Duration: seconds,
+		CID:      int(cid),
+		TID:      int(tid),
+		Pubdate:  unixTime(int64(pubdate)),
+		Ctime:    unixTime(int64(ctime)),
+		Stat:     VideoStat{View: int(view), Like: int(like), Favorite: int(favorite)},
 	}, nil
 
 	// return &BilibiliVideo{
@@ -104,75 +267,117 @@ func (client *BilibiliClient) GetVideoInfo(bvid string) (*BilibiliVideo, error)
 	// }, nil
 }
 
-func (client *BilibiliClient) GetCoverArt(coverArt string) (io.ReadCloser, error) {
-	if strings.HasPrefix(coverArt, "//") {
-		queryURL := "http:" + coverArt
+// coverArtURL 将封面地址补全为可请求的 URL，搜索结果中的封面以 "//" 开头
+func coverArtURL(coverArt string) (string, error) {
+	switch {
+	case strings.HasPrefix(coverArt, "//"):
+		return "http:" + coverArt, nil
+	case strings.HasPrefix(coverArt, "http://"), strings.HasPrefix(coverArt, "https://"):
+		return coverArt, nil
+	}
+	return "", fmt.Errorf("invalid cover art: %q", coverArt)
+}
 
-		req, err := http.NewRequest("GET", queryURL, nil)
-		if err != nil {
-			return nil, fmt.Errorf("req")
-		}
+func (client *BilibiliClient) GetCoverArt(coverArt string) (io.ReadCloser, error) {
+	queryURL, err := coverArtURL(coverArt)
+	if err != nil {
+		return nil, err
+	}
 
-		resp, err := client.Client.Do(req)
-		if err != nil {
-			return nil, err
-		}
+	req, err := http.NewRequest("GET", queryURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("req")
+	}
 
-		return resp.Body, nil
+	resp, err := client.Client.Do(req)
+	if err != nil {
+		return nil, err
 	}
-	log.Fatalln("stringsS")
-	return nil, fmt.Errorf("fsdf")
+
+	return resp.Body, nil
 }
 
 func (client *BilibiliClient) HeadCoverArt(coverArt string) (io.ReadCloser, error) {
-	if strings.HasPrefix(coverArt, "//") {
-		queryURL := "http:" + coverArt
-
-		req, err := http.NewRequest("HEAD", queryURL, nil)
-		if err != nil {
-			return nil, fmt.Errorf("req")
-		}
+	queryURL, err := coverArtURL(coverArt)
+	if err != nil {
+		return nil, err
+	}
 
-		resp, err := client.Client.Do(req)
-		if err != nil {
-			return nil, err
-		}
+	req, err := http.NewRequest("HEAD", queryURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("req")
+	}
 
-		return resp.Body, nil
+	resp, err := client.Client.Do(req)
+	if err != nil {
+		return nil, err
 	}
-	log.Fatalln("stringsS")
-	return nil, fmt.Errorf("fsdf")
+
+	return resp.Body, nil
 }
 
 // GetAudioUrl 获取音频 URL
 func (client *BilibiliClient) GetAudioUrl(bvid string, cid int) (string, error) {
-	queryURL := "http://api.bilibili.com/x/player/playurl"
+	info, err := client.GetPlayInfo(bvid, cid)
+	if err != nil {
+		return "", err
+	}
+	return info.URL, nil
+}
+
+// PlayInfo 是视频的音频流，取 DASH 中的第一个音频
+type PlayInfo struct {
+	URL string
+	// Codecs 例如 "mp4a.40.2"，Bandwidth 单位为 bps
+	Codecs    string
+	Bandwidth int
+	// Loudness 是 bilibili 测得的响度，接口没有返回时为 nil
+	Loudness *Loudness
+}
+
+// Loudness 是音频的响度，Integrated 单位为 LUFS，TruePeak 单位为 dBTP
+type Loudness struct {
+	Integrated float64 `json:"integrated"`
+	TruePeak   float64 `json:"truePeak"`
+}
+
+// GetPlayInfo 获取视频的音频流地址、编码和响度
+func (client *BilibiliClient) GetPlayInfo(bvid string, cid int) (*PlayInfo, error) {
 	queryParams := url.Values{}
 	queryParams.Add("bvid", bvid)
 	queryParams.Add("cid", strconv.Itoa(cid))
 	queryParams.Add("fnval", "16")
 
-	req, _ := http.NewRequest("GET", queryURL+"?"+queryParams.Encode(), nil)
-	req.Header.Set("User-Agent", "Mozilla/5.0") // 设置常见的浏览器 User-Agent
-
-	resp, err := client.Client.Do(req)
-	if err != nil {
-		return "", err
+	var data struct {
+		Dash struct {
+			Audio []struct {
+				BaseURL   string `json:"baseUrl"`
+				Codecs    string `json:"codecs"`
+				Bandwidth int    `json:"bandwidth"`
+			} `json:"audio"`
+		} `json:"dash"`
+		Volume *struct {
+			MeasuredI  float64 `json:"measured_i"`
+			MeasuredTP float64 `json:"measured_tp"`
+		} `json:"volume"`
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	var jsonResponse map[string]interface{}
-	if err := json.Unmarshal(body, &jsonResponse); err != nil {
-		return "", fmt.Errorf("failed to parse response: %v", err)
+	if err := client.getJSON("/x/player/playurl", queryParams, &data); err != nil {
+		return nil, err
+	}
+	if len(data.Dash.Audio) == 0 {
+		return nil, fmt.Errorf("no audio stream for %s", bvid)
 	}
 
-	audioUrl := jsonResponse["data"].(map[string]interface{})["dash"].(map[string]interface{})["audio"].([]interface{})[0].(map[string]interface{})["baseUrl"].(string)
-	return audioUrl, nil
+	audio := data.Dash.Audio[0]
+	info := &PlayInfo{URL: audio.BaseURL, Codecs: audio.Codecs, Bandwidth: audio.Bandwidth}
+	if data.Volume != nil {
+		info.Loudness = &Loudness{Integrated: data.Volume.MeasuredI, TruePeak: data.Volume.MeasuredTP}
+	}
+	return info, nil
 }
 
 func (client *BilibiliClient) getCid(id string) (int, error) {
-	queryURL := "http://api.bilibili.com/x/player/pagelist"
+	queryURL := client.APIBase + "/x/player/pagelist"
 	queryParams := url.Values{}
 	queryParams.Add("bvid", id)
 
@@ -195,12 +400,17 @@ func (client *BilibiliClient) getCid(id string) (int, error) {
 	return cid, nil
 }
 
-func (client *BilibiliClient) GetAudioStream(id string) (io.ReadCloser, string, error) {
+// GetAudioStream opens the audio of video bvid, returning its Content-Length
+// and the play info the stream was chosen from.
+func (client *BilibiliClient) GetAudioStream(id string) (io.ReadCloser, string, *PlayInfo, error) {
 	cid, _ := client.getCid(id)
-	audioUrl, _ := client.GetAudioUrl(id, cid)
-	audioUrl_Url, _ := url.Parse(audioUrl)
+	play, err := client.GetPlayInfo(id, cid)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	audioUrl_Url, _ := url.Parse(play.URL)
 
-	req, _ := http.NewRequest("GET", audioUrl, nil)
+	req, _ := http.NewRequest("GET", play.URL, nil)
 	req.Header.Add("Referer", "https://www.bilibili.com")
 	req.Header.Add("Host", audioUrl_Url.Host)
 	req.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/107.0.0.0 Safari/537.36 Edg/107.0.1418.56")
@@ -208,12 +418,12 @@ func (client *BilibiliClient) GetAudioStream(id string) (io.ReadCloser, string,
 	client_new := http.Client{}
 	resp, err := client_new.Do(req)
 	if err != nil {
-		return nil, "", err
+		return nil, "", nil, err
 	}
 
 	contentLength := resp.Header.Get("Content-Length")
 
-	return (resp.Body), contentLength, nil
+	return (resp.Body), contentLength, play, nil
 }
 
 // BilibiliVideo 示例模型定义
@@ -225,6 +435,22 @@ type BilibiliVideo struct {
 	MID      int
 	Pic      string
 	Duration int
+	// CID 是第一个分 P 的 cid，只有 GetVideoInfo 返回
+	CID int
+	// TID 是视频所在的分区，未知时为 0
+	TID int
+	// Pubdate 为发布时间，Ctime 为投稿时间，未知时为零值
+	Pubdate time.Time
+	Ctime   time.Time
+	// Stat 为播放、点赞和收藏数，不同接口返回的字段不全
+	Stat VideoStat
+}
+
+// VideoStat 是视频的统计数据，未知时为 0
+type VideoStat struct {
+	View     int
+	Like     int
+	Favorite int
 }
 
 // BilibiliVideoModelFromList 将 JSON 转为 BilibiliVideoModel 的切片
@@ -237,6 +463,13 @@ func BilibiliVideoModelFromList(data []interface{}) []BilibiliVideo {
 			continue
 		}
 		bvid := strings.Split(video["bvid"].(string), "BV")[1]
+		// 搜索结果中的 typeid 是字符串
+		tid, _ := strconv.Atoi(fmt.Sprint(video["typeid"]))
+		pubdate, _ := video["pubdate"].(float64)
+		senddate, _ := video["senddate"].(float64)
+		play, _ := video["play"].(float64)
+		like, _ := video["like"].(float64)
+		favorites, _ := video["favorites"].(float64)
 		result = append(result, BilibiliVideo{
 			ID:       bvid,
 			Title:    removeHTMLTags(video["title"].(string)),
@@ -245,11 +478,23 @@ func BilibiliVideoModelFromList(data []interface{}) []BilibiliVideo {
 			MID:      int(video["mid"].(float64)),
 			Pic:      video["pic"].(string),
 			Duration: seconds,
+			TID:      tid,
+			Pubdate:  unixTime(int64(pubdate)),
+			Ctime:    unixTime(int64(senddate)),
+			Stat:     VideoStat{View: int(play), Like: int(like), Favorite: int(favorites)},
 		})
 	}
 	return result
 }
 
+// unixTime converts a unix timestamp, treating 0 as unknown.
+func unixTime(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
+
 func removeHTMLTags(input string) string {
 	// Regular expression to match HTML tags
 	re := regexp.MustCompile(`<[^>]*>`)
@@ -283,20 +528,28 @@ type BilibiliFavListResponse struct {
 }
 
 type BilibiliFavMedia struct {
+	ID       int    `json:"id"`
 	Title    string `json:"title"`
 	Duration int    `json:"duration"`
 	Cover    string `json:"cover"`
 	BvID     string `json:"bvid"`
+	Pubtime  int64  `json:"pubtime"`
+	Ctime    int64  `json:"ctime"`
 	Upper    struct {
+		Mid  int    `json:"mid"`
 		Name string `json:"name"`
 	} `json:"upper"`
+	CntInfo struct {
+		Collect int `json:"collect"`
+		Play    int `json:"play"`
+	} `json:"cnt_info"`
 }
 
 func (client *BilibiliClient) GetFavoriteList(mediaId string) ([]BilibiliVideo, error) {
 	var allVideos []BilibiliVideo
 	pn := 1
 	for {
-		queryURL := "https://api.bilibili.com/x/v3/fav/resource/list"
+		queryURL := client.APIBase + "/x/v3/fav/resource/list"
 		queryParams := url.Values{}
 		queryParams.Add("media_id", mediaId)
 		queryParams.Add("ps", "20") // Page size, 20 is a safe value
@@ -319,11 +572,16 @@ func (client *BilibiliClient) GetFavoriteList(mediaId string) ([]BilibiliVideo,
 
 		for _, media := range jsonResponse.Data.Medias {
 			allVideos = append(allVideos, BilibiliVideo{
-				ID:       media.BvID,
+				ID:       strings.TrimPrefix(media.BvID, "BV"),
 				Title:    removeHTMLTags(media.Title),
+				AVID:     media.ID,
 				Author:   media.Upper.Name,
+				MID:      media.Upper.Mid,
 				Pic:      media.Cover,
 				Duration: media.Duration,
+				Pubdate:  unixTime(media.Pubtime),
+				Ctime:    unixTime(media.Ctime),
+				Stat:     VideoStat{View: media.CntInfo.Play, Favorite: media.CntInfo.Collect},
 			})
 		}
 
@@ -334,3 +592,87 @@ func (client *BilibiliClient) GetFavoriteList(mediaId string) ([]BilibiliVideo,
 	}
 	return allVideos, nil
 }
+
+// postForm 发送需要登录的写请求，自动附带 csrf，并检查返回码
+// DryRun 模式下只记录日志，返回空的 data
+func (client *BilibiliClient) postForm(path string, form url.Values) (json.RawMessage, error) {
+	form.Set("csrf", client.CSRF())
+	if client.DryRun {
+		log.Println("dry run: POST", path, form.Encode())
+		return nil, nil
+	}
+
+	req, _ := http.NewRequest("POST", client.APIBase+path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	req.Header.Set("Referer", "https://www.bilibili.com")
+
+	resp, err := client.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	var jsonResponse struct {
+		apiResponse
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &jsonResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+	return jsonResponse.Data, jsonResponse.err()
+}
+
+// DealFavResource 将视频加入 addMediaIds 指定的收藏夹，并从 delMediaIds 中移除，需要登录
+func (client *BilibiliClient) DealFavResource(aid int, addMediaIds []string, delMediaIds []string) error {
+	form := url.Values{}
+	form.Add("rid", strconv.Itoa(aid))
+	form.Add("type", "2")
+	form.Add("add_media_ids", strings.Join(addMediaIds, ","))
+	form.Add("del_media_ids", strings.Join(delMediaIds, ","))
+
+	_, err := client.postForm("/x/v3/fav/resource/deal", form)
+	return err
+}
+
+// BatchDelFavResource 从收藏夹中批量移除视频，需要登录
+func (client *BilibiliClient) BatchDelFavResource(mediaId string, aids []int) error {
+	resources := make([]string, 0, len(aids))
+	for _, aid := range aids {
+		resources = append(resources, strconv.Itoa(aid)+":2")
+	}
+	form := url.Values{}
+	form.Add("media_id", mediaId)
+	form.Add("resources", strings.Join(resources, ","))
+	form.Add("platform", "web")
+
+	_, err := client.postForm("/x/v3/fav/resource/batch-del", form)
+	return err
+}
+
+// AddFavFolder 新建收藏夹并返回其 media id，需要登录
+// DryRun 模式下不会真正创建，返回空字符串
+func (client *BilibiliClient) AddFavFolder(title string, intro string, private bool) (string, error) {
+	form := url.Values{}
+	form.Add("title", title)
+	form.Add("intro", intro)
+	if private {
+		form.Add("privacy", "1")
+	} else {
+		form.Add("privacy", "0")
+	}
+
+	data, err := client.postForm("/x/v3/fav/folder/add", form)
+	if err != nil || data == nil {
+		return "", err
+	}
+
+	var folder struct {
+		ID int `json:"id"`
+	}
+	if err := json.Unmarshal(data, &folder); err != nil {
+		return "", fmt.Errorf("failed to parse response: %v", err)
+	}
+	return strconv.Itoa(folder.ID), nil
+}
@@ -118,7 +118,7 @@ func TestGetAudioUrl(t *testing.T) {
 
 func TestGetStream(t *testing.T) {
 	client := NewBilibiliClient()
-	stream, _, err := client.GetAudioStream("14aYKzhEwG")
+	stream, _, _, err := client.GetAudioStream("14aYKzhEwG")
 	if err != nil {
 		t.Fatalf("GetAudioUrl failed: %v", err)
 	}
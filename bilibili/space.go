@@ -0,0 +1,328 @@
+package bilibili
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// BilibiliUser UP 主信息
+type BilibiliUser struct {
+	MID          int
+	Name         string
+	Face         string
+	Fans         int
+	ArchiveCount int
+}
+
+// BilibiliSeason 合集信息
+type BilibiliSeason struct {
+	ID     int
+	MID    int
+	Name   string
+	Cover  string
+	Total  int
+	Author string
+}
+
+// getJSON 发送 GET 请求并解析通用返回结构，data 解析到 v 中
+func (client *BilibiliClient) getJSON(path string, queryParams url.Values, v interface{}) error {
+	return client.getJSONFrom(client.APIBase, path, queryParams, v)
+}
+
+// getJSONFrom 同 getJSON，但接口在 base 上
+func (client *BilibiliClient) getJSONFrom(base string, path string, queryParams url.Values, v interface{}) error {
+	r, data, err := client.getRaw(base+path, queryParams)
+	if err != nil {
+		return err
+	}
+	if err := r.err(); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse response: %v", err)
+	}
+	return nil
+}
+
+// getRaw 向接口地址 queryURL 发送 GET 请求，返回通用返回码和未解析的 data
+func (client *BilibiliClient) getRaw(queryURL string, queryParams url.Values) (apiResponse, json.RawMessage, error) {
+	req, _ := http.NewRequest("GET", queryURL+"?"+queryParams.Encode(), nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	req.Header.Set("Referer", "https://www.bilibili.com")
+
+	resp, err := client.Client.Do(req)
+	if err != nil {
+		return apiResponse{}, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	var jsonResponse struct {
+		apiResponse
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &jsonResponse); err != nil {
+		return apiResponse{}, nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+	return jsonResponse.apiResponse, jsonResponse.Data, nil
+}
+
+// GetUserInfo 获取 UP 主的名片信息
+func (client *BilibiliClient) GetUserInfo(mid int) (*BilibiliUser, error) {
+	queryParams := url.Values{}
+	queryParams.Add("mid", strconv.Itoa(mid))
+
+	var data struct {
+		Card struct {
+			Name string `json:"name"`
+			Face string `json:"face"`
+			Fans int    `json:"fans"`
+		} `json:"card"`
+		ArchiveCount int `json:"archive_count"`
+	}
+	if err := client.getJSON("/x/web-interface/card", queryParams, &data); err != nil {
+		return nil, err
+	}
+
+	return &BilibiliUser{
+		MID:          mid,
+		Name:         data.Card.Name,
+		Face:         data.Card.Face,
+		Fans:         data.Card.Fans,
+		ArchiveCount: data.ArchiveCount,
+	}, nil
+}
+
+// GetSeason 获取 UP 主的合集信息及其中的视频
+func (client *BilibiliClient) GetSeason(mid int, seasonId int) (*BilibiliSeason, []BilibiliVideo, error) {
+	var season *BilibiliSeason
+	var videos []BilibiliVideo
+	for page := 1; ; page++ {
+		queryParams := url.Values{}
+		queryParams.Add("mid", strconv.Itoa(mid))
+		queryParams.Add("season_id", strconv.Itoa(seasonId))
+		queryParams.Add("page_num", strconv.Itoa(page))
+		queryParams.Add("page_size", "100")
+
+		var data struct {
+			Archives []struct {
+				AID      int      `json:"aid"`
+				BvID     string   `json:"bvid"`
+				Title    string   `json:"title"`
+				Pic      string   `json:"pic"`
+				Duration int      `json:"duration"`
+				Pubdate  int64    `json:"pubdate"`
+				Ctime    int64    `json:"ctime"`
+				Stat     statJSON `json:"stat"`
+			} `json:"archives"`
+			Meta struct {
+				Name  string `json:"name"`
+				Cover string `json:"cover"`
+				Total int    `json:"total"`
+			} `json:"meta"`
+		}
+		if err := client.getJSON("/x/polymer/web-space/seasons_archives_list", queryParams, &data); err != nil {
+			return nil, nil, err
+		}
+
+		if season == nil {
+			season = &BilibiliSeason{
+				ID:    seasonId,
+				MID:   mid,
+				Name:  data.Meta.Name,
+				Cover: data.Meta.Cover,
+				Total: data.Meta.Total,
+			}
+		}
+		for _, a := range data.Archives {
+			videos = append(videos, BilibiliVideo{
+				ID:       strings.TrimPrefix(a.BvID, "BV"),
+				Title:    removeHTMLTags(a.Title),
+				AVID:     a.AID,
+				MID:      mid,
+				Pic:      a.Pic,
+				Duration: a.Duration,
+				Pubdate:  unixTime(a.Pubdate),
+				Ctime:    unixTime(a.Ctime),
+				Stat:     a.Stat.stat(),
+			})
+		}
+		if len(data.Archives) == 0 || len(videos) >= season.Total {
+			break
+		}
+	}
+
+	if user, err := client.GetUserInfo(mid); err == nil {
+		season.Author = user.Name
+		for i := range videos {
+			videos[i].Author = user.Name
+		}
+	}
+	return season, videos, nil
+}
+
+// 投稿列表的排序方式
+const (
+	OrderPubdate = "pubdate" // 最新发布
+	OrderClick   = "click"   // 最多播放
+	OrderStow    = "stow"    // 最多收藏
+)
+
+// GetUserVideos 获取 UP 主的投稿，order 为 OrderPubdate 等，page 从 1 开始
+func (client *BilibiliClient) GetUserVideos(mid int, order string, page int, pageSize int) ([]BilibiliVideo, error) {
+	queryParams := url.Values{}
+	queryParams.Add("mid", strconv.Itoa(mid))
+	queryParams.Add("order", order)
+	queryParams.Add("pn", strconv.Itoa(page))
+	queryParams.Add("ps", strconv.Itoa(pageSize))
+
+	var data struct {
+		List struct {
+			Vlist []struct {
+				AID     int    `json:"aid"`
+				BvID    string `json:"bvid"`
+				Title   string `json:"title"`
+				Pic     string `json:"pic"`
+				Length  string `json:"length"`
+				Author  string `json:"author"`
+				Mid     int    `json:"mid"`
+				TypeID  int    `json:"typeid"`
+				Created int64  `json:"created"`
+				// 播放量被隐藏时为 "--"
+				Play interface{} `json:"play"`
+			} `json:"vlist"`
+		} `json:"list"`
+	}
+	if err := client.getJSONWbi("/x/space/wbi/arc/search", queryParams, &data); err != nil {
+		return nil, err
+	}
+
+	videos := make([]BilibiliVideo, 0, len(data.List.Vlist))
+	for _, v := range data.List.Vlist {
+		seconds, _ := convertToSeconds(v.Length)
+		videos = append(videos, BilibiliVideo{
+			ID:       strings.TrimPrefix(v.BvID, "BV"),
+			Title:    removeHTMLTags(v.Title),
+			AVID:     v.AID,
+			Author:   v.Author,
+			MID:      v.Mid,
+			Pic:      v.Pic,
+			Duration: seconds,
+			TID:      v.TypeID,
+			Pubdate:  unixTime(v.Created),
+			Ctime:    unixTime(v.Created),
+			Stat:     VideoStat{View: anyInt(v.Play)},
+		})
+	}
+	return videos, nil
+}
+
+// SearchUsers 按关键词搜索 UP 主，page 从 1 开始
+func (client *BilibiliClient) SearchUsers(keyword string, page int) ([]BilibiliUser, SearchPage, error) {
+	var results []struct {
+		Mid    int    `json:"mid"`
+		Uname  string `json:"uname"`
+		Upic   string `json:"upic"`
+		Fans   int    `json:"fans"`
+		Videos int    `json:"videos"`
+	}
+	info, err := client.searchType(url.Values{"keyword": {keyword}}, "bili_user", page, &results)
+	if err != nil {
+		return nil, info, err
+	}
+
+	users := make([]BilibiliUser, 0, len(results))
+	for _, u := range results {
+		users = append(users, BilibiliUser{
+			MID:          u.Mid,
+			Name:         removeHTMLTags(u.Uname),
+			Face:         u.Upic,
+			Fans:         u.Fans,
+			ArchiveCount: u.Videos,
+		})
+	}
+	return users, info, nil
+}
+
+// GetUserSeasons 获取 UP 主的合集列表（第一页，最多 pageSize 个）
+func (client *BilibiliClient) GetUserSeasons(mid int, pageSize int) ([]BilibiliSeason, error) {
+	queryParams := url.Values{}
+	queryParams.Add("mid", strconv.Itoa(mid))
+	queryParams.Add("page_num", "1")
+	queryParams.Add("page_size", strconv.Itoa(pageSize))
+
+	var data struct {
+		ItemsLists struct {
+			SeasonsList []struct {
+				Meta struct {
+					SeasonID int    `json:"season_id"`
+					Name     string `json:"name"`
+					Cover    string `json:"cover"`
+					Total    int    `json:"total"`
+					Mid      int    `json:"mid"`
+				} `json:"meta"`
+			} `json:"seasons_list"`
+		} `json:"items_lists"`
+	}
+	if err := client.getJSON("/x/polymer/web-space/seasons_series_list", queryParams, &data); err != nil {
+		return nil, err
+	}
+
+	seasons := make([]BilibiliSeason, 0, len(data.ItemsLists.SeasonsList))
+	for _, s := range data.ItemsLists.SeasonsList {
+		seasons = append(seasons, BilibiliSeason{
+			ID:    s.Meta.SeasonID,
+			MID:   mid,
+			Name:  s.Meta.Name,
+			Cover: s.Meta.Cover,
+			Total: s.Meta.Total,
+		})
+	}
+	return seasons, nil
+}
+
+// ModifyRelation 关注或取消关注 UP 主，需要登录
+func (client *BilibiliClient) ModifyRelation(mid int, follow bool) error {
+	form := url.Values{}
+	form.Add("fid", strconv.Itoa(mid))
+	if follow {
+		form.Add("act", "1")
+	} else {
+		form.Add("act", "2")
+	}
+	form.Add("re_src", "11")
+
+	_, err := client.postForm("/x/relation/modify", form)
+	return err
+}
+
+// FavSeason 收藏或取消收藏合集，需要登录
+func (client *BilibiliClient) FavSeason(seasonId int, fav bool) error {
+	form := url.Values{}
+	form.Add("season_id", strconv.Itoa(seasonId))
+	form.Add("platform", "web")
+
+	path := "/x/v3/fav/season/unfav"
+	if fav {
+		path = "/x/v3/fav/season/fav"
+	}
+	_, err := client.postForm(path, form)
+	return err
+}
+
+// anyInt converts a JSON number, or a string holding one, to int.
+func anyInt(v interface{}) int {
+	switch n := v.(type) {
+	case float64:
+		return int(n)
+	case string:
+		i, _ := strconv.Atoi(n)
+		return i
+	}
+	return 0
+}
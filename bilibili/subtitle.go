@@ -0,0 +1,84 @@
+package bilibili
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// BilibiliSubtitle 是视频的一条字幕轨道，包括 UP 主上传的 CC 字幕和 AI 字幕
+type BilibiliSubtitle struct {
+	// Lang 为字幕语言，例如 "zh-CN"，AI 字幕为 "ai-zh"
+	Lang    string
+	LangDoc string
+	URL     string
+}
+
+// SubtitleLine 是一行字幕，From 和 To 的单位为秒
+type SubtitleLine struct {
+	From    float64 `json:"from"`
+	To      float64 `json:"to"`
+	Content string  `json:"content"`
+}
+
+// GetSubtitles 获取视频某个分 P 的字幕列表，AI 字幕需要登录
+func (client *BilibiliClient) GetSubtitles(bvid string, cid int) ([]BilibiliSubtitle, error) {
+	queryParams := url.Values{}
+	queryParams.Add("bvid", "BV"+bvid)
+	queryParams.Add("cid", strconv.Itoa(cid))
+
+	var data struct {
+		Subtitle struct {
+			Subtitles []struct {
+				Lan         string `json:"lan"`
+				LanDoc      string `json:"lan_doc"`
+				SubtitleURL string `json:"subtitle_url"`
+			} `json:"subtitles"`
+		} `json:"subtitle"`
+	}
+	if err := client.getJSON("/x/player/v2", queryParams, &data); err != nil {
+		return nil, err
+	}
+
+	var subtitles []BilibiliSubtitle
+	for _, s := range data.Subtitle.Subtitles {
+		if s.SubtitleURL == "" {
+			continue
+		}
+		subtitleURL := s.SubtitleURL
+		if strings.HasPrefix(subtitleURL, "//") {
+			subtitleURL = "https:" + subtitleURL
+		}
+		subtitles = append(subtitles, BilibiliSubtitle{Lang: s.Lan, LangDoc: s.LanDoc, URL: subtitleURL})
+	}
+	return subtitles, nil
+}
+
+// GetSubtitleLines 下载并解析字幕内容
+func (client *BilibiliClient) GetSubtitleLines(s BilibiliSubtitle) ([]SubtitleLine, error) {
+	req, _ := http.NewRequest("GET", s.URL, nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	req.Header.Set("Referer", "https://www.bilibili.com")
+
+	resp, err := client.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get subtitle: %s", resp.Status)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	var subtitle struct {
+		Body []SubtitleLine `json:"body"`
+	}
+	if err := json.Unmarshal(body, &subtitle); err != nil {
+		return nil, fmt.Errorf("failed to parse subtitle: %v", err)
+	}
+	return subtitle.Body, nil
+}
@@ -0,0 +1,20 @@
+package bilibili
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSignWbi(t *testing.T) {
+	mixin := mixinKey("7cd084941338484aae1ad9425b84077c", "4932caff0ff746eab6f01bf08b70ac45")
+	if mixin != "ea1db124af3c7062474693fa704f4ff8" {
+		t.Fatalf("mixin key = %s", mixin)
+	}
+
+	params := url.Values{"foo": {"114"}, "bar": {"514"}, "zab": {"1919810"}}
+	signWbi(params, mixin, time.Unix(1702204169, 0))
+	if got := params.Get("w_rid"); got != "8f6f2b5b3d485fe1886cec6a0be8c5d4" {
+		t.Fatalf("w_rid = %s", got)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+
+	"example/subsonic/bilibili"
+
+	"github.com/gin-gonic/gin"
+)
+
+const configFile = "config.json"
+
+type Config struct {
+	// Cookie bilibili 登录后的 cookie，例如 "SESSDATA=...; bili_jct=..."
+	Cookie string `json:"cookie"`
+	// Database 数据库文件路径
+	Database string `json:"database"`
+	// DryRun 为 true 时对 bilibili 的写操作只记录日志
+	DryRun    bool            `json:"dryRun"`
+	StarSync  StarSyncConfig  `json:"starSync"`
+	Playlists PlaylistsConfig `json:"playlists"`
+	Metadata  MetadataConfig  `json:"metadata"`
+	Ratings   RatingsConfig   `json:"ratings"`
+	History   HistoryConfig   `json:"history"`
+	// 可选的 ListenBrainz 转发
+	ListenBrainz ListenBrainzConfig `json:"listenBrainz"`
+	Lyrics       LyricsConfig       `json:"lyrics"`
+	RandomSongs  RandomSongsConfig  `json:"randomSongs"`
+	Search       SearchConfig       `json:"search"`
+	Genres       GenresConfig       `json:"genres"`
+	Titles       TitlesConfig       `json:"titles"`
+}
+
+// StarSyncConfig 控制收藏（star）与 bilibili 收藏夹之间的双向同步
+type StarSyncConfig struct {
+	Enabled bool   `json:"enabled"`
+	MediaID string `json:"mediaId"`
+	// Interval 拉取远端收藏夹的间隔，单位秒
+	Interval int `json:"interval"`
+	// FollowArtists 收藏艺术家时关注对应的 UP 主
+	FollowArtists bool `json:"followArtists"`
+	// CollectAlbums 收藏专辑时收藏对应的合集
+	CollectAlbums bool `json:"collectAlbums"`
+}
+
+// PlaylistsConfig 控制歌单与 bilibili 收藏夹的关系
+type PlaylistsConfig struct {
+	// WriteThrough 为 true 时，收藏夹歌单的增删会写回 bilibili，
+	// createPlaylist 传入普通名称时会新建收藏夹
+	WriteThrough bool `json:"writeThrough"`
+}
+
+// MetadataConfig 控制歌曲元数据缓存
+type MetadataConfig struct {
+	// RefreshInterval 后台刷新的间隔，单位秒
+	RefreshInterval int `json:"refreshInterval"`
+	// MaxAge 缓存超过这个时间（秒）会被刷新
+	MaxAge int `json:"maxAge"`
+	// Concurrency 同时向 bilibili 请求元数据的数量上限
+	Concurrency int `json:"concurrency"`
+}
+
+// RatingsConfig 控制评分与 bilibili 点赞、投币的映射
+type RatingsConfig struct {
+	// BilibiliActions 为 true 且已登录时，歌曲评分会同步为点赞和投币
+	BilibiliActions bool `json:"bilibiliActions"`
+	// LikeAt 评分达到这个值时点赞，5 分时额外投一个币
+	LikeAt int `json:"likeAt"`
+}
+
+// HistoryConfig 控制是否把播放上报到 bilibili 的历史记录
+type HistoryConfig struct {
+	// Users 是开启上报的用户名，其他用户的播放不会上报
+	Users []string `json:"users"`
+}
+
+// ListenBrainzConfig 控制把 scrobble 转发到 ListenBrainz 兼容的服务
+type ListenBrainzConfig struct {
+	// URL 为 API 地址，例如 https://api.listenbrainz.org，为空时不转发
+	URL string `json:"url"`
+	// Tokens 是用户名到 ListenBrainz user token 的映射，没有 token 的用户不转发
+	Tokens map[string]string `json:"tokens"`
+	// RetryInterval 为重试失败提交的间隔，单位秒
+	RetryInterval int `json:"retryInterval"`
+}
+
+// LyricsConfig 控制从字幕生成的歌词
+type LyricsConfig struct {
+	// Languages 为偏好的字幕语言，靠前的优先，例如 "zh-CN"、"ai-zh"
+	Languages []string `json:"languages"`
+	// Directory 存放本地 LRC 歌词，优先于字幕
+	Directory string `json:"directory"`
+}
+
+// RandomSongsConfig 控制 getRandomSongs
+type RandomSongsConfig struct {
+	// RankingTopUp 为 true 时，本地曲库不够时用音乐区排行榜补足
+	RankingTopUp bool `json:"rankingTopUp"`
+}
+
+// SearchConfig 是 search2/search3 搜索视频的默认过滤条件，请求中的同名参数可以覆盖
+type SearchConfig struct {
+	// TIDs 为分区 ID，0 为不限，默认 3 即音乐区及其子分区
+	TIDs int `json:"tids"`
+	// Duration 为时长分档：0 不限，1 为 10 分钟以下，2 为 10-30 分钟，3 为 30-60 分钟，4 为 60 分钟以上
+	Duration int `json:"duration"`
+	// Order 为排序方式：totalrank、click、pubdate、dm 或 stow
+	Order string `json:"order"`
+	// Audio 为 true 时，音频区搜索结果的第一页排在视频之前
+	Audio bool `json:"audio"`
+}
+
+// Filter returns the configured search filter.
+func (s SearchConfig) Filter() bilibili.SearchFilter {
+	return bilibili.SearchFilter{TIDs: s.TIDs, Duration: s.Duration, Order: s.Order}
+}
+
+// GenresConfig 控制歌曲的流派，音乐区的子分区总是作为流派
+type GenresConfig struct {
+	// Tags 是同时作为流派的视频标签，例如 "古风"、"摇滚"；为空时不获取标签
+	Tags []string `json:"tags"`
+}
+
+// TitlesConfig 控制从视频标题中整理歌名和歌手，原标题保留在 comment 中
+type TitlesConfig struct {
+	// Enabled 为 false 时直接使用视频标题，歌手为 UP 主
+	Enabled bool `json:"enabled"`
+	// RulesFile 为正则规则文件，每行一条：带 (?P<title>) 分组的规则提取歌名
+	// （可以再带 (?P<artist>)），其他规则从标题中删除匹配的内容
+	RulesFile string `json:"rulesFile"`
+	// Uploaders 是按 UP 主 mid 设置的规则
+	Uploaders map[string]UploaderTitleConfig `json:"uploaders"`
+}
+
+// UploaderTitleConfig 是单个 UP 主的标题规则，例如歌手的官方账号
+type UploaderTitleConfig struct {
+	// Artist 固定作为这个 UP 主所有歌曲的歌手
+	Artist string `json:"artist"`
+	// Pattern 是带 (?P<title>) 分组的正则，优先于其他规则
+	Pattern string `json:"pattern"`
+	// KeepTitle 为 true 时不整理标题
+	KeepTitle bool `json:"keepTitle"`
+}
+
+// ReportsHistory reports whether plays of user are sent to bilibili.
+func (h HistoryConfig) ReportsHistory(user string) bool {
+	return slices.Contains(h.Users, user)
+}
+
+func defaultConfig() Config {
+	return Config{
+		Database: "bilisonic.db",
+		StarSync: StarSyncConfig{
+			Interval: 600,
+		},
+		Metadata: MetadataConfig{
+			RefreshInterval: 3600,
+			MaxAge:          86400,
+			Concurrency:     8,
+		},
+		Ratings: RatingsConfig{
+			LikeAt: 4,
+		},
+		ListenBrainz: ListenBrainzConfig{
+			RetryInterval: 300,
+		},
+		Lyrics: LyricsConfig{
+			Languages: []string{"zh-CN", "zh-Hans", "zh-Hant", "ai-zh"},
+			Directory: "lyrics",
+		},
+		// 默认只搜索音乐区 10 分钟以下的视频，排除合集、直播录像等
+		Search: SearchConfig{
+			TIDs:     musicTID,
+			Duration: bilibili.SearchDurationUnder10,
+			Order:    bilibili.SearchOrderTotalRank,
+			Audio:    true,
+		},
+		Titles: TitlesConfig{
+			Enabled: true,
+		},
+	}
+}
+
+// loadConfig reads config.json from the working directory. A missing file
+// yields the default configuration.
+func loadConfig() (Config, error) {
+	cfg := defaultConfig()
+	f, err := os.Open(configFile)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.validate()
+}
+
+// validate checks the settings that cannot be used as given.
+func (cfg *Config) validate() error {
+	if cfg.StarSync.Enabled && cfg.StarSync.MediaID == "" {
+		return errors.New("starSync.mediaId is required when starSync is enabled")
+	}
+	return nil
+}
+
+// configFrom returns the configuration set on the request context, falling
+// back to the defaults.
+func configFrom(c *gin.Context) *Config {
+	if cfg, ok := c.Get("config"); ok {
+		return cfg.(*Config)
+	}
+	cfg := defaultConfig()
+	return &cfg
+}
@@ -0,0 +1,750 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"example/subsonic/bilibili"
+
+	"github.com/gin-gonic/gin"
+)
+
+const fakeCSRF = "fake-csrf"
+
+type fakeVideo struct {
+	AID      int
+	Title    string
+	Author   string
+	Duration int
+	TID      int
+	Plays    int
+	Pubdate  int64
+	Ctime    int64
+	Likes    int
+	Tags     []string
+}
+
+// fakeBilibili 是测试用的 bilibili 接口，保存视频和收藏夹并记录所有写请求
+type fakeBilibili struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	videos  map[string]fakeVideo // bvid -> video
+	folders map[string][]string  // media id -> bvids
+	posts   []string
+	nextID  int
+	views   int
+	plays   int
+
+	subtitles map[string]map[string][]string // bvid -> lan -> lines
+	related   map[string][]string            // bvid -> related bvids
+	order     []string                       // bvids in the order they were added
+	users     map[int]string                 // mid -> name, for user search
+	ranking   []string                       // bvids of the music ranking
+	seasons   map[int][]int                  // mid -> season ids
+	pageSize  int                            // page size of the search
+	audios    map[int]string                 // sid -> title of audio songs
+	lyrics    map[int]string                 // sid -> LRC of audio songs
+	menus     map[int][]int                  // menu id -> sids
+}
+
+func newFakeBilibili(t *testing.T) *fakeBilibili {
+	f := &fakeBilibili{
+		videos:  map[string]fakeVideo{},
+		folders: map[string][]string{},
+		nextID:  1000,
+
+		subtitles: map[string]map[string][]string{},
+		related:   map[string][]string{},
+		users:     map[int]string{},
+		seasons:   map[int][]int{},
+		pageSize:  20,
+		audios:    map[int]string{},
+		lyrics:    map[int]string{},
+		menus:     map[int][]int{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/x/web-interface/view", f.view)
+	mux.HandleFunc("/x/v3/fav/resource/list", f.favList)
+	mux.HandleFunc("/x/v3/fav/resource/deal", f.favDeal)
+	mux.HandleFunc("/x/v3/fav/resource/batch-del", f.favBatchDel)
+	mux.HandleFunc("/x/v3/fav/folder/add", f.folderAdd)
+	mux.HandleFunc("/x/player/v2", f.playerInfo)
+	mux.HandleFunc("/x/web-interface/archive/related", f.relatedVideos)
+	mux.HandleFunc("/x/web-interface/nav", f.nav)
+	mux.HandleFunc("/x/web-interface/ranking/v2", f.rankingList)
+	mux.HandleFunc("/x/tag/archive/tags", f.videoTags)
+	mux.HandleFunc("/x/web-interface/search/type", f.search)
+	mux.HandleFunc("/x/space/wbi/arc/search", f.spaceVideos)
+	mux.HandleFunc("/subtitle/", f.subtitle)
+	mux.HandleFunc("/x/web-interface/card", f.card)
+	mux.HandleFunc("/x/polymer/web-space/seasons_archives_list", f.seasonArchives)
+	mux.HandleFunc("/x/polymer/web-space/seasons_series_list", f.seasonsList)
+	mux.HandleFunc("/audio/music-service-c/web/song/info", f.audioInfo)
+	mux.HandleFunc("/audio/music-service-c/s", f.audioSearch)
+	mux.HandleFunc("/audio/music-service-c/web/menu/info", f.menuInfo)
+	mux.HandleFunc("/audio/music-service-c/web/song/of-menu", f.menuSongs)
+	mux.HandleFunc("/audio/music-service-c/web/url", f.audioURL)
+	mux.HandleFunc("/audiofile/", f.audioFile)
+	mux.HandleFunc("/audiolyric/", f.audioLyric)
+	mux.HandleFunc("/x/player/pagelist", f.pageList)
+	mux.HandleFunc("/x/player/playurl", f.playURL)
+	mux.HandleFunc("/videoaudio/", f.videoAudio)
+	mux.HandleFunc("/x/relation/modify", f.recordPost)
+	mux.HandleFunc("/x/v3/fav/season/fav", f.recordPost)
+	mux.HandleFunc("/x/v3/fav/season/unfav", f.recordPost)
+	mux.HandleFunc("/x/web-interface/archive/like", f.recordPost)
+	mux.HandleFunc("/x/web-interface/coin/add", f.recordPost)
+	mux.HandleFunc("/x/click-interface/web/heartbeat", f.recordPost)
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// addVideo registers a video with an aid derived from its position.
+func (f *fakeBilibili) addVideo(bvid string, title string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.videos[bvid] = fakeVideo{AID: len(f.videos) + 1, Title: title, Author: "up", Duration: 200, TID: 31}
+	f.order = append(f.order, bvid)
+}
+
+// updateVideo changes the details of a registered video.
+func (f *fakeBilibili) updateVideo(bvid string, fn func(v *fakeVideo)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v := f.videos[bvid]
+	fn(&v)
+	f.videos[bvid] = v
+}
+
+func (f *fakeBilibili) addUser(mid int, name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users[mid] = name
+}
+
+func (f *fakeBilibili) addSeason(mid int, seasonID int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seasons[mid] = append(f.seasons[mid], seasonID)
+}
+
+// addAudio registers an audio song sung by "singer" and uploaded by mid 7.
+func (f *fakeBilibili) addAudio(sid int, title string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.audios[sid] = title
+}
+
+// setAudioLyric sets the LRC lyrics of an audio song.
+func (f *fakeBilibili) setAudioLyric(sid int, lrc string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lyrics[sid] = lrc
+}
+
+func (f *fakeBilibili) setMenu(menuID int, sids ...int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.menus[menuID] = sids
+}
+
+func (f *fakeBilibili) setRelated(bvid string, related ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.related[bvid] = related
+}
+
+// addSubtitle adds a subtitle track to a video, with one line every two seconds.
+func (f *fakeBilibili) addSubtitle(bvid string, lan string, lines ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.subtitles[bvid] == nil {
+		f.subtitles[bvid] = map[string][]string{}
+	}
+	f.subtitles[bvid][lan] = lines
+}
+
+func (f *fakeBilibili) folder(mediaID string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.folders[mediaID]...)
+}
+
+func (f *fakeBilibili) viewCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.views
+}
+
+func (f *fakeBilibili) playCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.plays
+}
+
+func (f *fakeBilibili) postCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.posts)
+}
+
+// client returns a logged-in client talking to the fake server.
+func (f *fakeBilibili) client() *bilibili.BilibiliClient {
+	jar, _ := cookiejar.New(nil)
+	client := &bilibili.BilibiliClient{Client: &http.Client{Jar: jar}, APIBase: f.URL}
+	client.SetCookie("SESSDATA=fake; bili_jct=" + fakeCSRF)
+	return client
+}
+
+func (f *fakeBilibili) bvidByAID(aid int) string {
+	for bvid, v := range f.videos {
+		if v.AID == aid {
+			return bvid
+		}
+	}
+	return ""
+}
+
+func writeData(w http.ResponseWriter, data interface{}) {
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": 0, "message": "0", "data": data})
+}
+
+func writeCode(w http.ResponseWriter, code int, message string) {
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": code, "message": message})
+}
+
+func (f *fakeBilibili) view(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.views++
+	bvid := strings.TrimPrefix(r.URL.Query().Get("bvid"), "BV")
+	if _, ok := f.videos[bvid]; !ok {
+		writeCode(w, -404, "啥都木有")
+		return
+	}
+	writeData(w, f.videoJSON(bvid))
+}
+
+func (f *fakeBilibili) favList(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	medias := []map[string]interface{}{}
+	for _, bvid := range f.folders[r.URL.Query().Get("media_id")] {
+		v := f.videos[bvid]
+		medias = append(medias, map[string]interface{}{
+			"id":       v.AID,
+			"title":    v.Title,
+			"duration": v.Duration,
+			"cover":    "//i0.hdslb.com/" + bvid + ".jpg",
+			"bvid":     "BV" + bvid,
+			"upper":    map[string]interface{}{"name": v.Author},
+		})
+	}
+	writeData(w, map[string]interface{}{"medias": medias, "has_more": false})
+}
+
+// checkPost records a write request and verifies its csrf token.
+func (f *fakeBilibili) checkPost(w http.ResponseWriter, r *http.Request) bool {
+	r.ParseForm()
+	f.posts = append(f.posts, r.URL.Path+"?"+r.PostForm.Encode())
+	if r.Method != "POST" || r.PostForm.Get("csrf") != fakeCSRF {
+		writeCode(w, -111, "csrf 校验失败")
+		return false
+	}
+	return true
+}
+
+func (f *fakeBilibili) favDeal(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.checkPost(w, r) {
+		return
+	}
+	aid, _ := strconv.Atoi(r.PostForm.Get("rid"))
+	bvid := f.bvidByAID(aid)
+	for _, m := range strings.Split(r.PostForm.Get("add_media_ids"), ",") {
+		if m != "" && !containsID(f.folders[m], bvid) {
+			// 新收藏的视频排在最前面
+			f.folders[m] = append([]string{bvid}, f.folders[m]...)
+		}
+	}
+	for _, m := range strings.Split(r.PostForm.Get("del_media_ids"), ",") {
+		if m != "" {
+			f.folders[m] = removeID(f.folders[m], bvid)
+		}
+	}
+	writeData(w, nil)
+}
+
+func (f *fakeBilibili) favBatchDel(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.checkPost(w, r) {
+		return
+	}
+	m := r.PostForm.Get("media_id")
+	for _, res := range strings.Split(r.PostForm.Get("resources"), ",") {
+		aid, _ := strconv.Atoi(strings.TrimSuffix(res, ":2"))
+		f.folders[m] = removeID(f.folders[m], f.bvidByAID(aid))
+	}
+	writeData(w, nil)
+}
+
+func (f *fakeBilibili) folderAdd(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.checkPost(w, r) {
+		return
+	}
+	f.nextID++
+	f.folders[strconv.Itoa(f.nextID)] = []string{}
+	writeData(w, map[string]interface{}{"id": f.nextID, "title": r.PostForm.Get("title")})
+}
+
+func (f *fakeBilibili) playerInfo(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	bvid := strings.TrimPrefix(r.URL.Query().Get("bvid"), "BV")
+	subtitles := []map[string]interface{}{}
+	for lan := range f.subtitles[bvid] {
+		subtitles = append(subtitles, map[string]interface{}{
+			"lan":          lan,
+			"lan_doc":      lan,
+			"subtitle_url": f.URL + "/subtitle/" + bvid + "/" + lan + ".json",
+		})
+	}
+	writeData(w, map[string]interface{}{"subtitle": map[string]interface{}{"subtitles": subtitles}})
+}
+
+func (f *fakeBilibili) subtitle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/subtitle/"), ".json"), "/")
+	body := []map[string]interface{}{}
+	for i, line := range f.subtitles[parts[0]][parts[1]] {
+		body = append(body, map[string]interface{}{"from": float64(i) * 2, "to": float64(i)*2 + 2, "content": line})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"body": body})
+}
+
+func (f *fakeBilibili) videoJSON(bvid string) map[string]interface{} {
+	v := f.videos[bvid]
+	return map[string]interface{}{
+		"bvid":     "BV" + bvid,
+		"aid":      v.AID,
+		"cid":      v.AID * 10,
+		"title":    v.Title,
+		"pic":      "//i0.hdslb.com/" + bvid + ".jpg",
+		"duration": v.Duration,
+		"tid":      v.TID,
+		"pubdate":  v.Pubdate,
+		"ctime":    v.Ctime,
+		"owner":    map[string]interface{}{"name": v.Author, "mid": 1},
+		"stat":     map[string]interface{}{"view": v.Plays, "like": v.Likes},
+	}
+}
+
+func (f *fakeBilibili) relatedVideos(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	videos := []map[string]interface{}{}
+	for _, bvid := range f.related[strings.TrimPrefix(r.URL.Query().Get("bvid"), "BV")] {
+		videos = append(videos, f.videoJSON(bvid))
+	}
+	writeData(w, videos)
+}
+
+// search 搜索标题包含关键词的视频（按添加顺序，或 order=click 时按播放量）或名字包含关键词的 UP 主（按 mid 排序），
+// 结果中的关键词像真实接口一样高亮
+func (f *fakeBilibili) search(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	q := r.URL.Query()
+	keyword := q.Get("keyword")
+	highlight := func(s string) string {
+		return strings.ReplaceAll(s, keyword, `<em class="keyword">`+keyword+`</em>`)
+	}
+	result := []map[string]interface{}{}
+	switch q.Get("search_type") {
+	case "video":
+		bvids := append([]string(nil), f.order...)
+		if q.Get("order") == "click" {
+			sort.SliceStable(bvids, func(i, j int) bool { return f.videos[bvids[i]].Plays > f.videos[bvids[j]].Plays })
+		}
+		for _, bvid := range bvids {
+			v := f.videos[bvid]
+			if !strings.Contains(v.Title, keyword) || !fakeSearchMatch(q, v) {
+				continue
+			}
+			result = append(result, map[string]interface{}{
+				"bvid":     "BV" + bvid,
+				"aid":      v.AID,
+				"title":    highlight(v.Title),
+				"author":   v.Author,
+				"mid":      1,
+				"pic":      "//i0.hdslb.com/" + bvid + ".jpg",
+				"duration": fmt.Sprintf("%d:%02d", v.Duration/60, v.Duration%60),
+				"typeid":   strconv.Itoa(v.TID),
+				"pubdate":  v.Pubdate,
+				"senddate": v.Ctime,
+				"play":     v.Plays,
+				"like":     v.Likes,
+			})
+		}
+	case "bili_user":
+		var mids []int
+		for mid, name := range f.users {
+			if strings.Contains(name, keyword) {
+				mids = append(mids, mid)
+			}
+		}
+		sort.Ints(mids)
+		for _, mid := range mids {
+			result = append(result, map[string]interface{}{"mid": mid, "uname": highlight(f.users[mid]), "upic": "//i0.hdslb.com/face.jpg", "fans": 10, "videos": 3})
+		}
+	}
+
+	page, _ := strconv.Atoi(q.Get("page"))
+	page = max(page, 1)
+	numPages := (len(result) + f.pageSize - 1) / f.pageSize
+	start := min((page-1)*f.pageSize, len(result))
+	end := min(start+f.pageSize, len(result))
+	writeData(w, map[string]interface{}{
+		"result":     result[start:end],
+		"pagesize":   f.pageSize,
+		"numResults": len(result),
+		"numPages":   numPages,
+	})
+}
+
+// fakeSearchMatch 实现视频搜索的 tids（音乐区包括子分区）和 duration 过滤，duration 只支持 1
+func fakeSearchMatch(q url.Values, v fakeVideo) bool {
+	if tids, _ := strconv.Atoi(q.Get("tids")); tids != 0 {
+		if _, ok := musicTIDs[v.TID]; tids != v.TID && !(tids == musicTID && ok) {
+			return false
+		}
+	}
+	return q.Get("duration") != "1" || v.Duration < 600
+}
+
+// seasonsList 返回 UP 主的合集 "season<id>"，每个合集有两个视频
+func (f *fakeBilibili) seasonsList(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	mid, _ := strconv.Atoi(r.URL.Query().Get("mid"))
+	list := []map[string]interface{}{}
+	for _, id := range f.seasons[mid] {
+		list = append(list, map[string]interface{}{"meta": map[string]interface{}{
+			"season_id": id,
+			"name":      "season" + strconv.Itoa(id),
+			"cover":     "https://i0.hdslb.com/season.jpg",
+			"total":     2,
+			"mid":       mid,
+		}})
+	}
+	writeData(w, map[string]interface{}{"items_lists": map[string]interface{}{"seasons_list": list}})
+}
+
+func (f *fakeBilibili) rankingList(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	list := []map[string]interface{}{}
+	for _, bvid := range f.ranking {
+		list = append(list, f.videoJSON(bvid))
+	}
+	writeData(w, map[string]interface{}{"list": list})
+}
+
+func (f *fakeBilibili) videoTags(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	bvid := strings.TrimPrefix(r.URL.Query().Get("bvid"), "BV")
+	tags := []map[string]interface{}{}
+	for _, tag := range f.videos[bvid].Tags {
+		tags = append(tags, map[string]interface{}{"tag_name": tag})
+	}
+	writeData(w, tags)
+}
+
+// nav 和未登录时一样返回 -101，但带有 WBI 密钥
+func (f *fakeBilibili) nav(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"code":    -101,
+		"message": "账号未登录",
+		"data": map[string]interface{}{"wbi_img": map[string]interface{}{
+			"img_url": "https://i0.hdslb.com/bfs/wbi/7cd084941338484aae1ad9425b84077c.png",
+			"sub_url": "https://i0.hdslb.com/bfs/wbi/4932caff0ff746eab6f01bf08b70ac45.png",
+		}},
+	})
+}
+
+// spaceVideos 返回所有视频（UP 主都是 mid 1），order=click 时按播放量排序
+func (f *fakeBilibili) spaceVideos(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	q := r.URL.Query()
+	if q.Get("w_rid") == "" || q.Get("wts") == "" {
+		writeCode(w, -403, "访问权限不足")
+		return
+	}
+	bvids := append([]string(nil), f.order...)
+	if q.Get("order") == "click" {
+		sort.SliceStable(bvids, func(i, j int) bool { return f.videos[bvids[i]].Plays > f.videos[bvids[j]].Plays })
+	}
+	pn, _ := strconv.Atoi(q.Get("pn"))
+	ps, _ := strconv.Atoi(q.Get("ps"))
+	start := min((pn-1)*ps, len(bvids))
+	end := min(start+ps, len(bvids))
+
+	vlist := []map[string]interface{}{}
+	for _, bvid := range bvids[start:end] {
+		v := f.videos[bvid]
+		vlist = append(vlist, map[string]interface{}{
+			"aid":    v.AID,
+			"bvid":   "BV" + bvid,
+			"title":  v.Title,
+			"pic":    "//i0.hdslb.com/" + bvid + ".jpg",
+			"length": fmt.Sprintf("%02d:%02d", v.Duration/60, v.Duration%60),
+			"author": v.Author,
+			"mid":    1,
+			"typeid": v.TID,
+			"play":   v.Plays,
+		})
+	}
+	writeData(w, map[string]interface{}{
+		"list": map[string]interface{}{"vlist": vlist},
+		"page": map[string]interface{}{"pn": pn, "ps": ps, "count": len(bvids)},
+	})
+}
+
+// card 返回 mid 为 n 的 UP 主 "up<n>"
+func (f *fakeBilibili) card(w http.ResponseWriter, r *http.Request) {
+	mid := r.URL.Query().Get("mid")
+	writeData(w, map[string]interface{}{
+		"card":          map[string]interface{}{"mid": mid, "name": "up" + mid, "face": "https://i0.hdslb.com/face" + mid + ".jpg"},
+		"archive_count": 10,
+	})
+}
+
+// seasonArchives 返回只包含第一个视频的合集 "season<id>"
+func (f *fakeBilibili) seasonArchives(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("season_id")
+	writeData(w, map[string]interface{}{
+		"archives": []map[string]interface{}{{"aid": 1, "bvid": "BVa", "title": "A", "pic": "//i0.hdslb.com/a.jpg", "duration": 200}},
+		"meta":     map[string]interface{}{"name": "season" + id, "cover": "https://i0.hdslb.com/season.jpg", "total": 1},
+	})
+}
+
+func (f *fakeBilibili) audioJSON(sid int) map[string]interface{} {
+	lyric := ""
+	if _, ok := f.lyrics[sid]; ok {
+		lyric = f.URL + "/audiolyric/" + strconv.Itoa(sid)
+	}
+	return map[string]interface{}{
+		"id":       sid,
+		"uid":      7,
+		"uname":    "label",
+		"author":   "singer",
+		"title":    f.audios[sid],
+		"cover":    "http://i0.hdslb.com/bfs/music/" + strconv.Itoa(sid) + ".jpg",
+		"lyric":    lyric,
+		"duration": 240,
+		"passtime": 1600000000,
+	}
+}
+
+// audioInfo 和真实接口一样，歌曲不存在时返回 72000000
+func (f *fakeBilibili) audioInfo(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sid, _ := strconv.Atoi(r.URL.Query().Get("sid"))
+	if _, ok := f.audios[sid]; !ok {
+		json.NewEncoder(w).Encode(map[string]interface{}{"code": 72000000, "msg": "歌曲不存在", "data": nil})
+		return
+	}
+	writeData(w, f.audioJSON(sid))
+}
+
+// audioSearch 返回标题包含关键词的音频，只有一页
+func (f *fakeBilibili) audioSearch(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keyword := r.URL.Query().Get("keyword")
+	var sids []int
+	for sid, title := range f.audios {
+		if strings.Contains(title, keyword) {
+			sids = append(sids, sid)
+		}
+	}
+	sort.Ints(sids)
+	result := []map[string]interface{}{}
+	for _, sid := range sids {
+		result = append(result, f.audioJSON(sid))
+	}
+	writeData(w, map[string]interface{}{"page": 1, "pagesize": 20, "num_pages": 1, "num_result": len(result), "result": result})
+}
+
+// menuInfo 返回歌单 "menu<id>"
+func (f *fakeBilibili) menuInfo(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id, _ := strconv.Atoi(r.URL.Query().Get("sid"))
+	if _, ok := f.menus[id]; !ok {
+		writeCode(w, 72000000, "歌单不存在")
+		return
+	}
+	writeData(w, map[string]interface{}{
+		"menuId": id, "uid": 7, "uname": "label", "title": "menu" + strconv.Itoa(id),
+		"intro": "intro", "cover": "http://i0.hdslb.com/bfs/music/menu.jpg", "snum": len(f.menus[id]), "ctime": 1600000000,
+	})
+}
+
+// menuSongs 每页返回一首歌，以检查翻页
+func (f *fakeBilibili) menuSongs(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	q := r.URL.Query()
+	id, _ := strconv.Atoi(q.Get("sid"))
+	pn, _ := strconv.Atoi(q.Get("pn"))
+	sids := f.menus[id]
+	data := []map[string]interface{}{}
+	if pn >= 1 && pn <= len(sids) {
+		data = append(data, f.audioJSON(sids[pn-1]))
+	}
+	writeData(w, map[string]interface{}{"curPage": pn, "pageCount": len(sids), "totalSize": len(sids), "pageSize": 1, "data": data})
+}
+
+func (f *fakeBilibili) audioURL(w http.ResponseWriter, r *http.Request) {
+	sid := r.URL.Query().Get("sid")
+	writeData(w, map[string]interface{}{"sid": sid, "cdns": []string{f.URL + "/audiofile/" + sid}})
+}
+
+// audioFile 返回 "audio<sid>"，没有 Referer 时和 CDN 一样拒绝
+func (f *fakeBilibili) audioFile(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Referer") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	w.Write([]byte("audio" + strings.TrimPrefix(r.URL.Path, "/audiofile/")))
+}
+
+func (f *fakeBilibili) audioLyric(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sid, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/audiolyric/"))
+	w.Write([]byte(f.lyrics[sid]))
+}
+
+func (f *fakeBilibili) pageList(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v := f.videos[strings.TrimPrefix(r.URL.Query().Get("bvid"), "BV")]
+	writeData(w, []map[string]interface{}{{"cid": v.AID * 10, "page": 1}})
+}
+
+// playURL 返回一个 132kbps 的 AAC 音频流，响度为 -10 LUFS、-1 dBTP
+func (f *fakeBilibili) playURL(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.plays++
+	f.mu.Unlock()
+	bvid := strings.TrimPrefix(r.URL.Query().Get("bvid"), "BV")
+	writeData(w, map[string]interface{}{
+		"dash": map[string]interface{}{"audio": []map[string]interface{}{
+			{"id": 30232, "baseUrl": f.URL + "/videoaudio/" + bvid, "codecs": "mp4a.40.2", "bandwidth": 132000},
+		}},
+		"volume": map[string]interface{}{"measured_i": -10.0, "measured_tp": -1.0, "target_i": -16.0},
+	})
+}
+
+// videoAudio 返回带 mp4a sample entry 的 MP4 开头：双声道、16 位、48kHz
+func (f *fakeBilibili) videoAudio(w http.ResponseWriter, r *http.Request) {
+	w.Write(fakeMP4Head("mp4a", 2, 16, 48000))
+}
+
+// fakeMP4Head 生成 MP4 开头的 audio sample entry，fLaC 像真实文件一样带有 dfLa，
+// 采样率超过 65535 时 sample entry 中为 0
+func fakeMP4Head(codec string, channels int, sampleSize int, sampleRate int) []byte {
+	entry := make([]byte, 36)
+	binary.BigEndian.PutUint32(entry[0:4], 36)
+	copy(entry[4:8], codec)
+	binary.BigEndian.PutUint16(entry[14:16], 1)
+	binary.BigEndian.PutUint16(entry[24:26], uint16(channels))
+	binary.BigEndian.PutUint16(entry[26:28], uint16(sampleSize))
+	if sampleRate <= 0xffff {
+		binary.BigEndian.PutUint32(entry[32:36], uint32(sampleRate)<<16)
+	}
+	if codec == "fLaC" {
+		// 长度、类型、version/flags、块头和 34 字节的 STREAMINFO
+		dfLa := make([]byte, 16+34)
+		binary.BigEndian.PutUint32(dfLa[0:4], uint32(len(dfLa)))
+		copy(dfLa[4:8], "dfLa")
+		dfLa[12] = 0x80 // 最后一个块，类型 0 为 STREAMINFO
+		dfLa[15] = 34
+		si := dfLa[16:]
+		si[10] = byte(sampleRate >> 12)
+		si[11] = byte(sampleRate >> 4)
+		si[12] = byte(sampleRate<<4) | byte(channels-1)<<1 | byte(sampleSize-1)>>4
+		si[13] = byte(sampleSize-1) << 4
+		entry = append(entry, dfLa...)
+	}
+	return append(append([]byte("\x00\x00\x00\x18ftypdash"), entry...), make([]byte, 64)...)
+}
+
+func (f *fakeBilibili) recordPost(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.checkPost(w, r) {
+		return
+	}
+	writeData(w, nil)
+}
+
+func containsID(list []string, id string) bool {
+	for _, v := range list {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func removeID(list []string, id string) []string {
+	var result []string
+	for _, v := range list {
+		if v != id {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// newTestRouter mirrors the middleware in main with the given client and config.
+func newTestRouter(client *bilibili.BilibiliClient, cfg *Config) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("client", client)
+		c.Set("config", cfg)
+		c.Next()
+	})
+	return router
+}
+
+func doGet(router *gin.Engine, path string, query url.Values) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", path+"?"+query.Encode(), nil)
+	router.ServeHTTP(w, req)
+	return w
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"log"
+	"slices"
+	"sort"
+
+	"example/subsonic/bilibili"
+)
+
+// genreCount 是一个流派及其在本地曲库中的歌曲数
+type genreCount struct {
+	Name      string
+	SongCount int
+}
+
+// songGenres returns the genres of m: its music sub-partition, or the genre
+// set by hand, then those of its tags listed in tagGenres, in the configured
+// order.
+func songGenres(m *SongMeta, tagGenres []string) []string {
+	var genres []string
+	g := genreOf(&m.BilibiliVideo)
+	if o := songOverride(m.ID); o.Genre != "" {
+		g = o.Genre
+	}
+	if g != "" {
+		genres = append(genres, g)
+	}
+	for _, g := range tagGenres {
+		if slices.Contains(m.Tags, g) && !slices.Contains(genres, g) {
+			genres = append(genres, g)
+		}
+	}
+	return genres
+}
+
+// genreTID returns the partition whose name is genre.
+func genreTID(genre string) (int, bool) {
+	for tid, name := range musicTIDs {
+		if name == genre {
+			return tid, true
+		}
+	}
+	return 0, false
+}
+
+// ensureTags fetches the tags of the videos in metas that have none cached,
+// updating metas in place. Placeholders for songs that could not be looked up
+// and audio songs are skipped.
+func ensureTags(client *bilibili.BilibiliClient, metas []SongMeta, concurrency int) {
+	var missing []int
+	for i, m := range metas {
+		if !m.TagsFetched && !m.Unavailable && !m.Updated.IsZero() && !isAudioID(m.ID) {
+			missing = append(missing, i)
+		}
+	}
+
+	forEachLimit(missing, concurrency, func(i int) {
+		tags, err := client.GetVideoTags(metas[i].ID)
+		if err != nil {
+			log.Println("get video tags error:", err)
+			return
+		}
+		metas[i].Tags, metas[i].TagsFetched = tags, true
+		if err := saveSongMeta(metas[i]); err != nil {
+			log.Println("save song meta error:", err)
+		}
+	})
+}
+
+// librarySongMetas returns the metadata of the local library, with tags when
+// tag genres are configured.
+func librarySongMetas(client *bilibili.BilibiliClient, cfg *Config) ([]SongMeta, error) {
+	ids, err := librarySongIDs()
+	if err != nil {
+		return nil, err
+	}
+	metas := lookupSongMetas(client, ids, cfg.Metadata.Concurrency)
+	if len(cfg.Genres.Tags) > 0 {
+		ensureTags(client, metas, cfg.Metadata.Concurrency)
+	}
+	return metas, nil
+}
+
+// libraryGenres counts the songs of the library by genre. Every music
+// sub-partition is listed, as getSongsByGenre can fill them from rankings,
+// followed by the configured tag genres and the genres set by hand.
+func libraryGenres(client *bilibili.BilibiliClient, cfg *Config) ([]genreCount, error) {
+	metas, err := librarySongMetas(client, cfg)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	for _, m := range metas {
+		if m.Unavailable {
+			continue
+		}
+		for _, g := range songGenres(&m, cfg.Genres.Tags) {
+			counts[g]++
+		}
+	}
+
+	tids := make([]int, 0, len(musicTIDs))
+	for tid := range musicTIDs {
+		tids = append(tids, tid)
+	}
+	sort.Ints(tids)
+	var genres []genreCount
+	for _, tid := range tids {
+		genres = append(genres, genreCount{Name: musicTIDs[tid], SongCount: counts[musicTIDs[tid]]})
+	}
+	listed := map[string]bool{}
+	for _, g := range genres {
+		listed[g.Name] = true
+	}
+	for _, g := range cfg.Genres.Tags {
+		if !listed[g] {
+			genres = append(genres, genreCount{Name: g, SongCount: counts[g]})
+			listed[g] = true
+		}
+	}
+	var others []string
+	for g := range counts {
+		if !listed[g] {
+			others = append(others, g)
+		}
+	}
+	sort.Strings(others)
+	for _, g := range others {
+		genres = append(genres, genreCount{Name: g, SongCount: counts[g]})
+	}
+	return genres, nil
+}
+
+// songsByGenre returns count songs of genre starting at offset: the songs of
+// the library, then for partitions the songs of the partition's ranking.
+func songsByGenre(client *bilibili.BilibiliClient, cfg *Config, genre string, offset int, count int) ([]SongMeta, error) {
+	metas, err := librarySongMetas(client, cfg)
+	if err != nil {
+		return nil, err
+	}
+	var result []SongMeta
+	seen := map[string]bool{}
+	for _, m := range metas {
+		if !m.Unavailable && slices.Contains(songGenres(&m, cfg.Genres.Tags), genre) {
+			result = append(result, m)
+			seen[m.ID] = true
+		}
+	}
+
+	if tid, ok := genreTID(genre); ok && offset+count > len(result) {
+		ranking, err := client.GetRanking(tid)
+		if err != nil {
+			log.Println("get ranking error:", err)
+		}
+		for _, v := range ranking {
+			// 音乐区的排行榜包括所有子分区
+			if seen[v.ID] || !isSongLike(&v) || tid != musicTID && genreOf(&v) != genre {
+				continue
+			}
+			seen[v.ID] = true
+			result = append(result, SongMeta{BilibiliVideo: v})
+			if err := saveVideoMeta(&v); err != nil {
+				log.Println("save song meta error:", err)
+			}
+		}
+	}
+	return pageOf(result, offset, count), nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGenres(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	for _, id := range []string{"cover", "original", "ranked", "vlog"} {
+		fake.addVideo(id, id)
+	}
+	fake.updateVideo("cover", func(v *fakeVideo) { v.Tags = []string{"翻唱", "VOCALOID"} })
+	fake.updateVideo("original", func(v *fakeVideo) { v.TID = 28; v.Tags = []string{"VOCALOID"} })
+	fake.updateVideo("vlog", func(v *fakeVideo) { v.TID = 21 })
+	fake.ranking = []string{"ranked", "vlog", "cover"}
+	starSong("cover")
+	starSong("original")
+
+	cfg := defaultConfig()
+	cfg.Genres.Tags = []string{"VOCALOID"}
+	router := newTestRouter(fake.client(), &cfg)
+	router.GET("/rest/getGenres", GetGenresHandlerXML)
+	router.GET("/rest/getSongsByGenre", GetSongsByGenreHandlerXML)
+	router.GET("/rest/getSong", GetSongXML)
+	get := func(path string, query url.Values) SubsonicResponseXML {
+		w := doGet(router, path, query)
+		var resp SubsonicResponseXML
+		if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("bad xml: %v", err)
+		}
+		return resp
+	}
+
+	counts := map[string]int{}
+	for _, g := range get("/rest/getGenres", nil).Genres.Genre {
+		counts[g.Value] = g.SongCount
+	}
+	if counts["翻唱"] != 1 || counts["原创音乐"] != 1 || counts["VOCALOID"] != 2 || counts["演奏"] != 0 {
+		t.Fatalf("genres = %v", counts)
+	}
+	if _, ok := counts["演奏"]; !ok {
+		t.Fatalf("empty partitions should be listed: %v", counts)
+	}
+
+	songIDs := func(query url.Values) []string {
+		resp := get("/rest/getSongsByGenre", query)
+		if resp.SongsByGenre == nil {
+			t.Fatalf("unexpected response: %+v", resp)
+		}
+		var ids []string
+		for _, s := range resp.SongsByGenre.Song {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+	if ids := songIDs(url.Values{"genre": {"VOCALOID"}}); !slices.Equal(ids, []string{"cover", "original"}) {
+		t.Fatalf("songs by tag = %v", ids)
+	}
+	// 曲库之后是分区排行榜中的歌曲，不重复
+	if ids := songIDs(url.Values{"genre": {"翻唱"}}); !slices.Equal(ids, []string{"cover", "ranked"}) {
+		t.Fatalf("songs by partition = %v", ids)
+	}
+	if ids := songIDs(url.Values{"genre": {"翻唱"}, "count": {"1"}, "offset": {"1"}}); !slices.Equal(ids, []string{"ranked"}) {
+		t.Fatalf("songs by partition page = %v", ids)
+	}
+	if ids := songIDs(url.Values{"genre": {"翻唱"}, "musicFolderId": {"2"}}); len(ids) != 0 {
+		t.Fatalf("songs of another folder = %v", ids)
+	}
+
+	w := doGet(router, "/rest/getSongsByGenre", nil)
+	if !strings.Contains(w.Body.String(), `code="10"`) {
+		t.Fatalf("missing genre accepted: %s", w.Body)
+	}
+
+	song := get("/rest/getSong", url.Values{"id": {"cover"}}).Song
+	if song == nil || song.Genre != "翻唱" || len(song.Genres) != 2 || song.Genres[1].Name != "VOCALOID" {
+		t.Fatalf("song genres = %+v", song)
+	}
+}
+
+func TestEnsureTagsKeepsStream(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addVideo("a", "A")
+	client := fake.client()
+	metas := lookupSongMetas(client, []string{"a"}, 1)
+
+	// 获取标签期间第一次播放记录了音频格式
+	m, _, _ := repo.SongMeta("a")
+	m.Stream = &StreamInfo{Codec: "mp4a", SamplingRate: 48000}
+	repo.SaveSongMeta(m)
+
+	ensureTags(client, metas, 1)
+	if m, _, _ := repo.SongMeta("a"); !m.TagsFetched || m.Stream == nil || m.Stream.SamplingRate != 48000 {
+		t.Fatalf("meta after fetching tags = %+v", m)
+	}
+}
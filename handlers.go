@@ -1,9 +1,13 @@
 package main
 
 import (
+	"encoding/json"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
+	"strconv"
+	"time"
 
 	"example/subsonic/bilibili"
 
@@ -14,14 +18,33 @@ const VERSION = "1.16.1"
 const SERVER_VERSION = "0.0.1"
 
 type SubsonicResponse struct {
-	Status        string       `json:"status"`
-	Version       string       `json:"version"`
-	Type          string       `json:"type"`
-	ServerVersion string       `json:"serverVersion"`
-	OpenSubsonic  bool         `json:"openSubsonic"`
-	SearchResult2 SearchResult `json:"searchResult2"`
-	SearchResult3 SearchResult `json:"searchResult3"`
-	Starred2      Starred      `json:"starred2"`
+	Status        string         `json:"status"`
+	Version       string         `json:"version"`
+	Type          string         `json:"type"`
+	ServerVersion string         `json:"serverVersion"`
+	OpenSubsonic  bool           `json:"openSubsonic"`
+	SearchResult2 SearchResult   `json:"searchResult2"`
+	SearchResult3 SearchResult   `json:"searchResult3"`
+	Starred       *StarredResult `json:"starred,omitempty"`
+	Starred2      *StarredResult `json:"starred2,omitempty"`
+	NowPlaying    *NowPlaying    `json:"nowPlaying,omitempty"`
+	SongOverrides *SongOverrides `json:"songOverrides,omitempty"`
+}
+
+// SongOverrides 是管理接口返回的手动修正
+type SongOverrides struct {
+	Override []SongOverride `json:"override"`
+}
+
+type NowPlaying struct {
+	Entry []NowPlayingEntry `json:"entry"`
+}
+
+type NowPlayingEntry struct {
+	Song
+	Username   string `json:"username"`
+	MinutesAgo int    `json:"minutesAgo"`
+	PlayerName string `json:"playerName,omitempty"`
 }
 
 type Response struct {
@@ -29,41 +52,194 @@ type Response struct {
 }
 
 type SearchResult struct {
-	Artist interface{}
-	Album  interface{}
-	Song   []Song `json:"song"`
+	Artist []Artist `json:"artist"`
+	Album  []Album  `json:"album"`
+	Song   []Song   `json:"song"`
 }
 
-type Starred = SearchResult
+// StarredResult 是 getStarred/getStarred2 的结果
+type StarredResult struct {
+	Artist []Artist `json:"artist"`
+	Album  []Album  `json:"album"`
+	Song   []Song   `json:"song"`
+}
+
+type Artist struct {
+	ID            string  `json:"id"`
+	Name          string  `json:"name"`
+	CoverArt      string  `json:"coverArt,omitempty"`
+	AlbumCount    int     `json:"albumCount"`
+	Starred       string  `json:"starred,omitempty"`
+	UserRating    int     `json:"userRating,omitempty"`
+	AverageRating float64 `json:"averageRating,omitempty"`
+}
+
+type Album struct {
+	ID            string  `json:"id"`
+	Name          string  `json:"name,omitempty"`
+	Title         string  `json:"title,omitempty"`
+	IsDir         bool    `json:"isDir,omitempty"`
+	Artist        string  `json:"artist"`
+	ArtistID      string  `json:"artistId"`
+	CoverArt      string  `json:"coverArt,omitempty"`
+	SongCount     int     `json:"songCount"`
+	Starred       string  `json:"starred,omitempty"`
+	UserRating    int     `json:"userRating,omitempty"`
+	AverageRating float64 `json:"averageRating,omitempty"`
+}
 
 type Song struct {
-	ID          string `json:"id"`
-	IsDir       bool   `json:"isDir"`
-	Title       string `json:"title"`
-	Artist      string `json:"artist"`
-	CoverArt    string `json:"coverArt"`
-	ContentType string `json:"contentType"`
-	Suffix      string `json:"suffix"`
-	Duration    int    `json:"duration"`
-	ArtistID    string `json:"artistId"`
-	Type        string `json:"type"`
-	IsVideo     bool   `json:"isVideo"`
+	ID            string      `json:"id"`
+	IsDir         bool        `json:"isDir"`
+	Title         string      `json:"title"`
+	Artist        string      `json:"artist"`
+	CoverArt      string      `json:"coverArt"`
+	ContentType   string      `json:"contentType"`
+	Suffix        string      `json:"suffix"`
+	Duration      int         `json:"duration"`
+	ArtistID      string      `json:"artistId"`
+	Type          string      `json:"type"`
+	IsVideo       bool        `json:"isVideo"`
+	Starred       string      `json:"starred,omitempty"`
+	PlayCount     int         `json:"playCount,omitempty"`
+	Played        string      `json:"played,omitempty"`
+	UserRating    int         `json:"userRating,omitempty"`
+	AverageRating float64     `json:"averageRating,omitempty"`
+	Genre         string      `json:"genre,omitempty"`
+	Genres        []ItemGenre `json:"genres,omitempty"`
+	DisplayArtist string      `json:"displayArtist,omitempty"`
+	Album         string      `json:"album,omitempty"`
+	Track         int         `json:"track,omitempty"`
+	DiscNumber    int         `json:"discNumber,omitempty"`
+	Year          int         `json:"year,omitempty"`
+	Created       string      `json:"created,omitempty"`
+	Size          int64       `json:"size,omitempty"`
+	BitRate       int         `json:"bitRate,omitempty"`
+	// bilibili 上的播放、点赞和收藏数，不是标准字段
+	ViewCount     int `json:"viewCount,omitempty"`
+	LikeCount     int `json:"likeCount,omitempty"`
+	FavoriteCount int `json:"favoriteCount,omitempty"`
+	// Comment 为整理前的视频标题
+	Comment string `json:"comment,omitempty"`
+	// OpenSubsonic 的扩展字段，musicBrainzId 和 explicitStatus 总是为空
+	MediaType      string        `json:"mediaType"`
+	MusicBrainzID  string        `json:"musicBrainzId"`
+	SortName       string        `json:"sortName,omitempty"`
+	ExplicitStatus string        `json:"explicitStatus"`
+	ChannelCount   int           `json:"channelCount,omitempty"`
+	SamplingRate   int           `json:"samplingRate,omitempty"`
+	BitDepth       int           `json:"bitDepth,omitempty"`
+	Artists        []ArtistRef   `json:"artists,omitempty"`
+	Contributors   []Contributor `json:"contributors,omitempty"`
+	ReplayGain     *ReplayGain   `json:"replayGain,omitempty"`
+}
+
+type ItemGenre struct {
+	Name string `json:"name"`
+}
+
+// ArtistRef 是 OpenSubsonic 歌曲中的歌手，不知道 ID 时为空
+type ArtistRef struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+type Contributor struct {
+	Role   string    `json:"role"`
+	Artist ArtistRef `json:"artist"`
+}
+
+type ReplayGain struct {
+	TrackGain float64 `json:"trackGain"`
+	TrackPeak float64 `json:"trackPeak,omitempty"`
 }
 
 func SongFrom(v *bilibili.BilibiliVideo) Song {
-	return Song{
+	info := songInfoOf(v)
+	song := Song{
 		ID:          v.ID,
 		IsDir:       false,
-		Title:       v.Title,
-		Artist:      v.Author,
-		CoverArt:    v.Pic,
+		Title:       info.Title,
+		Artist:      info.Artist,
+		CoverArt:    info.CoverArt,
 		ContentType: "audio/mpeg",
 		Suffix:      "mp3",
 		Duration:    v.Duration,
-		ArtistID:    v.Author,
+		ArtistID:    artistIDOf(v),
 		Type:        "music",
 		IsVideo:     false,
 	}
+	song.DisplayArtist = info.DisplayArtist
+	song.Album, song.Track, song.DiscNumber, song.Year = info.Album, info.Track, 1, info.Year
+	if !info.Created.IsZero() {
+		song.Created = formatTime(info.Created)
+	}
+	song.Size, song.BitRate = info.Size, info.BitRate
+	song.ViewCount, song.LikeCount, song.FavoriteCount = v.Stat.View, v.Stat.Like, v.Stat.Favorite
+	song.setOpenSubsonic(info)
+	if info.Title != v.Title {
+		song.Comment = v.Title
+	}
+	song.setGenres([]string{info.Genre})
+	return song
+}
+
+// setOpenSubsonic sets the OpenSubsonic extensions of the song.
+func (s *Song) setOpenSubsonic(info songInfo) {
+	s.MediaType, s.SortName = "song", info.SortName
+	for _, a := range info.Artists {
+		s.Artists = append(s.Artists, ArtistRef{ID: a.ID, Name: a.Name})
+	}
+	for _, c := range info.Contributors {
+		s.Contributors = append(s.Contributors, Contributor{Role: c.Role, Artist: ArtistRef{ID: c.Artist.ID, Name: c.Artist.Name}})
+	}
+	if g := info.ReplayGain; g != nil {
+		s.ReplayGain = &ReplayGain{TrackGain: g.TrackGain, TrackPeak: g.TrackPeak}
+	}
+	if st := info.Stream; st != nil {
+		s.ChannelCount, s.SamplingRate, s.BitDepth = st.ChannelCount, st.SamplingRate, st.BitDepth
+		if contentType, suffix, ok := st.fileFormat(); ok {
+			s.ContentType, s.Suffix = contentType, suffix
+		}
+	}
+}
+
+// setGenres sets the genres of the song, ignoring empty names.
+func (s *Song) setGenres(genres []string) {
+	s.Genre, s.Genres = "", nil
+	for _, g := range genres {
+		if g == "" {
+			continue
+		}
+		if s.Genre == "" {
+			s.Genre = g
+		}
+		s.Genres = append(s.Genres, ItemGenre{Name: g})
+	}
+}
+
+// annotateSongs 填充歌曲中与当前用户相关的本地数据，以及缓存的标签流派
+func annotateSongs(c *gin.Context, songs []Song) {
+	user := currentUser(c)
+	tagGenres := configFrom(c).Genres.Tags
+	for i := range songs {
+		if len(tagGenres) > 0 {
+			if m, ok, _ := repo.SongMeta(songs[i].ID); ok {
+				songs[i].setGenres(songGenres(&m, tagGenres))
+			}
+		}
+		songs[i].UserRating, songs[i].AverageRating = ratingsOf(user, songs[i].ID)
+		if pc := playCountOf(songs[i].ID); pc.Count > 0 {
+			songs[i].PlayCount = pc.Count
+			songs[i].Played = formatTime(pc.LastPlayed)
+		}
+	}
+}
+
+// formatTime formats t for responses in UTC, so that they do not depend on
+// the time zone of the server.
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
 }
 
 func createSubsonicOkResponse() Response {
@@ -79,11 +255,38 @@ func createSubsonicOkResponse() Response {
 
 }
 
+type SubsonicError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type ErrorResponse struct {
+	SubsonicResponse struct {
+		Status  string        `json:"status"`
+		Version string        `json:"version"`
+		Error   SubsonicError `json:"error"`
+	} `json:"subsonic-response"`
+}
+
+func createSubsonicErrorResponse(code int, message string) ErrorResponse {
+	var res ErrorResponse
+	res.SubsonicResponse.Status = "failed"
+	res.SubsonicResponse.Version = VERSION
+	res.SubsonicResponse.Error = SubsonicError{Code: code, Message: message}
+	return res
+}
+
+// currentUser 返回发起请求的用户名
+func currentUser(c *gin.Context) string {
+	return c.Query("u")
+}
+
 func checkAuth(r *http.Request) bool {
 	user := r.URL.Query().Get("u")
 	pass := r.URL.Query().Get("p")
 	// TODO: 实现更复杂的 token/md5 验证
-	return user == "voyage" && pass == "141592"
+	u, err := repo.User(user)
+	return err == nil && u.Password == pass
 }
 
 func PingHandler(c *gin.Context) {
@@ -93,35 +296,133 @@ func PingHandler(c *gin.Context) {
 
 }
 
+func scrobbleHandler(c *gin.Context) {
+	log.Println("scrobble invoke")
+	req, err := parseScrobble(c)
+	if err == errMissingScrobbleID {
+		c.JSON(http.StatusOK, createSubsonicErrorResponse(10, "Required parameter is missing."))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, createSubsonicErrorResponse(0, err.Error()))
+		return
+	}
+	if err := recordScrobble(req); err != nil {
+		log.Println("scrobble error:", err)
+		c.JSON(http.StatusInternalServerError, createSubsonicErrorResponse(0, err.Error()))
+		return
+	}
+	client0, _ := c.Get("client")
+	client, _ := client0.(*bilibili.BilibiliClient)
+	forwardScrobbleAsync(client, configFrom(c).Metadata.Concurrency, scrobbleSinksFrom(c), req)
+	c.JSON(http.StatusOK, createSubsonicOkResponse())
+}
+
+func nowPlayingHandler(c *gin.Context) {
+	log.Println("getNowPlaying invoke")
+	client0, _ := c.Get("client")
+	client, _ := client0.(*bilibili.BilibiliClient)
+
+	entries := nowPlaying.List()
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	metas := lookupSongMetas(client, ids, configFrom(c).Metadata.Concurrency)
+
+	songs := make([]Song, 0, len(metas))
+	for _, m := range metas {
+		songs = append(songs, SongFromMeta(&m))
+	}
+	annotateSongs(c, songs)
+
+	result := &NowPlaying{Entry: []NowPlayingEntry{}}
+	for i, e := range entries {
+		result.Entry = append(result.Entry, NowPlayingEntry{
+			Song:       songs[i],
+			Username:   e.User,
+			MinutesAgo: int(time.Since(e.Since).Minutes()),
+			PlayerName: e.Client,
+		})
+	}
+
+	res := createSubsonicOkResponse()
+	res.SubsonicResponse.NowPlaying = result
+	c.JSON(http.StatusOK, res)
+}
+
 func Search2Handler(c *gin.Context) {
 	log.Println("search2API invoke")
-	res := createSubsonicOkResponse()
-	res.SubsonicResponse.SearchResult2 = SearchResult{
-		Artist: []interface{}{},
-		Album:  []interface{}{},
-		Song:   []Song{},
+	result, ok := searchResultJSON(c, false)
+	if !ok {
+		return
 	}
+	res := createSubsonicOkResponse()
+	res.SubsonicResponse.SearchResult2 = result
 	c.JSON(http.StatusOK, res)
 }
 
 func Search3Handler(c *gin.Context) {
 	log.Println("search3 invoke")
+	result, ok := searchResultJSON(c, true)
+	if !ok {
+		return
+	}
+	res := createSubsonicOkResponse()
+	res.SubsonicResponse.SearchResult3 = result
+	c.JSON(http.StatusOK, res)
+}
+
+// searchResultJSON 是 searchResultXML 的 JSON 版本
+func searchResultJSON(c *gin.Context, id3 bool) (SearchResult, bool) {
 	client0, _ := c.Get("client")
 	client, _ := client0.(*bilibili.BilibiliClient)
-	q := c.Query("query")
 
-	videos, _ := client.Search(q)
-	songs := []Song{}
-	for _, item := range videos {
-		songs = append(songs, SongFrom(&item))
+	q, err := searchQueryFrom(c)
+	if err != nil {
+		c.JSON(http.StatusOK, createSubsonicErrorResponse(0, err.Error()))
+		return SearchResult{}, false
 	}
-
-	res := createSubsonicOkResponse()
-	res.SubsonicResponse.SearchResult3 = SearchResult{
-		Song: songs,
+	result, err := search(client, configFrom(c).Metadata.Concurrency, q)
+	if err != nil {
+		log.Println("search error:", err)
+		c.JSON(http.StatusInternalServerError, createSubsonicErrorResponse(50, err.Error()))
+		return SearchResult{}, false
 	}
 
-	c.JSON(http.StatusOK, res)
+	user := currentUser(c)
+	res := SearchResult{Artist: []Artist{}, Album: []Album{}, Song: []Song{}}
+	for _, u := range result.Artists {
+		artist := Artist{
+			ID:       artistIDPrefix + strconv.Itoa(u.MID),
+			Name:     u.Name,
+			CoverArt: u.Face,
+		}
+		artist.UserRating, artist.AverageRating = ratingsOf(user, artist.ID)
+		res.Artist = append(res.Artist, artist)
+	}
+	for _, s := range result.Albums {
+		album := Album{
+			ID:        albumIDOf(&s),
+			Artist:    s.Author,
+			ArtistID:  artistIDPrefix + strconv.Itoa(s.MID),
+			CoverArt:  s.Cover,
+			SongCount: s.Total,
+		}
+		album.UserRating, album.AverageRating = ratingsOf(user, album.ID)
+		if id3 {
+			album.Name = s.Name
+		} else {
+			album.Title = s.Name
+			album.IsDir = true
+		}
+		res.Album = append(res.Album, album)
+	}
+	for _, m := range result.Songs {
+		res.Song = append(res.Song, SongFromMeta(&m))
+	}
+	annotateSongs(c, res.Song)
+	return res, true
 }
 
 func getCoverArtHandler(c *gin.Context) {
@@ -183,7 +484,7 @@ func streamHandler(c *gin.Context) {
 	id := c.Query("id")
 	log.Println(id)
 
-	file, contentLength, err := client.GetAudioStream(id)
+	file, contentLength, err := openSongStream(client, id)
 	if err != nil {
 		log.Fatal(err.Error())
 	}
@@ -204,13 +505,208 @@ func streamHandler(c *gin.Context) {
 	})
 }
 
+// SongFromMeta 从缓存的元数据转成 Song，已失效的视频在标题前标注
+func SongFromMeta(m *SongMeta) Song {
+	song := SongFrom(&m.BilibiliVideo)
+	if m.Unavailable {
+		song.Title = "[已失效] " + song.Title
+	}
+	return song
+}
+
 func starredHandler(c *gin.Context) {
 	log.Println("starred invoke")
+	starred, ok := starredJSON(c, false)
+	if !ok {
+		return
+	}
+	res := createSubsonicOkResponse()
+	res.SubsonicResponse.Starred = starred
+	c.JSON(http.StatusOK, res)
+}
 
+func starred2Handler(c *gin.Context) {
+	log.Println("starred2 invoke")
+	starred, ok := starredJSON(c, true)
+	if !ok {
+		return
+	}
 	res := createSubsonicOkResponse()
-	res.SubsonicResponse.Starred2 = Starred{
-		Song: []Song{},
+	res.SubsonicResponse.Starred2 = starred
+	c.JSON(http.StatusOK, res)
+}
+
+// starredJSON 构造 starred/starred2 的内容，id3 为 false 时专辑按 1.x 的目录格式输出
+func starredJSON(c *gin.Context, id3 bool) (*StarredResult, bool) {
+	client0, _ := c.Get("client")
+	client, _ := client0.(*bilibili.BilibiliClient)
+
+	result, err := loadStarred(client, configFrom(c).Metadata.Concurrency)
+	if err != nil {
+		log.Println("get starred error:", err)
+		c.JSON(http.StatusInternalServerError, createSubsonicErrorResponse(0, err.Error()))
+		return nil, false
+	}
+
+	user := currentUser(c)
+	starred := &StarredResult{Artist: []Artist{}, Album: []Album{}, Song: []Song{}}
+	for _, a := range result.Artists {
+		artist := Artist{
+			ID:       a.ID,
+			Name:     a.Name,
+			CoverArt: a.CoverArt,
+			Starred:  formatTime(a.Starred),
+		}
+		artist.UserRating, artist.AverageRating = ratingsOf(user, a.ID)
+		starred.Artist = append(starred.Artist, artist)
+	}
+	for _, a := range result.Albums {
+		album := Album{
+			ID:        a.ID,
+			Artist:    a.Artist,
+			ArtistID:  a.ArtistID,
+			CoverArt:  a.CoverArt,
+			SongCount: a.SongCount,
+			Starred:   formatTime(a.Starred),
+		}
+		album.UserRating, album.AverageRating = ratingsOf(user, a.ID)
+		if id3 {
+			album.Name = a.Name
+		} else {
+			album.Title = a.Name
+			album.IsDir = true
+		}
+		starred.Album = append(starred.Album, album)
+	}
+	for _, s := range result.Songs {
+		song := SongFromMeta(&s.SongMeta)
+		song.Starred = formatTime(s.Starred)
+		starred.Song = append(starred.Song, song)
+	}
+	annotateSongs(c, starred.Song)
+	return starred, true
+}
+
+// requireAdmin 检查请求的用户是否为管理员，不是时返回错误
+func requireAdmin(c *gin.Context) bool {
+	if checkAuth(c.Request) {
+		if u, err := repo.User(currentUser(c)); err == nil && u.Admin {
+			return true
+		}
 	}
+	c.JSON(http.StatusForbidden, createSubsonicErrorResponse(50, "User is not authorized for the given operation."))
+	return false
+}
 
+// songOverridesResponse 返回包含 overrides 的成功响应
+func songOverridesResponse(c *gin.Context, overrides []SongOverride) {
+	res := createSubsonicOkResponse()
+	res.SubsonicResponse.SongOverrides = &SongOverrides{Override: []SongOverride{}}
+	res.SubsonicResponse.SongOverrides.Override = append(res.SubsonicResponse.SongOverrides.Override, overrides...)
 	c.JSON(http.StatusOK, res)
 }
+
+// getSongOverrides.view，管理员查看手动修正，id 为空时返回全部
+func getSongOverridesHandler(c *gin.Context) {
+	log.Println("getSongOverrides invoke")
+	if !requireAdmin(c) {
+		return
+	}
+
+	var overrides []SongOverride
+	var err error
+	if id := c.Query("id"); id != "" {
+		var o SongOverride
+		var ok bool
+		if o, ok, err = repo.SongOverride(id); ok {
+			overrides = append(overrides, o)
+		}
+	} else {
+		overrides, err = repo.SongOverrides()
+	}
+	if err != nil {
+		log.Println("get song overrides error:", err)
+		c.JSON(http.StatusInternalServerError, createSubsonicErrorResponse(0, err.Error()))
+		return
+	}
+	songOverridesResponse(c, overrides)
+}
+
+// setSongOverride.view，管理员设置一首歌的修正，请求体为 JSON，替换原来的修正
+func setSongOverrideHandler(c *gin.Context) {
+	log.Println("setSongOverride invoke")
+	if !requireAdmin(c) {
+		return
+	}
+
+	var o SongOverride
+	if err := json.NewDecoder(c.Request.Body).Decode(&o); err != nil {
+		c.JSON(http.StatusOK, createSubsonicErrorResponse(0, "Invalid override: "+err.Error()))
+		return
+	}
+	if o.ID == "" {
+		c.JSON(http.StatusOK, createSubsonicErrorResponse(10, "Required parameter is missing: id"))
+		return
+	}
+	if err := o.validate(); err != nil {
+		c.JSON(http.StatusOK, createSubsonicErrorResponse(0, "Invalid override: "+err.Error()))
+		return
+	}
+	o.Updated = time.Now()
+	if err := repo.SaveSongOverrides(o); err != nil {
+		log.Println("save song override error:", err)
+		c.JSON(http.StatusInternalServerError, createSubsonicErrorResponse(0, err.Error()))
+		return
+	}
+	songOverridesResponse(c, []SongOverride{o})
+}
+
+// deleteSongOverride.view，管理员清除一首歌的修正
+func deleteSongOverrideHandler(c *gin.Context) {
+	log.Println("deleteSongOverride invoke")
+	if !requireAdmin(c) {
+		return
+	}
+	id := c.Query("id")
+	if id == "" {
+		c.JSON(http.StatusOK, createSubsonicErrorResponse(10, "Required parameter is missing: id"))
+		return
+	}
+	if err := repo.DeleteSongOverride(id); err != nil {
+		log.Println("delete song override error:", err)
+		c.JSON(http.StatusInternalServerError, createSubsonicErrorResponse(0, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, createSubsonicOkResponse())
+}
+
+// importSongOverrides.view，管理员从 CSV 批量导入修正，内容为请求体或表单文件 file；
+// 任何一行有错误时都不导入
+func importSongOverridesHandler(c *gin.Context) {
+	log.Println("importSongOverrides invoke")
+	if !requireAdmin(c) {
+		return
+	}
+
+	var body io.Reader = c.Request.Body
+	if file, err := c.FormFile("file"); err == nil {
+		var f multipart.File
+		if f, err = file.Open(); err != nil {
+			c.JSON(http.StatusOK, createSubsonicErrorResponse(0, err.Error()))
+			return
+		}
+		defer f.Close()
+		body = f
+	}
+	overrides, err := parseOverridesCSV(body)
+	if err != nil {
+		c.JSON(http.StatusOK, createSubsonicErrorResponse(0, "Invalid CSV: "+err.Error()))
+		return
+	}
+	if err := repo.SaveSongOverrides(overrides...); err != nil {
+		log.Println("import song overrides error:", err)
+		c.JSON(http.StatusInternalServerError, createSubsonicErrorResponse(0, err.Error()))
+		return
+	}
+	songOverridesResponse(c, overrides)
+}
@@ -4,8 +4,11 @@ import (
 	"encoding/xml"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"example/subsonic/bilibili"
 
@@ -25,10 +28,23 @@ type SubsonicResponseXML struct {
 	SearchResult2 *SearchResultXML  `xml:"searchResult2,omitempty"`
 	SearchResult3 *SearchResultXML  `xml:"searchResult3,omitempty"`
 	Song          *SongXML          `xml:"song,omitempty"`
-	Starred2      *SearchResultXML  `xml:"starred2,omitempty"`
+	Starred       *StarredXML       `xml:"starred,omitempty"`
+	Starred2      *StarredXML       `xml:"starred2,omitempty"`
 	AlbumList2    *AlbumList2XML    `xml:"albumList2,omitempty"`
 	Playlists     *PlaylistsXML     `xml:"playlists,omitempty"`
 	Playlist      *PlaylistXML      `xml:"playlist,omitempty"`
+	NowPlaying    *NowPlayingXML    `xml:"nowPlaying,omitempty"`
+	PlayQueue     *PlayQueueXML     `xml:"playQueue,omitempty"`
+	Bookmarks     *BookmarksXML     `xml:"bookmarks,omitempty"`
+	Lyrics        *LyricsXML        `xml:"lyrics,omitempty"`
+	LyricsList    *LyricsListXML    `xml:"lyricsList,omitempty"`
+	SimilarSongs  *SimilarSongsXML  `xml:"similarSongs,omitempty"`
+	SimilarSongs2 *SimilarSongsXML  `xml:"similarSongs2,omitempty"`
+	TopSongs      *TopSongsXML      `xml:"topSongs,omitempty"`
+	RandomSongs   *RandomSongsXML   `xml:"randomSongs,omitempty"`
+	MusicFolders  *MusicFoldersXML  `xml:"musicFolders,omitempty"`
+	Genres        *GenresXML        `xml:"genres,omitempty"`
+	SongsByGenre  *SongsByGenreXML  `xml:"songsByGenre,omitempty"`
 	Error         *SubsonicErrorXML `xml:"error,omitempty"`
 }
 
@@ -37,14 +53,39 @@ type AlbumList2XML struct {
 }
 
 type AlbumXML struct {
-	ID         string `xml:"id,attr"`
-	Name       string `xml:"name,attr"`
-	Artist     string `xml:"artist,attr"`
-	ArtistID   string `xml:"artistId,attr"`
-	CoverArt   string `xml:"coverArt,attr"`
-	SongCount  int    `xml:"songCount,attr"`
-	Duration   int    `xml:"duration,attr"`
-	Created    string `xml:"created,attr"`
+	ID        string `xml:"id,attr"`
+	Name      string `xml:"name,attr,omitempty"`
+	Title     string `xml:"title,attr,omitempty"`
+	IsDir     bool   `xml:"isDir,attr,omitempty"`
+	Artist    string `xml:"artist,attr"`
+	ArtistID  string `xml:"artistId,attr"`
+	CoverArt  string `xml:"coverArt,attr"`
+	SongCount int    `xml:"songCount,attr"`
+	Duration  int    `xml:"duration,attr"`
+	Created   string `xml:"created,attr,omitempty"`
+	Starred   string `xml:"starred,attr,omitempty"`
+	// 评分
+	UserRating    int     `xml:"userRating,attr,omitempty"`
+	AverageRating float64 `xml:"averageRating,attr,omitempty"`
+}
+
+type ArtistXML struct {
+	ID             string `xml:"id,attr"`
+	Name           string `xml:"name,attr"`
+	CoverArt       string `xml:"coverArt,attr,omitempty"`
+	ArtistImageURL string `xml:"artistImageUrl,attr,omitempty"`
+	AlbumCount     int    `xml:"albumCount,attr"`
+	Starred        string `xml:"starred,attr,omitempty"`
+	// 评分
+	UserRating    int     `xml:"userRating,attr,omitempty"`
+	AverageRating float64 `xml:"averageRating,attr,omitempty"`
+}
+
+// StarredXML 是 getStarred/getStarred2 的结果
+type StarredXML struct {
+	Artist []ArtistXML `xml:"artist,omitempty"`
+	Album  []AlbumXML  `xml:"album,omitempty"`
+	Song   []SongXML   `xml:"song,omitempty"`
 }
 
 type PlaylistsXML struct {
@@ -52,15 +93,16 @@ type PlaylistsXML struct {
 }
 
 type PlaylistXML struct {
-	ID        string `xml:"id,attr"`
-	Name      string `xml:"name,attr"`
-	SongCount int    `xml:"songCount,attr"`
-	Duration  int    `xml:"duration,attr"`
-	Public    bool   `xml:"public,attr"`
-	Owner     string `xml:"owner,attr"`
-	Created   string `xml:"created,attr"`
-	Changed   string `xml:"changed,attr"`
-	CoverArt  string `xml:"coverArt,attr"`
+	ID        string    `xml:"id,attr"`
+	Name      string    `xml:"name,attr"`
+	Comment   string    `xml:"comment,attr,omitempty"`
+	SongCount int       `xml:"songCount,attr"`
+	Duration  int       `xml:"duration,attr"`
+	Public    bool      `xml:"public,attr"`
+	Owner     string    `xml:"owner,attr"`
+	Created   string    `xml:"created,attr"`
+	Changed   string    `xml:"changed,attr"`
+	CoverArt  string    `xml:"coverArt,attr"`
 	Entry     []SongXML `xml:"entry,omitempty"`
 }
 
@@ -74,9 +116,9 @@ type PingXML struct {
 }
 
 type SearchResultXML struct {
-	Artist []interface{} `xml:"artist,omitempty"`
-	Album  []interface{} `xml:"album,omitempty"`
-	Song   []SongXML     `xml:"song,omitempty"`
+	Artist []ArtistXML `xml:"artist,omitempty"`
+	Album  []AlbumXML  `xml:"album,omitempty"`
+	Song   []SongXML   `xml:"song,omitempty"`
 }
 
 type SongXML struct {
@@ -91,23 +133,260 @@ type SongXML struct {
 	ArtistID    string `xml:"artistId,attr,omitempty"`
 	Type        string `xml:"type,attr,omitempty"`
 	IsVideo     bool   `xml:"isVideo,attr,omitempty"`
+	Starred     string `xml:"starred,attr,omitempty"`
+	// 播放记录
+	PlayCount int    `xml:"playCount,attr,omitempty"`
+	Played    string `xml:"played,attr,omitempty"`
+	// 评分
+	UserRating    int     `xml:"userRating,attr,omitempty"`
+	AverageRating float64 `xml:"averageRating,attr,omitempty"`
+	// Genre 为第一个流派，Genres 为 OpenSubsonic 的所有流派
+	Genre  string         `xml:"genre,attr,omitempty"`
+	Genres []ItemGenreXML `xml:"genres,omitempty"`
+	// DisplayArtist 为完整的歌手署名，Comment 为整理前的视频标题
+	DisplayArtist string `xml:"displayArtist,attr,omitempty"`
+	Comment       string `xml:"comment,attr,omitempty"`
+	Album         string `xml:"album,attr,omitempty"`
+	Track         int    `xml:"track,attr,omitempty"`
+	DiscNumber    int    `xml:"discNumber,attr,omitempty"`
+	Year          int    `xml:"year,attr,omitempty"`
+	Created       string `xml:"created,attr,omitempty"`
+	Size          int64  `xml:"size,attr,omitempty"`
+	BitRate       int    `xml:"bitRate,attr,omitempty"`
+	// bilibili 上的播放、点赞和收藏数，不是标准字段
+	ViewCount     int `xml:"viewCount,attr,omitempty"`
+	LikeCount     int `xml:"likeCount,attr,omitempty"`
+	FavoriteCount int `xml:"favoriteCount,attr,omitempty"`
+	// OpenSubsonic 的扩展字段，musicBrainzId 和 explicitStatus 总是为空
+	MediaType      string           `xml:"mediaType,attr,omitempty"`
+	MusicBrainzID  string           `xml:"musicBrainzId,attr"`
+	SortName       string           `xml:"sortName,attr,omitempty"`
+	ExplicitStatus string           `xml:"explicitStatus,attr"`
+	ChannelCount   int              `xml:"channelCount,attr,omitempty"`
+	SamplingRate   int              `xml:"samplingRate,attr,omitempty"`
+	BitDepth       int              `xml:"bitDepth,attr,omitempty"`
+	Artists        []ArtistRefXML   `xml:"artists"`
+	Contributors   []ContributorXML `xml:"contributors"`
+	ReplayGain     *ReplayGainXML   `xml:"replayGain"`
+}
+
+type ItemGenreXML struct {
+	Name string `xml:"name,attr"`
+}
+
+// ArtistRefXML 是 OpenSubsonic 歌曲中的歌手，不知道 ID 时为空
+type ArtistRefXML struct {
+	ID   string `xml:"id,attr,omitempty"`
+	Name string `xml:"name,attr"`
+}
+
+type ContributorXML struct {
+	Role   string       `xml:"role,attr"`
+	Artist ArtistRefXML `xml:"artist"`
+}
+
+type ReplayGainXML struct {
+	TrackGain float64 `xml:"trackGain,attr"`
+	TrackPeak float64 `xml:"trackPeak,attr,omitempty"`
+}
+
+type NowPlayingXML struct {
+	Entry []NowPlayingEntryXML `xml:"entry"`
+}
+
+// NowPlayingEntryXML 是带播放者信息的歌曲
+type NowPlayingEntryXML struct {
+	SongXML
+	Username   string `xml:"username,attr"`
+	MinutesAgo int    `xml:"minutesAgo,attr"`
+	PlayerName string `xml:"playerName,attr,omitempty"`
+}
+
+type PlayQueueXML struct {
+	Current   string    `xml:"current,attr,omitempty"`
+	Position  int64     `xml:"position,attr"`
+	Username  string    `xml:"username,attr"`
+	Changed   string    `xml:"changed,attr"`
+	ChangedBy string    `xml:"changedBy,attr"`
+	Entry     []SongXML `xml:"entry"`
+}
+
+type BookmarksXML struct {
+	Bookmark []BookmarkXML `xml:"bookmark"`
+}
+
+type BookmarkXML struct {
+	Position int64   `xml:"position,attr"`
+	Username string  `xml:"username,attr"`
+	Comment  string  `xml:"comment,attr,omitempty"`
+	Created  string  `xml:"created,attr"`
+	Changed  string  `xml:"changed,attr"`
+	Entry    SongXML `xml:"entry"`
+}
+
+type SimilarSongsXML struct {
+	Song []SongXML `xml:"song"`
+}
+
+type TopSongsXML struct {
+	Song []SongXML `xml:"song"`
+}
+
+type RandomSongsXML struct {
+	Song []SongXML `xml:"song"`
+}
+
+type GenresXML struct {
+	Genre []GenreXML `xml:"genre"`
+}
+
+type GenreXML struct {
+	SongCount  int    `xml:"songCount,attr"`
+	AlbumCount int    `xml:"albumCount,attr"`
+	Value      string `xml:",chardata"`
+}
+
+type SongsByGenreXML struct {
+	Song []SongXML `xml:"song"`
+}
+
+type MusicFoldersXML struct {
+	MusicFolder []MusicFolderXML `xml:"musicFolder"`
+}
+
+type MusicFolderXML struct {
+	ID   string `xml:"id,attr"`
+	Name string `xml:"name,attr"`
+}
+
+type LyricsXML struct {
+	Artist string `xml:"artist,attr,omitempty"`
+	Title  string `xml:"title,attr,omitempty"`
+	Value  string `xml:",chardata"`
+}
+
+type LyricsListXML struct {
+	StructuredLyrics []StructuredLyricsXML `xml:"structuredLyrics"`
+}
+
+// StructuredLyricsXML 是 OpenSubsonic 的结构化歌词
+type StructuredLyricsXML struct {
+	DisplayArtist string         `xml:"displayArtist,attr,omitempty"`
+	DisplayTitle  string         `xml:"displayTitle,attr,omitempty"`
+	Lang          string         `xml:"lang,attr"`
+	Offset        int            `xml:"offset,attr"`
+	Synced        bool           `xml:"synced,attr"`
+	Line          []LyricLineXML `xml:"line"`
+}
+
+type LyricLineXML struct {
+	Start *int64 `xml:"start,attr,omitempty"`
+	Value string `xml:",chardata"`
 }
 
 // 从 bilibili.BilibiliVideo 转成 SongXML
 func SongFromXML(v *bilibili.BilibiliVideo) SongXML {
-	return SongXML{
+	info := songInfoOf(v)
+	song := SongXML{
 		ID:          v.ID,
 		IsDir:       false,
-		Title:       v.Title,
-		Artist:      v.Author,
-		CoverArt:    v.Pic,
+		Title:       info.Title,
+		Artist:      info.Artist,
+		CoverArt:    info.CoverArt,
 		ContentType: "audio/mpeg",
 		Suffix:      "mp3",
 		Duration:    v.Duration,
-		ArtistID:    v.Author,
+		ArtistID:    artistIDOf(v),
 		Type:        "music",
 		IsVideo:     false,
 	}
+	song.DisplayArtist = info.DisplayArtist
+	song.Album, song.Track, song.DiscNumber, song.Year = info.Album, info.Track, 1, info.Year
+	if !info.Created.IsZero() {
+		song.Created = formatTime(info.Created)
+	}
+	song.Size, song.BitRate = info.Size, info.BitRate
+	song.ViewCount, song.LikeCount, song.FavoriteCount = v.Stat.View, v.Stat.Like, v.Stat.Favorite
+	song.setOpenSubsonic(info)
+	if info.Title != v.Title {
+		song.Comment = v.Title
+	}
+	song.setGenres([]string{info.Genre})
+	return song
+}
+
+// setOpenSubsonic sets the OpenSubsonic extensions of the song.
+func (s *SongXML) setOpenSubsonic(info songInfo) {
+	s.MediaType, s.SortName = "song", info.SortName
+	for _, a := range info.Artists {
+		s.Artists = append(s.Artists, ArtistRefXML{ID: a.ID, Name: a.Name})
+	}
+	for _, c := range info.Contributors {
+		s.Contributors = append(s.Contributors, ContributorXML{Role: c.Role, Artist: ArtistRefXML{ID: c.Artist.ID, Name: c.Artist.Name}})
+	}
+	if g := info.ReplayGain; g != nil {
+		s.ReplayGain = &ReplayGainXML{TrackGain: g.TrackGain, TrackPeak: g.TrackPeak}
+	}
+	if st := info.Stream; st != nil {
+		s.ChannelCount, s.SamplingRate, s.BitDepth = st.ChannelCount, st.SamplingRate, st.BitDepth
+		if contentType, suffix, ok := st.fileFormat(); ok {
+			s.ContentType, s.Suffix = contentType, suffix
+		}
+	}
+}
+
+// setGenres sets the genres of the song, ignoring empty names.
+func (s *SongXML) setGenres(genres []string) {
+	s.Genre, s.Genres = "", nil
+	for _, g := range genres {
+		if g == "" {
+			continue
+		}
+		if s.Genre == "" {
+			s.Genre = g
+		}
+		s.Genres = append(s.Genres, ItemGenreXML{Name: g})
+	}
+}
+
+// 从缓存的元数据转成 SongXML，已失效的视频在标题前标注
+func SongFromMetaXML(m *SongMeta) SongXML {
+	song := SongFromXML(&m.BilibiliVideo)
+	if m.Unavailable {
+		song.Title = "[已失效] " + song.Title
+	}
+	return song
+}
+
+// annotateSongsXML 填充歌曲中与当前用户相关的本地数据，以及缓存的标签流派
+func annotateSongsXML(c *gin.Context, songs []SongXML) {
+	user := currentUser(c)
+	tagGenres := configFrom(c).Genres.Tags
+	for i := range songs {
+		if len(tagGenres) > 0 {
+			if m, ok, _ := repo.SongMeta(songs[i].ID); ok {
+				songs[i].setGenres(songGenres(&m, tagGenres))
+			}
+		}
+		songs[i].UserRating, songs[i].AverageRating = ratingsOf(user, songs[i].ID)
+		if pc := playCountOf(songs[i].ID); pc.Count > 0 {
+			songs[i].PlayCount = pc.Count
+			songs[i].Played = formatTime(pc.LastPlayed)
+		}
+	}
+}
+
+// songsXML 返回 ids 对应的歌曲，使用缓存的元数据
+func songsXML(c *gin.Context, ids []string) []SongXML {
+	cliAny, _ := c.Get("client")
+	client := cliAny.(*bilibili.BilibiliClient)
+
+	songs := make([]SongXML, 0, len(ids))
+	for _, m := range lookupSongMetas(client, ids, configFrom(c).Metadata.Concurrency) {
+		songs = append(songs, SongFromMetaXML(&m))
+	}
+	annotateSongsXML(c, songs)
+	return songs
 }
 
 // 构造一个最顶层的“ok”响应
@@ -123,11 +402,22 @@ func createSubsonicOkResponseXML() SubsonicResponseXML {
 	}
 }
 
-// 简单鉴权：u=voyage, p=141592
+// 构造一个“failed”响应
+func createSubsonicErrorResponseXML(code int, message string) SubsonicResponseXML {
+	return SubsonicResponseXML{
+		Status:  "failed",
+		Version: VERSION,
+		Xmlns:   "http://subsonic.org/restapi",
+		Error: &SubsonicErrorXML{
+			Code:    code,
+			Message: message,
+		},
+	}
+}
+
+// 简单鉴权：用户名密码与数据库中的用户一致
 func authMiddlewareXML(c *gin.Context) {
-	u := c.Query("u")
-	p := c.Query("p")
-	if u != "voyage" || p != "141592" {
+	if !checkAuth(c.Request) {
 		resp := SubsonicResponseXML{
 			Status:  "failed",
 			Version: VERSION,
@@ -152,58 +442,602 @@ func PingHandlerXML(c *gin.Context) {
 	c.XML(http.StatusOK, resp)
 }
 
-// search2.view
-func Search2HandlerXML(c *gin.Context) {
-	log.Println("search2 invoke")
+// scrobble.view
+func ScrobbleHandlerXML(c *gin.Context) {
+	log.Println("scrobble invoke")
+	req, err := parseScrobble(c)
+	if err == errMissingScrobbleID {
+		c.XML(http.StatusOK, createSubsonicErrorResponseXML(10, "Required parameter is missing."))
+		return
+	}
+	if err != nil {
+		c.XML(http.StatusOK, createSubsonicErrorResponseXML(0, err.Error()))
+		return
+	}
+	if err := recordScrobble(req); err != nil {
+		log.Println("scrobble error:", err)
+		c.XML(http.StatusInternalServerError, createSubsonicErrorResponseXML(0, err.Error()))
+		return
+	}
+	cliAny, _ := c.Get("client")
+	forwardScrobbleAsync(cliAny.(*bilibili.BilibiliClient), configFrom(c).Metadata.Concurrency, scrobbleSinksFrom(c), req)
+	c.XML(http.StatusOK, createSubsonicOkResponseXML())
+}
+
+// getNowPlaying.view
+func GetNowPlayingHandlerXML(c *gin.Context) {
+	log.Println("getNowPlaying invoke")
+	entries := nowPlaying.List()
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	songs := songsXML(c, ids)
+
+	result := &NowPlayingXML{Entry: []NowPlayingEntryXML{}}
+	for i, e := range entries {
+		result.Entry = append(result.Entry, NowPlayingEntryXML{
+			SongXML:    songs[i],
+			Username:   e.User,
+			MinutesAgo: int(time.Since(e.Since).Minutes()),
+			PlayerName: e.Client,
+		})
+	}
+
 	resp := createSubsonicOkResponseXML()
-	resp.SearchResult2 = &SearchResultXML{
-		Artist: []interface{}{},
-		Album:  []interface{}{},
-		Song:   []SongXML{},
+	resp.NowPlaying = result
+	c.XML(http.StatusOK, resp)
+}
+
+// savePlayQueue.view
+func SavePlayQueueHandlerXML(c *gin.Context) {
+	log.Println("savePlayQueue invoke")
+	var position int64
+	if p := c.Query("position"); p != "" {
+		var err error
+		if position, err = strconv.ParseInt(p, 10, 64); err != nil {
+			c.XML(http.StatusOK, createSubsonicErrorResponseXML(0, "Invalid position: "+p))
+			return
+		}
+	}
+
+	err := savePlayQueue(currentUser(c), c.Query("c"), c.QueryArray("id"), c.Query("current"), position)
+	if err != nil {
+		log.Println("save play queue error:", err)
+		c.XML(http.StatusOK, createSubsonicErrorResponseXML(0, err.Error()))
+		return
+	}
+	c.XML(http.StatusOK, createSubsonicOkResponseXML())
+}
+
+// getPlayQueue.view
+func GetPlayQueueHandlerXML(c *gin.Context) {
+	log.Println("getPlayQueue invoke")
+	q, ok, err := repo.PlayQueue(currentUser(c))
+	if err != nil {
+		log.Println("get play queue error:", err)
+		c.XML(http.StatusInternalServerError, createSubsonicErrorResponseXML(0, err.Error()))
+		return
+	}
+
+	resp := createSubsonicOkResponseXML()
+	if ok {
+		resp.PlayQueue = &PlayQueueXML{
+			Current:   q.Current,
+			Position:  q.Position,
+			Username:  q.User,
+			Changed:   formatTime(q.Changed),
+			ChangedBy: q.ChangedBy,
+			Entry:     songsXML(c, q.SongIDs),
+		}
 	}
 	c.XML(http.StatusOK, resp)
 }
 
-// search3.view
-func Search3HandlerXML(c *gin.Context) {
-	log.Println("search3 invoke")
+// createBookmark.view
+func CreateBookmarkHandlerXML(c *gin.Context) {
+	log.Println("createBookmark invoke")
+	id, p := c.Query("id"), c.Query("position")
+	if id == "" || p == "" {
+		c.XML(http.StatusOK, createSubsonicErrorResponseXML(10, "Required parameter is missing."))
+		return
+	}
+	position, err := strconv.ParseInt(p, 10, 64)
+	if err != nil {
+		c.XML(http.StatusOK, createSubsonicErrorResponseXML(0, "Invalid position: "+p))
+		return
+	}
+
+	if err := createBookmark(currentUser(c), id, position, c.Query("comment")); err != nil {
+		log.Println("create bookmark error:", err)
+		c.XML(http.StatusInternalServerError, createSubsonicErrorResponseXML(0, err.Error()))
+		return
+	}
+	c.XML(http.StatusOK, createSubsonicOkResponseXML())
+}
+
+// getBookmarks.view
+func GetBookmarksHandlerXML(c *gin.Context) {
+	log.Println("getBookmarks invoke")
+	bookmarks, err := repo.Bookmarks(currentUser(c))
+	if err != nil {
+		log.Println("get bookmarks error:", err)
+		c.XML(http.StatusInternalServerError, createSubsonicErrorResponseXML(0, err.Error()))
+		return
+	}
+
+	ids := make([]string, 0, len(bookmarks))
+	for _, b := range bookmarks {
+		ids = append(ids, b.ID)
+	}
+	songs := songsXML(c, ids)
+
+	result := &BookmarksXML{Bookmark: []BookmarkXML{}}
+	for i, b := range bookmarks {
+		result.Bookmark = append(result.Bookmark, BookmarkXML{
+			Position: b.Position,
+			Username: b.User,
+			Comment:  b.Comment,
+			Created:  formatTime(b.Created),
+			Changed:  formatTime(b.Changed),
+			Entry:    songs[i],
+		})
+	}
+
+	resp := createSubsonicOkResponseXML()
+	resp.Bookmarks = result
+	c.XML(http.StatusOK, resp)
+}
+
+// deleteBookmark.view
+func DeleteBookmarkHandlerXML(c *gin.Context) {
+	log.Println("deleteBookmark invoke")
+	id := c.Query("id")
+	if id == "" {
+		c.XML(http.StatusOK, createSubsonicErrorResponseXML(10, "Required parameter is missing."))
+		return
+	}
+
+	switch err := deleteBookmark(currentUser(c), id); err {
+	case nil:
+		c.XML(http.StatusOK, createSubsonicOkResponseXML())
+	case errBookmarkNotFound:
+		c.XML(http.StatusNotFound, createSubsonicErrorResponseXML(70, err.Error()))
+	default:
+		log.Println("delete bookmark error:", err)
+		c.XML(http.StatusInternalServerError, createSubsonicErrorResponseXML(0, err.Error()))
+	}
+}
+
+// getLyrics.view，按歌手和标题搜索视频，返回偏好语言的纯文本歌词
+func GetLyricsHandlerXML(c *gin.Context) {
+	log.Println("getLyrics invoke")
 	cliAny, _ := c.Get("client")
 	client := cliAny.(*bilibili.BilibiliClient)
-	q := c.Query("query")
+	artist, title := c.Query("artist"), c.Query("title")
+
+	resp := createSubsonicOkResponseXML()
+	resp.Lyrics = &LyricsXML{}
+	keyword := strings.TrimSpace(artist + " " + title)
+	if keyword == "" {
+		c.XML(http.StatusOK, resp)
+		return
+	}
 
-	videos, err := client.Search(q)
+	videos, err := client.Search(keyword)
 	if err != nil {
 		log.Println("search error:", err)
-		resp := SubsonicResponseXML{
-			Status:  "failed",
-			Version: VERSION,
-			Xmlns:   "http://subsonic.org/restapi",
-			Error: &SubsonicErrorXML{
-				Code:    50,
-				Message: err.Error(),
-			},
+		c.XML(http.StatusInternalServerError, createSubsonicErrorResponseXML(0, err.Error()))
+		return
+	}
+	if len(videos) > 0 {
+		lyrics, err := lyricsForSong(client, configFrom(c).Lyrics, SongMeta{BilibiliVideo: videos[0]}, 1, "")
+		if err != nil {
+			log.Println("get lyrics error:", err)
 		}
-		c.XML(http.StatusInternalServerError, resp)
+		if len(lyrics) > 0 {
+			resp.Lyrics = &LyricsXML{Artist: artist, Title: title, Value: lyrics[0].Text()}
+		}
+	}
+	c.XML(http.StatusOK, resp)
+}
+
+// getLyricsBySongId.view，lang 为可选的语言过滤，part 为分 P，都不属于 OpenSubsonic
+func GetLyricsBySongIDHandlerXML(c *gin.Context) {
+	log.Println("getLyricsBySongId invoke")
+	cliAny, _ := c.Get("client")
+	client := cliAny.(*bilibili.BilibiliClient)
+	id := c.Query("id")
+	if id == "" {
+		c.XML(http.StatusOK, createSubsonicErrorResponseXML(10, "Required parameter is missing."))
+		return
+	}
+
+	part, ok := lyricsPart(c)
+	if !ok {
+		return
+	}
+
+	m := lookupSongMetas(client, []string{id}, 1)[0]
+	lyrics, err := lyricsForSong(client, configFrom(c).Lyrics, m, part, c.Query("lang"))
+	if err != nil {
+		log.Println("get lyrics error:", err)
+		c.XML(http.StatusInternalServerError, createSubsonicErrorResponseXML(0, err.Error()))
+		return
+	}
+
+	result := &LyricsListXML{StructuredLyrics: []StructuredLyricsXML{}}
+	for _, l := range lyrics {
+		structured := StructuredLyricsXML{
+			DisplayArtist: l.Artist,
+			DisplayTitle:  l.Title,
+			Lang:          l.Lang,
+			Synced:        l.Synced,
+		}
+		for _, line := range l.Lines {
+			lineXML := LyricLineXML{Value: line.Value}
+			if l.Synced {
+				start := line.Start
+				lineXML.Start = &start
+			}
+			structured.Line = append(structured.Line, lineXML)
+		}
+		result.StructuredLyrics = append(result.StructuredLyrics, structured)
+	}
+
+	resp := createSubsonicOkResponseXML()
+	resp.LyricsList = result
+	c.XML(http.StatusOK, resp)
+}
+
+// requireAdminXML 检查请求的用户是否为管理员，不是时返回错误
+func requireAdminXML(c *gin.Context) bool {
+	if checkAuth(c.Request) {
+		if u, err := repo.User(currentUser(c)); err == nil && u.Admin {
+			return true
+		}
+	}
+	c.XML(http.StatusForbidden, createSubsonicErrorResponseXML(50, "User is not authorized for the given operation."))
+	return false
+}
+
+// lyricsPart 读取歌词对应的分 P，默认为第一个
+func lyricsPart(c *gin.Context) (int, bool) {
+	part, err := strconv.Atoi(c.DefaultQuery("part", "1"))
+	if err != nil || part < 1 {
+		c.XML(http.StatusOK, createSubsonicErrorResponseXML(0, "Invalid part: "+c.Query("part")))
+		return 0, false
+	}
+	return part, true
+}
+
+// uploadLyrics.view，管理员上传 LRC 歌词，内容为请求体或表单文件 file
+func UploadLyricsHandlerXML(c *gin.Context) {
+	log.Println("uploadLyrics invoke")
+	if !requireAdminXML(c) {
+		return
+	}
+	id := c.Query("id")
+	if id == "" {
+		c.XML(http.StatusOK, createSubsonicErrorResponseXML(10, "Required parameter is missing."))
+		return
+	}
+	part, ok := lyricsPart(c)
+	if !ok {
+		return
+	}
+
+	var data []byte
+	var err error
+	if file, ferr := c.FormFile("file"); ferr == nil {
+		var f multipart.File
+		if f, err = file.Open(); err == nil {
+			data, err = io.ReadAll(f)
+			f.Close()
+		}
+	} else {
+		data, err = io.ReadAll(c.Request.Body)
+	}
+	if err == nil {
+		err = saveLocalLyrics(configFrom(c).Lyrics.Directory, id, part, c.Query("lang"), data)
+	}
+	if err != nil {
+		log.Println("upload lyrics error:", err)
+		c.XML(http.StatusOK, createSubsonicErrorResponseXML(0, err.Error()))
 		return
 	}
+	c.XML(http.StatusOK, createSubsonicOkResponseXML())
+}
+
+// getSimilarSongs.view
+func GetSimilarSongsHandlerXML(c *gin.Context) {
+	log.Println("getSimilarSongs invoke")
+	if songs, ok := similarSongsXML(c); ok {
+		resp := createSubsonicOkResponseXML()
+		resp.SimilarSongs = songs
+		c.XML(http.StatusOK, resp)
+	}
+}
+
+// getSimilarSongs2.view
+func GetSimilarSongs2HandlerXML(c *gin.Context) {
+	log.Println("getSimilarSongs2 invoke")
+	if songs, ok := similarSongsXML(c); ok {
+		resp := createSubsonicOkResponseXML()
+		resp.SimilarSongs2 = songs
+		c.XML(http.StatusOK, resp)
+	}
+}
+
+// similarSongsXML 处理 getSimilarSongs/getSimilarSongs2 的 id 和 count 参数
+func similarSongsXML(c *gin.Context) (*SimilarSongsXML, bool) {
+	cliAny, _ := c.Get("client")
+	client := cliAny.(*bilibili.BilibiliClient)
+	id := c.Query("id")
+	if id == "" {
+		c.XML(http.StatusOK, createSubsonicErrorResponseXML(10, "Required parameter is missing."))
+		return nil, false
+	}
+	count, err := strconv.Atoi(c.DefaultQuery("count", "50"))
+	if err != nil || count < 0 {
+		c.XML(http.StatusOK, createSubsonicErrorResponseXML(0, "Invalid count: "+c.Query("count")))
+		return nil, false
+	}
+
+	videos, err := similarSongs(client, id, count)
+	if err != nil {
+		log.Println("get similar songs error:", err)
+		c.XML(http.StatusInternalServerError, createSubsonicErrorResponseXML(0, err.Error()))
+		return nil, false
+	}
 
 	songs := make([]SongXML, 0, len(videos))
 	for _, v := range videos {
 		songs = append(songs, SongFromXML(&v))
 	}
+	annotateSongsXML(c, songs)
+	return &SimilarSongsXML{Song: songs}, true
+}
+
+// getTopSongs.view，artist 为艺术家名称，也可以是艺术家 ID
+func GetTopSongsHandlerXML(c *gin.Context) {
+	log.Println("getTopSongs invoke")
+	cliAny, _ := c.Get("client")
+	client := cliAny.(*bilibili.BilibiliClient)
+	artist := c.Query("artist")
+	if artist == "" {
+		c.XML(http.StatusOK, createSubsonicErrorResponseXML(10, "Required parameter is missing."))
+		return
+	}
+	count, err := strconv.Atoi(c.DefaultQuery("count", "50"))
+	if err != nil || count < 0 {
+		c.XML(http.StatusOK, createSubsonicErrorResponseXML(0, "Invalid count: "+c.Query("count")))
+		return
+	}
+
+	resp := createSubsonicOkResponseXML()
+	resp.TopSongs = &TopSongsXML{Song: []SongXML{}}
+	mid, err := resolveArtist(client, artist)
+	if err == errArtistNotFound {
+		c.XML(http.StatusOK, resp)
+		return
+	}
+	var videos []bilibili.BilibiliVideo
+	if err == nil {
+		videos, err = topSongs(client, mid, count)
+	}
+	if err != nil {
+		log.Println("get top songs error:", err)
+		c.XML(http.StatusInternalServerError, createSubsonicErrorResponseXML(0, err.Error()))
+		return
+	}
+
+	for _, v := range videos {
+		resp.TopSongs.Song = append(resp.TopSongs.Song, SongFromXML(&v))
+	}
+	annotateSongsXML(c, resp.TopSongs.Song)
+	c.XML(http.StatusOK, resp)
+}
+
+// getMusicFolders.view
+func GetMusicFoldersHandlerXML(c *gin.Context) {
+	log.Println("getMusicFolders invoke")
+	resp := createSubsonicOkResponseXML()
+	resp.MusicFolders = &MusicFoldersXML{MusicFolder: []MusicFolderXML{{ID: musicFolderID, Name: musicFolderName}}}
+	c.XML(http.StatusOK, resp)
+}
+
+// getRandomSongs.view
+func GetRandomSongsHandlerXML(c *gin.Context) {
+	log.Println("getRandomSongs invoke")
+	cliAny, _ := c.Get("client")
+	client := cliAny.(*bilibili.BilibiliClient)
+
+	size, err := strconv.Atoi(c.DefaultQuery("size", "10"))
+	if err != nil || size < 0 {
+		c.XML(http.StatusOK, createSubsonicErrorResponseXML(0, "Invalid size: "+c.Query("size")))
+		return
+	}
+	size = min(size, 500)
+	f := randomFilter{Genre: c.Query("genre"), TagGenres: configFrom(c).Genres.Tags}
+	for param, year := range map[string]*int{"fromYear": &f.FromYear, "toYear": &f.ToYear} {
+		if v := c.Query(param); v != "" {
+			if *year, err = strconv.Atoi(v); err != nil {
+				c.XML(http.StatusOK, createSubsonicErrorResponseXML(0, "Invalid "+param+": "+v))
+				return
+			}
+		}
+	}
 
 	resp := createSubsonicOkResponseXML()
-	resp.SearchResult3 = &SearchResultXML{Song: songs}
+	resp.RandomSongs = &RandomSongsXML{Song: []SongXML{}}
+	if folder := c.Query("musicFolderId"); folder != "" && folder != musicFolderID {
+		c.XML(http.StatusOK, resp)
+		return
+	}
+
+	metas, err := randomSongs(client, configFrom(c), size, f)
+	if err != nil {
+		log.Println("get random songs error:", err)
+		c.XML(http.StatusInternalServerError, createSubsonicErrorResponseXML(0, err.Error()))
+		return
+	}
+	for _, m := range metas {
+		resp.RandomSongs.Song = append(resp.RandomSongs.Song, SongFromMetaXML(&m))
+	}
+	annotateSongsXML(c, resp.RandomSongs.Song)
 	c.XML(http.StatusOK, resp)
 }
 
+// getGenres.view
+func GetGenresHandlerXML(c *gin.Context) {
+	log.Println("getGenres invoke")
+	cliAny, _ := c.Get("client")
+	client := cliAny.(*bilibili.BilibiliClient)
+
+	genres, err := libraryGenres(client, configFrom(c))
+	if err != nil {
+		log.Println("get genres error:", err)
+		c.XML(http.StatusInternalServerError, createSubsonicErrorResponseXML(0, err.Error()))
+		return
+	}
+
+	resp := createSubsonicOkResponseXML()
+	resp.Genres = &GenresXML{Genre: []GenreXML{}}
+	for _, g := range genres {
+		resp.Genres.Genre = append(resp.Genres.Genre, GenreXML{SongCount: g.SongCount, Value: g.Name})
+	}
+	c.XML(http.StatusOK, resp)
+}
+
+// getSongsByGenre.view
+func GetSongsByGenreHandlerXML(c *gin.Context) {
+	log.Println("getSongsByGenre invoke")
+	cliAny, _ := c.Get("client")
+	client := cliAny.(*bilibili.BilibiliClient)
+
+	genre := c.Query("genre")
+	if genre == "" {
+		c.XML(http.StatusOK, createSubsonicErrorResponseXML(10, "Required parameter is missing: genre"))
+		return
+	}
+	count, err := strconv.Atoi(c.DefaultQuery("count", "10"))
+	if err != nil || count < 0 {
+		c.XML(http.StatusOK, createSubsonicErrorResponseXML(0, "Invalid count: "+c.Query("count")))
+		return
+	}
+	count = min(count, 500)
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.XML(http.StatusOK, createSubsonicErrorResponseXML(0, "Invalid offset: "+c.Query("offset")))
+		return
+	}
+
+	resp := createSubsonicOkResponseXML()
+	resp.SongsByGenre = &SongsByGenreXML{Song: []SongXML{}}
+	if folder := c.Query("musicFolderId"); folder != "" && folder != musicFolderID {
+		c.XML(http.StatusOK, resp)
+		return
+	}
+
+	metas, err := songsByGenre(client, configFrom(c), genre, offset, count)
+	if err != nil {
+		log.Println("get songs by genre error:", err)
+		c.XML(http.StatusInternalServerError, createSubsonicErrorResponseXML(0, err.Error()))
+		return
+	}
+	for _, m := range metas {
+		resp.SongsByGenre.Song = append(resp.SongsByGenre.Song, SongFromMetaXML(&m))
+	}
+	annotateSongsXML(c, resp.SongsByGenre.Song)
+	c.XML(http.StatusOK, resp)
+}
+
+// search2.view
+func Search2HandlerXML(c *gin.Context) {
+	log.Println("search2 invoke")
+	result, ok := searchResultXML(c, false)
+	if !ok {
+		return
+	}
+	resp := createSubsonicOkResponseXML()
+	resp.SearchResult2 = result
+	c.XML(http.StatusOK, resp)
+}
+
+// search3.view
+func Search3HandlerXML(c *gin.Context) {
+	log.Println("search3 invoke")
+	result, ok := searchResultXML(c, true)
+	if !ok {
+		return
+	}
+	resp := createSubsonicOkResponseXML()
+	resp.SearchResult3 = result
+	c.XML(http.StatusOK, resp)
+}
+
+// searchResultXML runs the search of a search2 or search3 request; search2
+// returns albums as directories.
+func searchResultXML(c *gin.Context, id3 bool) (*SearchResultXML, bool) {
+	cliAny, _ := c.Get("client")
+	client := cliAny.(*bilibili.BilibiliClient)
+
+	q, err := searchQueryFrom(c)
+	if err != nil {
+		c.XML(http.StatusOK, createSubsonicErrorResponseXML(0, err.Error()))
+		return nil, false
+	}
+	result, err := search(client, configFrom(c).Metadata.Concurrency, q)
+	if err != nil {
+		log.Println("search error:", err)
+		c.XML(http.StatusInternalServerError, createSubsonicErrorResponseXML(50, err.Error()))
+		return nil, false
+	}
+
+	user := currentUser(c)
+	res := &SearchResultXML{}
+	for _, u := range result.Artists {
+		artist := ArtistXML{
+			ID:             artistIDPrefix + strconv.Itoa(u.MID),
+			Name:           u.Name,
+			CoverArt:       u.Face,
+			ArtistImageURL: u.Face,
+		}
+		artist.UserRating, artist.AverageRating = ratingsOf(user, artist.ID)
+		res.Artist = append(res.Artist, artist)
+	}
+	for _, s := range result.Albums {
+		album := AlbumXML{
+			ID:        albumIDOf(&s),
+			Artist:    s.Author,
+			ArtistID:  artistIDPrefix + strconv.Itoa(s.MID),
+			CoverArt:  s.Cover,
+			SongCount: s.Total,
+		}
+		album.UserRating, album.AverageRating = ratingsOf(user, album.ID)
+		if id3 {
+			album.Name = s.Name
+		} else {
+			album.Title = s.Name
+			album.IsDir = true
+		}
+		res.Album = append(res.Album, album)
+	}
+	for _, m := range result.Songs {
+		res.Song = append(res.Song, SongFromMetaXML(&m))
+	}
+	annotateSongsXML(c, res.Song)
+	return res, true
+}
+
 func GetSongXML(c *gin.Context) {
 	log.Println("getSong invoke")
 	cliAny, _ := c.Get("client")
 	client := cliAny.(*bilibili.BilibiliClient)
 	id := c.Query("id")
 
-	video, err := client.GetVideoInfo(id)
+	video, err := getSongInfo(client, id)
 	if err != nil {
 		log.Println("search error:", err)
 		resp := SubsonicResponseXML{
@@ -219,93 +1053,169 @@ func GetSongXML(c *gin.Context) {
 		return
 	}
 
-	videoXML := SongFromXML(video)
+	songs := []SongXML{SongFromXML(video)}
+	annotateSongsXML(c, songs)
+
+	resp := createSubsonicOkResponseXML()
+	resp.Song = &songs[0]
+	c.XML(http.StatusOK, resp)
+}
+
+// getStarred.view
+func GetStarredHandlerXML(c *gin.Context) {
+	log.Println("getStarred invoke")
+	starred, ok := starredXML(c, false)
+	if !ok {
+		return
+	}
+	resp := createSubsonicOkResponseXML()
+	resp.Starred = starred
+	c.XML(http.StatusOK, resp)
+}
 
+// getStarred2.view
+func GetStarred2HandlerXML(c *gin.Context) {
+	log.Println("getStarred2 invoke")
+	starred, ok := starredXML(c, true)
+	if !ok {
+		return
+	}
 	resp := createSubsonicOkResponseXML()
-	resp.Song = &videoXML
+	resp.Starred2 = starred
 	c.XML(http.StatusOK, resp)
 }
 
-// starred.view
-func StarredHandlerXML(c *gin.Context) {
-	log.Println("starred invoke")
+// starredXML 构造 starred/starred2 的内容，id3 为 false 时专辑按 1.x 的目录格式输出
+func starredXML(c *gin.Context, id3 bool) (*StarredXML, bool) {
 	cliAny, _ := c.Get("client")
 	client := cliAny.(*bilibili.BilibiliClient)
 
-	songIDs, err := getStarredSongs()
+	result, err := loadStarred(client, configFrom(c).Metadata.Concurrency)
 	if err != nil {
-		log.Println("get starred songs error:", err)
-		resp := SubsonicResponseXML{
-			Status:  "failed",
-			Version: VERSION,
-			Xmlns:   "http://subsonic.org/restapi",
-			Error: &SubsonicErrorXML{
-				Code:    50,
-				Message: err.Error(),
-			},
-		}
-		c.XML(http.StatusInternalServerError, resp)
-		return
+		log.Println("get starred error:", err)
+		c.XML(http.StatusInternalServerError, createSubsonicErrorResponseXML(0, err.Error()))
+		return nil, false
 	}
 
-	var songs []SongXML
-	for _, id := range songIDs {
-		video, err := client.GetVideoInfo(id)
-		if err != nil {
-			log.Println("get video info error:", err)
-			// Skip this song if there's an error
-			continue
+	user := currentUser(c)
+	starred := &StarredXML{}
+	for _, a := range result.Artists {
+		artist := ArtistXML{
+			ID:         a.ID,
+			Name:       a.Name,
+			CoverArt:   a.CoverArt,
+			AlbumCount: 0,
+			Starred:    formatTime(a.Starred),
+		}
+		artist.UserRating, artist.AverageRating = ratingsOf(user, a.ID)
+		starred.Artist = append(starred.Artist, artist)
+	}
+	for _, a := range result.Albums {
+		album := AlbumXML{
+			ID:        a.ID,
+			Artist:    a.Artist,
+			ArtistID:  a.ArtistID,
+			CoverArt:  a.CoverArt,
+			SongCount: a.SongCount,
+			Starred:   formatTime(a.Starred),
+		}
+		album.UserRating, album.AverageRating = ratingsOf(user, a.ID)
+		if id3 {
+			album.Name = a.Name
+		} else {
+			album.Title = a.Name
+			album.IsDir = true
 		}
-		songs = append(songs, SongFromXML(video))
+		starred.Album = append(starred.Album, album)
 	}
+	for _, s := range result.Songs {
+		song := SongFromMetaXML(&s.SongMeta)
+		song.Starred = formatTime(s.Starred)
+		starred.Song = append(starred.Song, song)
+	}
+	annotateSongsXML(c, starred.Song)
+	return starred, true
+}
 
-	resp := createSubsonicOkResponseXML()
-	resp.Starred2 = &SearchResultXML{
-		Song: songs,
+// starSyncerFrom 返回请求上下文中的收藏夹同步器，未开启时为 nil
+func starSyncerFrom(c *gin.Context) *StarSyncer {
+	if s, ok := c.Get("starSync"); ok {
+		return s.(*StarSyncer)
 	}
-	c.XML(http.StatusOK, resp)
+	return nil
 }
 
 // star.view
 func StarHandlerXML(c *gin.Context) {
 	log.Println("star invoke")
-	id := c.Query("id")
-	if err := starSong(id); err != nil {
-		log.Println("star song error:", err)
-		resp := SubsonicResponseXML{
-			Status:  "failed",
-			Version: VERSION,
-			Xmlns:   "http://subsonic.org/restapi",
-			Error: &SubsonicErrorXML{
-				Code:    50,
-				Message: err.Error(),
-			},
+	starUnstarXML(c, starByID, starArtist, starAlbum)
+}
+
+// unstar.view
+func UnstarHandlerXML(c *gin.Context) {
+	log.Println("unstar invoke")
+	starUnstarXML(c, unstarByID, unstarArtist, unstarAlbum)
+}
+
+// starUnstarXML 处理 star/unstar 的 id、artistId、albumId 参数
+func starUnstarXML(c *gin.Context,
+	byID func(*bilibili.BilibiliClient, *Config, *StarSyncer, string) error,
+	artist func(*bilibili.BilibiliClient, *Config, string) error,
+	album func(*bilibili.BilibiliClient, *Config, string) error) {
+	cliAny, _ := c.Get("client")
+	client := cliAny.(*bilibili.BilibiliClient)
+	cfg := configFrom(c)
+
+	var err error
+	for _, id := range c.QueryArray("id") {
+		if err = byID(client, cfg, starSyncerFrom(c), id); err != nil {
+			break
 		}
-		c.XML(http.StatusInternalServerError, resp)
+	}
+	for _, id := range c.QueryArray("artistId") {
+		if err == nil {
+			err = artist(client, cfg, id)
+		}
+	}
+	for _, id := range c.QueryArray("albumId") {
+		if err == nil {
+			err = album(client, cfg, id)
+		}
+	}
+	if err != nil {
+		log.Println("star error:", err)
+		c.XML(http.StatusInternalServerError, createSubsonicErrorResponseXML(0, err.Error()))
 		return
 	}
+
 	resp := createSubsonicOkResponseXML()
 	c.XML(http.StatusOK, resp)
 }
 
-// unstar.view
-func UnstarHandlerXML(c *gin.Context) {
-	log.Println("unstar invoke")
+// setRating.view
+func SetRatingHandlerXML(c *gin.Context) {
+	log.Println("setRating invoke")
+	cliAny, _ := c.Get("client")
+	client := cliAny.(*bilibili.BilibiliClient)
+
 	id := c.Query("id")
-	if err := unstarSong(id); err != nil {
-		log.Println("unstar song error:", err)
-		resp := SubsonicResponseXML{
-			Status:  "failed",
-			Version: VERSION,
-			Xmlns:   "http://subsonic.org/restapi",
-			Error: &SubsonicErrorXML{
-				Code:    50,
-				Message: err.Error(),
-			},
-		}
-		c.XML(http.StatusInternalServerError, resp)
+	ratingStr := c.Query("rating")
+	if id == "" || ratingStr == "" {
+		c.XML(http.StatusOK, createSubsonicErrorResponseXML(10, "Required parameter is missing."))
+		return
+	}
+	rating, err := strconv.Atoi(ratingStr)
+	if err != nil || rating < 0 || rating > 5 {
+		c.XML(http.StatusOK, createSubsonicErrorResponseXML(0, "Invalid rating: "+ratingStr))
+		return
+	}
+
+	if err := setRating(client, configFrom(c), currentUser(c), id, rating); err != nil {
+		log.Println("set rating error:", err)
+		c.XML(http.StatusInternalServerError, createSubsonicErrorResponseXML(0, err.Error()))
 		return
 	}
+
 	resp := createSubsonicOkResponseXML()
 	c.XML(http.StatusOK, resp)
 }
@@ -375,7 +1285,7 @@ func StreamHandlerXML(c *gin.Context) {
 	client := cliAny.(*bilibili.BilibiliClient)
 	id := c.Query("id")
 
-	file, _, err := client.GetAudioStream(id)
+	file, _, err := openSongStream(client, id)
 	if err != nil {
 		log.Println("stream error:", err)
 		c.Status(http.StatusInternalServerError)
@@ -395,27 +1305,71 @@ func StreamHandlerXML(c *gin.Context) {
 	})
 }
 
+func playlistToXML(p *PlaylistInfo) PlaylistXML {
+	return PlaylistXML{
+		ID:        p.ID,
+		Name:      p.Name,
+		Comment:   p.Comment,
+		SongCount: len(p.SongIDs),
+		Duration:  0, // Placeholder
+		Public:    p.Public,
+		Owner:     "voyage",
+		Created:   formatTime(p.Created),
+		Changed:   formatTime(p.Changed),
+	}
+}
+
+// playlistResponseXML 返回带歌曲列表的歌单
+func playlistResponseXML(c *gin.Context, p *PlaylistInfo) {
+	cliAny, _ := c.Get("client")
+	client := cliAny.(*bilibili.BilibiliClient)
+
+	var metas []SongMeta
+	if p.IsBili() || p.IsMenu() {
+		var videos []bilibili.BilibiliVideo
+		var err error
+		if p.IsBili() {
+			videos, err = client.GetFavoriteList(p.MediaID)
+		} else {
+			videos, err = menuSongs(client, p)
+		}
+		if err != nil {
+			log.Println("get playlist songs error:", err)
+			c.XML(http.StatusInternalServerError, createSubsonicErrorResponseXML(0, err.Error()))
+			return
+		}
+		for _, v := range videos {
+			metas = append(metas, SongMeta{BilibiliVideo: v})
+		}
+	} else {
+		// 无法获取的歌曲也保留占位，songIndexToRemove 才能对得上
+		metas = lookupSongMetas(client, p.SongIDs, configFrom(c).Metadata.Concurrency)
+	}
+
+	playlist := playlistToXML(p)
+	playlist.SongCount = len(metas)
+	for _, m := range metas {
+		playlist.Entry = append(playlist.Entry, SongFromMetaXML(&m))
+		playlist.Duration += m.Duration
+	}
+	annotateSongsXML(c, playlist.Entry)
+
+	resp := createSubsonicOkResponseXML()
+	resp.Playlist = &playlist
+	c.XML(http.StatusOK, resp)
+}
+
 func GetPlaylistsHandlerXML(c *gin.Context) {
 	log.Println("getPlaylists invoke")
 	playlists, err := getPlaylists()
 	if err != nil {
-		// Handle error
-		c.XML(http.StatusInternalServerError, nil)
+		c.XML(http.StatusInternalServerError, createSubsonicErrorResponseXML(0, err.Error()))
 		return
 	}
 
 	var playlistsXML []PlaylistXML
 	for _, p := range playlists {
-		// Here you might want to fetch additional details for each playlist
-		// like song count, duration, etc. For now, we'll use dummy data.
-		playlistsXML = append(playlistsXML, PlaylistXML{
-			ID:        p.ID,
-			Name:      p.Name,
-			SongCount: 0, // Placeholder
-			Duration:  0, // Placeholder
-			Public:    true,
-			Owner:     "voyage",
-		})
+		playlistsXML = append(playlistsXML, playlistToXML(&p))
 	}
 
 	resp := createSubsonicOkResponseXML()
@@ -423,100 +1377,154 @@ func GetPlaylistsHandlerXML(c *gin.Context) {
 	c.XML(http.StatusOK, resp)
 }
 
+// createPlaylist.view
+// name 为 "bili-someName-mediaId" 时关联已有的 bilibili 收藏夹；开启 writeThrough 时
+// 普通名称会新建收藏夹，否则创建本地歌单；带 playlistId 时覆盖已有本地歌单的歌曲
 func CreatePlaylistHandlerXML(c *gin.Context) {
 	log.Println("createPlaylist invoke")
 	name := c.Query("name")
-	// The name is expected to be in the format "bili-someName-mediaId"
-	parts := strings.Split(name, "-")
-	if len(parts) < 3 || parts[0] != "bili" {
-		// Handle invalid name format
-		c.XML(http.StatusBadRequest, nil)
+	playlistId := c.Query("playlistId")
+	songIds := c.QueryArray("songId")
+	cliAny, _ := c.Get("client")
+	client := cliAny.(*bilibili.BilibiliClient)
+
+	var playlist PlaylistInfo
+	var err error
+	if playlistId != "" {
+		playlist, err = replacePlaylistSongs(playlistId, name, songIds)
+	} else if menuID, ok := parseMenuID(name); ok {
+		playlist, err = createMenuPlaylist(client, menuID)
+	} else if parts := strings.Split(name, "-"); len(parts) >= 3 && parts[0] == "bili" {
+		mediaId := parts[len(parts)-1]
+		playlistName := strings.Join(parts[1:len(parts)-1], "-")
+		var id string
+		id, err = createPlaylist(playlistName, mediaId)
+		if err == nil {
+			playlist, err = getPlaylist(id)
+		}
+	} else if name != "" && configFrom(c).Playlists.WriteThrough {
+		playlist, err = createBiliFolderPlaylist(client, name, songIds)
+	} else if name != "" {
+		playlist, err = createLocalPlaylist(name, songIds)
+	} else {
+		c.XML(http.StatusBadRequest, createSubsonicErrorResponseXML(10, "Required parameter is missing: name"))
 		return
 	}
-	mediaId := parts[len(parts)-1]
-	playlistName := strings.Join(parts[1:len(parts)-1], "-")
-
-	_, err := createPlaylist(playlistName, mediaId)
 	if err != nil {
-		// Handle error
-		c.XML(http.StatusInternalServerError, nil)
+		log.Println("create playlist error:", err)
+		playlistErrorXML(c, err)
 		return
 	}
 
-	// According to Subsonic API, the createPlaylist response should contain the created playlist.
-	// So we will fetch the playlist info and return it.
-	playlists, _ := getPlaylists()
-	var createdPlaylist PlaylistXML
-	for _, p := range playlists {
-		if p.MediaID == mediaId {
-			createdPlaylist = PlaylistXML{
-				ID:        p.ID,
-				Name:      p.Name,
-				SongCount: 0, // Placeholder
-				Duration:  0, // Placeholder
-				Public:    true,
-				Owner:     "voyage",
+	playlistResponseXML(c, &playlist)
+}
+
+// updatePlaylist.view
+func UpdatePlaylistHandlerXML(c *gin.Context) {
+	log.Println("updatePlaylist invoke")
+	id := c.Query("playlistId")
+	if id == "" {
+		c.XML(http.StatusBadRequest, createSubsonicErrorResponseXML(10, "Required parameter is missing: playlistId"))
+		return
+	}
+
+	var u PlaylistUpdate
+	if name, ok := c.GetQuery("name"); ok {
+		u.Name = &name
+	}
+	if comment, ok := c.GetQuery("comment"); ok {
+		u.Comment = &comment
+	}
+	if public, ok := c.GetQuery("public"); ok {
+		b := public == "true"
+		u.Public = &b
+	}
+	u.SongIDsToAdd = c.QueryArray("songIdToAdd")
+	for _, s := range c.QueryArray("songIndexToRemove") {
+		index, err := strconv.Atoi(s)
+		if err != nil {
+			c.XML(http.StatusBadRequest, createSubsonicErrorResponseXML(0, "Invalid songIndexToRemove: "+s))
+			return
+		}
+		u.SongIndexToRemove = append(u.SongIndexToRemove, index)
+	}
+
+	// 收藏夹歌单的增删先写回 bilibili，本地只保存元数据
+	if configFrom(c).Playlists.WriteThrough && (len(u.SongIDsToAdd) > 0 || len(u.SongIndexToRemove) > 0) {
+		playlist, err := getPlaylist(id)
+		if err != nil {
+			playlistErrorXML(c, err)
+			return
+		}
+		if playlist.IsBili() {
+			cliAny, _ := c.Get("client")
+			client := cliAny.(*bilibili.BilibiliClient)
+			if err := updateBiliPlaylist(client, &playlist, u); err != nil {
+				log.Println("update favorite folder error:", err)
+				playlistErrorXML(c, err)
+				return
 			}
-			break
+			u.SongIDsToAdd = nil
+			u.SongIndexToRemove = nil
 		}
 	}
 
+	if _, err := updatePlaylist(id, u); err != nil {
+		log.Println("update playlist error:", err)
+		playlistErrorXML(c, err)
+		return
+	}
+
 	resp := createSubsonicOkResponseXML()
-	resp.Playlists = &PlaylistsXML{Playlist: []PlaylistXML{createdPlaylist}}
 	c.XML(http.StatusOK, resp)
 }
 
-func GetPlaylistHandlerXML(c *gin.Context) {
-	log.Println("getPlaylist invoke")
+// deletePlaylist.view
+func DeletePlaylistHandlerXML(c *gin.Context) {
+	log.Println("deletePlaylist invoke")
 	id := c.Query("id")
-	// id is "bili-<mediaId>"
-	parts := strings.Split(id, "-")
-	if len(parts) < 2 || parts[0] != "bili" {
-		// Handle invalid id
-		c.XML(http.StatusBadRequest, nil)
+	if err := deletePlaylist(id); err != nil {
+		log.Println("delete playlist error:", err)
+		playlistErrorXML(c, err)
 		return
 	}
-	mediaId := parts[1]
 
-	cliAny, _ := c.Get("client")
-	client := cliAny.(*bilibili.BilibiliClient)
-
-	videos, err := client.GetFavoriteList(mediaId)
-	if err != nil {
-		// Handle error
-		c.XML(http.StatusInternalServerError, nil)
-		return
-	}
+	resp := createSubsonicOkResponseXML()
+	c.XML(http.StatusOK, resp)
+}
 
-	var songsXML []SongXML
-	var totalDuration int
-	for _, v := range videos {
-		songsXML = append(songsXML, SongFromXML(&v))
-		totalDuration += v.Duration
-	}
+func GetPlaylistHandlerXML(c *gin.Context) {
+	log.Println("getPlaylist invoke")
+	id := c.Query("id")
 
-	// We need the playlist name. We can get it from the stored playlists.
-	playlists, _ := getPlaylists()
-	var playlistName string
-	for _, p := range playlists {
-		if p.MediaID == mediaId {
-			playlistName = p.Name
-			break
+	playlist, err := getPlaylist(id)
+	if err == errPlaylistNotFound && strings.HasPrefix(id, "bili-") {
+		// 未保存的收藏夹也可以直接用 "bili-<mediaId>" 访问
+		playlist = PlaylistInfo{ID: id, MediaID: strings.TrimPrefix(id, "bili-"), Kind: PlaylistKindBili, Public: true}
+	} else if menuID, ok := parseMenuID(id); ok && err == errPlaylistNotFound {
+		// 音频区歌单同样可以直接用 "am<menuId>" 访问
+		cliAny, _ := c.Get("client")
+		if playlist, err = menuPlaylist(cliAny.(*bilibili.BilibiliClient), menuID); err != nil {
+			log.Println("get menu error:", err)
+			playlistErrorXML(c, err)
+			return
 		}
+	} else if err != nil {
+		playlistErrorXML(c, err)
+		return
 	}
 
+	playlistResponseXML(c, &playlist)
+}
 
-	playlist := PlaylistXML{
-		ID:        id,
-		Name:      playlistName,
-		SongCount: len(videos),
-		Duration:  totalDuration,
-		Public:    true,
-		Owner:     "voyage",
-		Entry:     songsXML,
+// playlistErrorXML 将歌单操作的错误转换为 Subsonic 错误码
+func playlistErrorXML(c *gin.Context, err error) {
+	switch err {
+	case errPlaylistNotFound:
+		c.XML(http.StatusNotFound, createSubsonicErrorResponseXML(70, err.Error()))
+	case errPlaylistReadOnly:
+		c.XML(http.StatusForbidden, createSubsonicErrorResponseXML(50, err.Error()))
+	default:
+		c.XML(http.StatusInternalServerError, createSubsonicErrorResponseXML(0, err.Error()))
 	}
-
-	resp := createSubsonicOkResponseXML()
-	resp.Playlist = &playlist
-	c.XML(http.StatusOK, resp)
 }
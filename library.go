@@ -0,0 +1,131 @@
+package main
+
+import (
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"example/subsonic/bilibili"
+)
+
+// catalogTTL 是收藏的 UP 主和合集的歌曲列表的缓存时间。离线同步的客户端会
+// 连续翻页，缓存让每页不必重新获取所有投稿
+const catalogTTL = 30 * time.Minute
+
+// catalogArtistSongs 是每个收藏的 UP 主计入曲库的歌曲数
+const catalogArtistSongs = 200
+
+type catalogEntry struct {
+	ids     []string
+	fetched time.Time
+}
+
+// catalogCache caches the song IDs of starred artists and albums by their ID.
+type catalogCache struct {
+	mu      sync.Mutex
+	entries map[string]catalogEntry
+}
+
+var catalog = &catalogCache{entries: map[string]catalogEntry{}}
+
+// songIDs returns the songs of a starred artist or album, fetching them when
+// not cached within catalogTTL.
+func (c *catalogCache) songIDs(client *bilibili.BilibiliClient, id string) ([]string, error) {
+	c.mu.Lock()
+	e, ok := c.entries[id]
+	c.mu.Unlock()
+	if ok && time.Since(e.fetched) < catalogTTL {
+		return e.ids, nil
+	}
+
+	var videos []bilibili.BilibiliVideo
+	var err error
+	if mid, ok := parseArtistID(id); ok {
+		videos, err = topSongs(client, mid, catalogArtistSongs)
+	} else if mid, seasonId, ok := parseAlbumID(id); ok {
+		if _, videos, err = client.GetSeason(mid, seasonId); err == nil {
+			for _, v := range videos {
+				if err := saveVideoMeta(&v); err != nil {
+					log.Println("save song meta error:", err)
+				}
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(videos))
+	for _, v := range videos {
+		ids = append(ids, v.ID)
+	}
+	c.mu.Lock()
+	c.entries[id] = catalogEntry{ids: ids, fetched: time.Now()}
+	c.mu.Unlock()
+	return ids, nil
+}
+
+// searchLibrary answers a search without keyword, which offline-sync clients
+// use to page through the whole library: starred artists and albums, and the
+// songs of the library together with the catalog of starred artists and
+// albums. Songs are sorted by ID so that pages stay stable between requests.
+func searchLibrary(client *bilibili.BilibiliClient, concurrency int, q searchQuery) (searchResult, error) {
+	var result searchResult
+	stars, err := repo.Starred()
+	if err != nil {
+		return result, err
+	}
+
+	ids, err := librarySongIDs()
+	if err != nil {
+		return result, err
+	}
+	var artists []bilibili.BilibiliUser
+	var albums []bilibili.BilibiliSeason
+	for _, s := range stars {
+		switch s.Kind {
+		case StarKindArtist:
+			if mid, ok := parseArtistID(s.ID); ok {
+				artists = append(artists, bilibili.BilibiliUser{MID: mid, Name: s.Name, Face: s.CoverArt})
+			}
+		case StarKindAlbum:
+			if mid, seasonId, ok := parseAlbumID(s.ID); ok {
+				albums = append(albums, bilibili.BilibiliSeason{ID: seasonId, MID: mid, Name: s.Name, Cover: s.CoverArt, Total: s.SongCount, Author: s.Artist})
+			}
+		default:
+			continue
+		}
+		if q.SongCount == 0 {
+			continue
+		}
+		songs, err := catalog.songIDs(client, s.ID)
+		if err != nil {
+			log.Println("get catalog error:", err)
+			continue
+		}
+		ids = append(ids, songs...)
+	}
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+
+	result.Artists = pageOf(artists, q.ArtistOffset, q.ArtistCount)
+	result.Albums = pageOf(albums, q.AlbumOffset, q.AlbumCount)
+	result.Songs = lookupSongMetas(client, pageOf(ids, q.SongOffset, q.SongCount), concurrency)
+	return result, nil
+}
+
+// isLibraryQuery reports whether query asks for the whole library. Symfonium
+// and others send two double quotes rather than an empty string.
+func isLibraryQuery(query string) bool {
+	return strings.Trim(strings.TrimSpace(query), `"`) == ""
+}
+
+// pageOf returns count items of list starting at offset.
+func pageOf[T any](list []T, offset int, count int) []T {
+	if offset >= len(list) {
+		return nil
+	}
+	return list[offset:min(offset+count, len(list))]
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// listenBrainzQueueKey 是重试队列在 repo state 中的 key
+const listenBrainzQueueKey = "listenBrainzQueue"
+
+// lbListen 是 ListenBrainz submit-listens 接口中的一条播放
+type lbListen struct {
+	ListenedAt    int64           `json:"listened_at,omitempty"`
+	TrackMetadata lbTrackMetadata `json:"track_metadata"`
+}
+
+type lbTrackMetadata struct {
+	ArtistName     string           `json:"artist_name"`
+	TrackName      string           `json:"track_name"`
+	AdditionalInfo lbAdditionalInfo `json:"additional_info"`
+}
+
+type lbAdditionalInfo struct {
+	MediaPlayer      string `json:"media_player,omitempty"`
+	SubmissionClient string `json:"submission_client"`
+	MusicService     string `json:"music_service"`
+	OriginURL        string `json:"origin_url"`
+	DurationMs       int    `json:"duration_ms,omitempty"`
+}
+
+// queuedListen 是提交失败、等待重试的播放
+type queuedListen struct {
+	User   string   `json:"user"`
+	Listen lbListen `json:"listen"`
+}
+
+// lbError 是 ListenBrainz 返回的错误状态，只有服务端错误和限流值得重试
+type lbError struct {
+	Status  int
+	Message string
+}
+
+func (e *lbError) Error() string {
+	return fmt.Sprintf("listenbrainz: %d %s", e.Status, e.Message)
+}
+
+func retryable(err error) bool {
+	if e, ok := err.(*lbError); ok {
+		return e.Status >= 500 || e.Status == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// lbImportBatch 是一次 import 提交的最多播放数，ListenBrainz 的上限是 1000
+const lbImportBatch = 100
+
+// listenBrainzSink 把播放提交到 ListenBrainz 兼容的服务。播放先保存在磁盘上的
+// 队列中，由后台的 Run 按用户分批提交，提交失败时留在队列中重试
+type listenBrainzSink struct {
+	cfg    ListenBrainzConfig
+	client *http.Client
+	// wake 通知 Run 队列中有新的播放
+	wake chan struct{}
+
+	flushing sync.Mutex // 同一时间只有一次提交
+	mu       sync.Mutex // 保护重试队列，提交时不持有
+}
+
+func newListenBrainzSink(cfg ListenBrainzConfig) *listenBrainzSink {
+	return &listenBrainzSink{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// NowPlaying submits a playing_now listen. It is not retried.
+func (s *listenBrainzSink) NowPlaying(user string, player string, m SongMeta, at time.Time) error {
+	token, ok := s.cfg.Tokens[user]
+	if !ok {
+		return nil
+	}
+	return s.submit(token, "playing_now", []lbListen{listenOf(m, player, time.Time{})})
+}
+
+// Listen queues a listen for Run to submit.
+func (s *listenBrainzSink) Listen(user string, player string, m SongMeta, at time.Time) error {
+	if _, ok := s.cfg.Tokens[user]; !ok {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var queue []queuedListen
+	if err := repo.LoadState(listenBrainzQueueKey, &queue); err != nil {
+		return err
+	}
+	queue = append(queue, queuedListen{User: user, Listen: listenOf(m, player, at)})
+	if err := repo.SaveState(listenBrainzQueueKey, queue); err != nil {
+		return err
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Flush submits the queued listens in batches of one user's listens,
+// stopping at the first retryable failure. Listens queued meanwhile are kept
+// after the ones left.
+func (s *listenBrainzSink) Flush() error {
+	s.flushing.Lock()
+	defer s.flushing.Unlock()
+
+	s.mu.Lock()
+	var queue []queuedListen
+	err := repo.LoadState(listenBrainzQueueKey, &queue)
+	s.mu.Unlock()
+	if err != nil || len(queue) == 0 {
+		return err
+	}
+
+	left := queue
+	for len(left) > 0 {
+		batch, rest := nextListenBatch(left)
+		if err = s.submitBatch(batch); err != nil {
+			break
+		}
+		left = rest
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var current []queuedListen
+	if loadErr := repo.LoadState(listenBrainzQueueKey, &current); loadErr != nil {
+		return loadErr
+	}
+	// Listen 只会在队列末尾追加
+	left = append(left, current[len(queue):]...)
+	if saveErr := repo.SaveState(listenBrainzQueueKey, left); saveErr != nil {
+		return saveErr
+	}
+	if err != nil {
+		return fmt.Errorf("queued %d listens: %v", len(left), err)
+	}
+	return nil
+}
+
+// nextListenBatch takes up to lbImportBatch listens of the first user in
+// queue, keeping the order of the rest.
+func nextListenBatch(queue []queuedListen) (batch []queuedListen, rest []queuedListen) {
+	user := queue[0].User
+	for _, q := range queue {
+		if q.User == user && len(batch) < lbImportBatch {
+			batch = append(batch, q)
+		} else {
+			rest = append(rest, q)
+		}
+	}
+	return batch, rest
+}
+
+// submitBatch imports the listens of one user. When the service rejects a
+// batch, its listens are submitted one at a time so that only the bad ones are
+// dropped. Only retryable errors are returned.
+func (s *listenBrainzSink) submitBatch(batch []queuedListen) error {
+	token, ok := s.cfg.Tokens[batch[0].User]
+	if !ok {
+		return nil
+	}
+	listens := make([]lbListen, len(batch))
+	for i, q := range batch {
+		listens[i] = q.Listen
+	}
+	err := s.submit(token, "import", listens)
+	if err == nil || retryable(err) {
+		return err
+	}
+	if len(batch) == 1 {
+		log.Printf("listenbrainz dropped listen of %s: %v", batch[0].Listen.TrackMetadata.TrackName, err)
+		return nil
+	}
+	for i := range batch {
+		if err := s.submitBatch(batch[i : i+1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run submits the queue whenever a listen is queued, and retries it every
+// interval after a failure.
+func (s *listenBrainzSink) Run(interval time.Duration) {
+	for {
+		if err := s.Flush(); err != nil {
+			log.Println("listenbrainz submit error:", err)
+			time.Sleep(interval)
+			continue
+		}
+		select {
+		case <-s.wake:
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (s *listenBrainzSink) submit(token string, listenType string, listens []lbListen) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"listen_type": listenType,
+		"payload":     listens,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, _ := http.NewRequest("POST", strings.TrimSuffix(s.cfg.URL, "/")+"/1/submit-listens", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Token "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+		}
+		data, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(data, &e) != nil {
+			e.Error = string(data)
+		}
+		return &lbError{Status: resp.StatusCode, Message: e.Error}
+	}
+	return nil
+}
+
+// listenOf builds a listen from song metadata. A zero at leaves out
+// listened_at, as playing_now requires.
+func listenOf(m SongMeta, player string, at time.Time) lbListen {
+	track := songInfoOf(&m.BilibiliVideo)
+	l := lbListen{
+		TrackMetadata: lbTrackMetadata{
+			ArtistName: track.DisplayArtist,
+			TrackName:  track.Title,
+			AdditionalInfo: lbAdditionalInfo{
+				MediaPlayer:      player,
+				SubmissionClient: "bilisonic",
+				MusicService:     "bilibili.com",
+				OriginURL:        songURL(m.ID),
+				DurationMs:       m.Duration * 1000,
+			},
+		},
+	}
+	if !at.IsZero() {
+		l.ListenedAt = at.Unix()
+	}
+	return l
+}
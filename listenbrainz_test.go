@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"example/subsonic/bilibili"
+)
+
+// stubListenBrainz 记录收到的播放，status 不为 200 时拒绝提交
+type stubListenBrainz struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	status   int
+	requests int
+	listens  []string // listen_type:track_name
+}
+
+func newStubListenBrainz(t *testing.T) *stubListenBrainz {
+	s := &stubListenBrainz{status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if r.URL.Path != "/1/submit-listens" || r.Header.Get("Authorization") != "Token alice-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if s.status != http.StatusOK {
+			w.WriteHeader(s.status)
+			json.NewEncoder(w).Encode(map[string]interface{}{"code": s.status, "error": "unavailable"})
+			return
+		}
+		var body struct {
+			ListenType string     `json:"listen_type"`
+			Payload    []lbListen `json:"payload"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		s.requests++
+		for _, l := range body.Payload {
+			s.listens = append(s.listens, body.ListenType+":"+l.TrackMetadata.TrackName)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *stubListenBrainz) setStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+func (s *stubListenBrainz) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *stubListenBrainz) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.listens...)
+}
+
+func song(id string, title string) SongMeta {
+	return SongMeta{BilibiliVideo: bilibili.BilibiliVideo{ID: id, Title: title, Author: "up", Duration: 200}}
+}
+
+func TestListenBrainzRetryQueue(t *testing.T) {
+	useTestRepo(t)
+	stub := newStubListenBrainz(t)
+	sink := newListenBrainzSink(ListenBrainzConfig{URL: stub.URL, Tokens: map[string]string{"alice": "alice-token"}})
+	now := time.Now()
+
+	if err := sink.NowPlaying("alice", "app", song("a", "A"), now); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Listen("alice", "app", song("a", "A"), now); err != nil {
+		t.Fatal(err)
+	}
+	// 没有 token 的用户不转发
+	if err := sink.Listen("bob", "app", song("a", "A"), now); err != nil {
+		t.Fatal(err)
+	}
+
+	// Listen 只加入队列，由 Flush 提交
+	if got := stub.received(); len(got) != 1 {
+		t.Fatalf("listen submitted before flush: %v", got)
+	}
+
+	stub.setStatus(http.StatusServiceUnavailable)
+	sink.Listen("alice", "app", song("b", "B"), now)
+	if err := sink.Flush(); err == nil {
+		t.Fatal("expected error while the service is down")
+	}
+	sink.Listen("alice", "app", song("c", "C"), now)
+	var queue []queuedListen
+	repo.LoadState(listenBrainzQueueKey, &queue)
+	if len(queue) != 3 {
+		t.Fatalf("queue = %+v", queue)
+	}
+
+	stub.setStatus(http.StatusOK)
+	requests := stub.requestCount()
+	if err := sink.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"playing_now:A", "import:A", "import:B", "import:C"}
+	if got := stub.received(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("received %v, want %v", got, want)
+	}
+	if n := stub.requestCount() - requests; n != 1 {
+		t.Fatalf("queued listens sent in %d requests", n)
+	}
+	queue = nil
+	repo.LoadState(listenBrainzQueueKey, &queue)
+	if len(queue) != 0 {
+		t.Fatalf("queue after flush = %+v", queue)
+	}
+
+	// 被拒绝的提交不会重试
+	stub.setStatus(http.StatusBadRequest)
+	sink.Listen("alice", "app", song("d", "D"), now)
+	if err := sink.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	queue = nil
+	repo.LoadState(listenBrainzQueueKey, &queue)
+	if len(queue) != 0 {
+		t.Fatalf("rejected listen queued: %+v", queue)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	lrcTimePattern = regexp.MustCompile(`^\[(\d+):(\d+)(?:[.:](\d+))?\]`)
+	lrcTagPattern  = regexp.MustCompile(`^\[([a-zA-Z]+):(.*)\]$`)
+
+	lyricsIDPattern   = regexp.MustCompile(`^[0-9A-Za-z]+$`)
+	lyricsLangPattern = regexp.MustCompile(`^[A-Za-z-]*$`)
+)
+
+// parseLRC parses an LRC file. Lines may carry several timestamps; [offset:]
+// is applied to the timestamps, positive values showing lines sooner. A file
+// without timestamps is returned as unsynced lyrics. lang is used unless the
+// file has a [la:] or [lang:] tag.
+func parseLRC(data string, lang string) songLyrics {
+	l := songLyrics{Lang: lang}
+	var offset int64
+	var unsynced []string
+	for _, raw := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		line := strings.TrimSpace(raw)
+		if line == "" {
+			continue
+		}
+		if m := lrcTagPattern.FindStringSubmatch(line); m != nil {
+			value := strings.TrimSpace(m[2])
+			switch strings.ToLower(m[1]) {
+			case "ar":
+				l.Artist = value
+			case "ti":
+				l.Title = value
+			case "offset":
+				offset, _ = strconv.ParseInt(strings.TrimPrefix(value, "+"), 10, 64)
+			case "la", "lang":
+				l.Lang = value
+			}
+			continue
+		}
+
+		var starts []int64
+		for {
+			m := lrcTimePattern.FindStringSubmatch(line)
+			if m == nil {
+				break
+			}
+			starts = append(starts, lrcTimestamp(m[1], m[2], m[3]))
+			line = line[len(m[0]):]
+		}
+		if len(starts) == 0 {
+			unsynced = append(unsynced, line)
+			continue
+		}
+		for _, start := range starts {
+			l.Lines = append(l.Lines, lyricLine{Start: max(start-offset, 0), Value: strings.TrimSpace(line)})
+		}
+	}
+
+	l.source = l.Lang
+	if len(l.Lines) == 0 {
+		for _, line := range unsynced {
+			l.Lines = append(l.Lines, lyricLine{Value: line})
+		}
+		return l
+	}
+	l.Synced = true
+	sort.SliceStable(l.Lines, func(i, j int) bool { return l.Lines[i].Start < l.Lines[j].Start })
+	return l
+}
+
+// lrcTimestamp converts mm, ss and the optional fraction of a timestamp to
+// milliseconds. The fraction may have one to three digits.
+func lrcTimestamp(min string, sec string, frac string) int64 {
+	m, _ := strconv.ParseInt(min, 10, 64)
+	s, _ := strconv.ParseInt(sec, 10, 64)
+	ms := (m*60 + s) * 1000
+	if frac != "" {
+		if len(frac) > 3 {
+			frac = frac[:3]
+		}
+		f, _ := strconv.ParseInt(frac, 10, 64)
+		for i := len(frac); i < 3; i++ {
+			f *= 10
+		}
+		ms += f
+	}
+	return ms
+}
+
+// localLyrics reads the LRC files of part of song id from dir:
+// "<bvid>/<part>.lrc" and "<bvid>/<part>.<lang>.lrc", and for the first part
+// also "<bvid>.lrc" and "<bvid>.<lang>.lrc". bvid may be written with or
+// without the "BV" prefix.
+func localLyrics(dir string, id string, part int) ([]songLyrics, error) {
+	if dir == "" || !lyricsIDPattern.MatchString(id) || part < 1 {
+		return nil, nil
+	}
+
+	var lyrics []songLyrics
+	for _, name := range []string{id, "BV" + id} {
+		p := strconv.Itoa(part)
+		patterns := []string{
+			filepath.Join(dir, name, p+".lrc"),
+			filepath.Join(dir, name, p+".*.lrc"),
+		}
+		if part == 1 {
+			patterns = append([]string{
+				filepath.Join(dir, name+".lrc"),
+				filepath.Join(dir, name+".*.lrc"),
+			}, patterns...)
+		}
+		for _, pattern := range patterns {
+			files, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range files {
+				data, err := os.ReadFile(file)
+				if err != nil {
+					return nil, err
+				}
+				lyrics = append(lyrics, parseLRC(string(data), lrcFileLang(file)))
+			}
+		}
+	}
+	return lyrics, nil
+}
+
+// lrcFileLang returns the language in a "<name>.<lang>.lrc" file name, or
+// "xxx", the OpenSubsonic code for an unknown language.
+func lrcFileLang(file string) string {
+	name := strings.TrimSuffix(filepath.Base(file), ".lrc")
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[i+1:]
+	}
+	return "xxx"
+}
+
+// saveLocalLyrics stores an uploaded LRC file as "<dir>/<id>[.<lang>].lrc"
+// for the first part and "<dir>/<id>/<part>[.<lang>].lrc" for the others.
+func saveLocalLyrics(dir string, id string, part int, lang string, data []byte) error {
+	if !lyricsIDPattern.MatchString(id) || !lyricsLangPattern.MatchString(lang) || part < 1 {
+		return fmt.Errorf("invalid song id, part or language")
+	}
+	name := id
+	if part > 1 {
+		dir = filepath.Join(dir, id)
+		name = strconv.Itoa(part)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if lang != "" {
+		name += "." + lang
+	}
+	return os.WriteFile(filepath.Join(dir, name+".lrc"), data, 0644)
+}
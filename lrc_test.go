@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseLRC(t *testing.T) {
+	l := parseLRC("[ti:晴天]\n[offset:+500]\n[00:12.34][01:00.5]副歌\r\n[00:05.123]第一句\n\n", "zh")
+	if !l.Synced || l.Title != "晴天" || l.Lang != "zh" || len(l.Lines) != 3 {
+		t.Fatalf("unexpected lyrics: %+v", l)
+	}
+	want := []lyricLine{{4623, "第一句"}, {11840, "副歌"}, {60000, "副歌"}}
+	for i, line := range l.Lines {
+		if line != want[i] {
+			t.Errorf("line %d = %+v, want %+v", i, line, want[i])
+		}
+	}
+
+	l = parseLRC("[la:ja]\n一行目\n二行目", "xxx")
+	if l.Synced || l.Lang != "ja" || len(l.Lines) != 2 || l.Lines[1].Value != "二行目" {
+		t.Fatalf("unexpected unsynced lyrics: %+v", l)
+	}
+}
+
+func TestLocalLyricsOverride(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addVideo("a", "A")
+	fake.addSubtitle("a", "ai-zh", "字幕")
+	cfg := defaultConfig()
+	router := newTestRouter(fake.client(), &cfg)
+	router.POST("/rest/uploadLyrics", UploadLyricsHandlerXML)
+	router.GET("/rest/getLyricsBySongId", GetLyricsBySongIDHandlerXML)
+
+	upload := func(query url.Values, body string) string {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/rest/uploadLyrics?"+query.Encode(), strings.NewReader(body))
+		router.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+	if body := upload(url.Values{"u": {"bob"}, "p": {"x"}, "id": {"a"}}, "[00:01.00]x"); !strings.Contains(body, `code="50"`) {
+		t.Fatalf("non-admin upload accepted: %s", body)
+	}
+	if body := upload(url.Values{"u": {"voyage"}, "p": {"141592"}, "id": {"../a"}}, "[00:01.00]x"); !strings.Contains(body, `status="failed"`) {
+		t.Fatalf("bad id accepted: %s", body)
+	}
+	if body := upload(url.Values{"u": {"voyage"}, "p": {"141592"}, "id": {"a"}, "lang": {"zh"}}, "[00:01.00]歌词"); !strings.Contains(body, `status="ok"`) {
+		t.Fatalf("upload failed: %s", body)
+	}
+
+	get := func(query url.Values) []StructuredLyricsXML {
+		w := doGet(router, "/rest/getLyricsBySongId", query)
+		var resp SubsonicResponseXML
+		if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.LyricsList == nil {
+			t.Fatalf("unexpected response: %s", w.Body)
+		}
+		return resp.LyricsList.StructuredLyrics
+	}
+	lyrics := get(url.Values{"id": {"a"}})
+	if len(lyrics) != 1 || lyrics[0].Lang != "zh" || lyrics[0].DisplayTitle != "A" || lyrics[0].Line[0].Value != "歌词" {
+		t.Fatalf("local lyrics not preferred: %+v", lyrics)
+	}
+
+	// 其他分 P 的歌词单独保存，没有时也不使用第一个分 P 的字幕
+	if lyrics := get(url.Values{"id": {"a"}, "part": {"2"}}); len(lyrics) != 0 {
+		t.Fatalf("part 2 lyrics before upload: %+v", lyrics)
+	}
+	if body := upload(url.Values{"u": {"voyage"}, "p": {"141592"}, "id": {"a"}, "part": {"2"}}, "[00:01.00]第二首"); !strings.Contains(body, `status="ok"`) {
+		t.Fatalf("part upload failed: %s", body)
+	}
+	if lyrics := get(url.Values{"id": {"a"}, "part": {"2"}}); len(lyrics) != 1 || lyrics[0].Line[0].Value != "第二首" {
+		t.Fatalf("part 2 lyrics = %+v", lyrics)
+	}
+	if lyrics := get(url.Values{"id": {"a"}}); len(lyrics) != 1 || lyrics[0].Line[0].Value != "歌词" {
+		t.Fatalf("part 1 lyrics changed: %+v", lyrics)
+	}
+	if body := upload(url.Values{"u": {"voyage"}, "p": {"141592"}, "id": {"a"}, "part": {"0"}}, "x"); !strings.Contains(body, `code="0"`) {
+		t.Fatalf("invalid part accepted: %s", body)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"log"
+	"slices"
+	"strings"
+
+	"example/subsonic/bilibili"
+)
+
+// lyricLine 是一行歌词，Start 为开始时间，单位毫秒
+type lyricLine struct {
+	Start int64
+	Value string
+}
+
+// songLyrics 是一首歌某种语言的歌词
+type songLyrics struct {
+	// Lang 为 ISO 639 语言代码，source 为 bilibili 的字幕语言，例如 "ai-zh"
+	Lang   string
+	source string
+	Artist string
+	Title  string
+	Synced bool
+	Lines  []lyricLine
+}
+
+// Text returns the lyrics as plain text, one line per line.
+func (l songLyrics) Text() string {
+	lines := make([]string, 0, len(l.Lines))
+	for _, line := range l.Lines {
+		lines = append(lines, line.Value)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// lyricsForSong returns every lyrics track of part of a song, ordered by the
+// preferred languages. Local LRC files replace the video subtitles, which are
+// only read for the first part, the one that is streamed, or the lyrics of
+// an audio song. lang, when set, keeps only that language.
+func lyricsForSong(client *bilibili.BilibiliClient, cfg LyricsConfig, m SongMeta, part int, lang string) ([]songLyrics, error) {
+	lyrics, err := localLyrics(cfg.Directory, m.ID, part)
+	if err != nil {
+		return nil, err
+	}
+	track := songInfoOf(&m.BilibiliVideo)
+	for i := range lyrics {
+		if lyrics[i].Artist == "" && lyrics[i].Title == "" {
+			lyrics[i].Artist, lyrics[i].Title = track.DisplayArtist, track.Title
+		}
+	}
+	if len(lyrics) == 0 && part == 1 {
+		if isAudioID(m.ID) {
+			lyrics, err = audioLyrics(client, m)
+		} else {
+			lyrics, err = subtitleLyrics(client, m)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if lang != "" {
+		lyrics = slices.DeleteFunc(lyrics, func(l songLyrics) bool { return l.Lang != lang && l.source != lang })
+	}
+	sortByLanguage(lyrics, cfg.Languages)
+	return lyrics, nil
+}
+
+// audioLyrics returns the LRC lyrics uploaded with an audio song.
+func audioLyrics(client *bilibili.BilibiliClient, m SongMeta) ([]songLyrics, error) {
+	sid, _ := parseAudioID(m.ID)
+	a, err := client.GetAudioInfo(sid)
+	if err != nil {
+		return nil, err
+	}
+	data, err := client.GetAudioLyric(a)
+	if err != nil || data == "" {
+		return nil, err
+	}
+
+	l := parseLRC(data, "xxx")
+	if len(l.Lines) == 0 {
+		return nil, nil
+	}
+	if l.Artist == "" && l.Title == "" {
+		track := songInfoOf(&m.BilibiliVideo)
+		l.Artist, l.Title = track.DisplayArtist, track.Title
+	}
+	return []songLyrics{l}, nil
+}
+
+// subtitleLyrics converts the subtitles of a video into synced lyrics. Music
+// videos often carry CC or AI subtitles that are effectively timed lyrics.
+func subtitleLyrics(client *bilibili.BilibiliClient, m SongMeta) ([]songLyrics, error) {
+	m, err := songMetaWithCID(client, m)
+	if err != nil {
+		return nil, err
+	}
+	if m.CID == 0 {
+		return nil, nil
+	}
+
+	subtitles, err := client.GetSubtitles(m.ID, m.CID)
+	if err != nil {
+		return nil, err
+	}
+
+	track := songInfoOf(&m.BilibiliVideo)
+	var lyrics []songLyrics
+	for _, s := range subtitles {
+		lines, err := client.GetSubtitleLines(s)
+		if err != nil {
+			log.Println("get subtitle error:", err)
+			continue
+		}
+		l := songLyrics{
+			Lang:   strings.TrimPrefix(s.Lang, "ai-"),
+			source: s.Lang,
+			Artist: track.DisplayArtist,
+			Title:  track.Title,
+			Synced: true,
+		}
+		for _, line := range lines {
+			value := strings.TrimSpace(strings.ReplaceAll(line.Content, "\n", " "))
+			if value == "" {
+				continue
+			}
+			l.Lines = append(l.Lines, lyricLine{Start: int64(line.From * 1000), Value: value})
+		}
+		if len(l.Lines) > 0 {
+			lyrics = append(lyrics, l)
+		}
+	}
+	return lyrics, nil
+}
+
+// sortByLanguage orders lyrics by their position in languages, which may
+// list either bilibili subtitle languages or ISO codes. Unlisted languages
+// keep their order at the end.
+func sortByLanguage(lyrics []songLyrics, languages []string) {
+	rank := func(l songLyrics) int {
+		for i, lang := range languages {
+			if lang == l.source || lang == l.Lang {
+				return i
+			}
+		}
+		return len(languages)
+	}
+	slices.SortStableFunc(lyrics, func(a, b songLyrics) int { return rank(a) - rank(b) })
+}
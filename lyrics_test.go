@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/url"
+	"testing"
+)
+
+func TestGetLyricsBySongID(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addVideo("a", "A")
+	fake.addSubtitle("a", "ai-zh", "第一句", "", "第二句")
+	fake.addSubtitle("a", "en-US", "first line")
+	cfg := defaultConfig()
+	router := newTestRouter(fake.client(), &cfg)
+	router.GET("/rest/getLyricsBySongId", GetLyricsBySongIDHandlerXML)
+
+	w := doGet(router, "/rest/getLyricsBySongId", url.Values{"id": {"a"}})
+	var resp SubsonicResponseXML
+	if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad xml: %v", err)
+	}
+	if resp.LyricsList == nil || len(resp.LyricsList.StructuredLyrics) != 2 {
+		t.Fatalf("unexpected lyrics: %s", w.Body)
+	}
+	// 偏好的中文字幕排在前面，空行被丢弃
+	zh := resp.LyricsList.StructuredLyrics[0]
+	if zh.Lang != "zh" || !zh.Synced || zh.DisplayTitle != "A" || len(zh.Line) != 2 {
+		t.Fatalf("unexpected lyrics: %s", w.Body)
+	}
+	if zh.Line[1].Value != "第二句" || zh.Line[1].Start == nil || *zh.Line[1].Start != 4000 {
+		t.Fatalf("unexpected line: %+v", zh.Line[1])
+	}
+
+	w = doGet(router, "/rest/getLyricsBySongId", url.Values{"id": {"a"}, "lang": {"en-US"}})
+	resp = SubsonicResponseXML{}
+	xml.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.LyricsList.StructuredLyrics) != 1 || resp.LyricsList.StructuredLyrics[0].Line[0].Value != "first line" {
+		t.Fatalf("unexpected lyrics for en-US: %s", w.Body)
+	}
+}
+
+func TestAudioSongLyrics(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addAudio(1, "晴天")
+	fake.addAudio(2, "纯音乐")
+	fake.setAudioLyric(1, "[ti:晴天]\n[00:01.50]故事的小黄花\n[00:05.00]从出生那年就飘着")
+	cfg := defaultConfig()
+	router := newTestRouter(fake.client(), &cfg)
+	router.GET("/rest/getLyricsBySongId", GetLyricsBySongIDHandlerXML)
+
+	lyrics := func(id string) []StructuredLyricsXML {
+		w := doGet(router, "/rest/getLyricsBySongId", url.Values{"id": {id}})
+		var resp SubsonicResponseXML
+		if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.LyricsList == nil {
+			t.Fatalf("unexpected response: %s", w.Body)
+		}
+		return resp.LyricsList.StructuredLyrics
+	}
+
+	l := lyrics("au1")
+	if len(l) != 1 || !l[0].Synced || l[0].DisplayTitle != "晴天" || len(l[0].Line) != 2 || *l[0].Line[0].Start != 1500 {
+		t.Fatalf("audio lyrics = %+v", l)
+	}
+	if l := lyrics("au2"); len(l) != 0 {
+		t.Fatalf("lyrics of audio without lyrics = %+v", l)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"time"
 
 	"example/subsonic/bilibili"
 
@@ -10,11 +11,54 @@ import (
 
 func main() {
 	// gin.SetMode(gin.ReleaseMode)
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalln("load config:", err)
+	}
+
+	repo, err = openRepository(cfg.Database)
+	if err != nil {
+		log.Fatalln("open database:", err)
+	}
+	defer repo.Close()
+
+	titles, err = newTitleCleaner(cfg.Titles)
+	if err != nil {
+		log.Fatalln("load title rules:", err)
+	}
+
 	client := bilibili.NewBilibiliClient()
+	client.DryRun = cfg.DryRun
+	if cfg.Cookie != "" {
+		if err := client.SetCookie(cfg.Cookie); err != nil {
+			log.Fatalln("invalid cookie:", err)
+		}
+	}
+
+	go runMetaRefresh(client, cfg.Metadata)
+
+	var starSyncer *StarSyncer
+	if cfg.StarSync.Enabled {
+		starSyncer = NewStarSyncer(client, cfg.StarSync.MediaID)
+		go starSyncer.Run(time.Duration(cfg.StarSync.Interval) * time.Second)
+	}
+
+	sinks := []scrobbleSink{newHistorySink(client, cfg.History)}
+	if cfg.ListenBrainz.URL != "" {
+		listenBrainz := newListenBrainzSink(cfg.ListenBrainz)
+		go listenBrainz.Run(time.Duration(cfg.ListenBrainz.RetryInterval) * time.Second)
+		sinks = append(sinks, listenBrainz)
+	}
+
 	router := gin.Default()
 
 	router.Use(func(c *gin.Context) {
 		c.Set("client", client)
+		c.Set("config", &cfg)
+		c.Set("scrobbleSinks", sinks)
+		if starSyncer != nil {
+			c.Set("starSync", starSyncer)
+		}
 		c.Next()
 	})
 
@@ -27,8 +71,10 @@ func main() {
 	router.GET("/rest/getCoverArt.view", getCoverArtHandler)
 	router.HEAD("/rest/getCoverArt.view", headCoverArtHandler)
 	router.GET("/rest/stream.view", streamHandler)
-	router.GET("rest/scrobble.view", PingHandler)
-	router.GET("rest/getStarred2.view", starredHandler)
+	router.GET("/rest/scrobble.view", scrobbleHandler)
+	router.GET("/rest/getNowPlaying.view", nowPlayingHandler)
+	router.GET("/rest/getStarred.view", starredHandler)
+	router.GET("/rest/getStarred2.view", starred2Handler)
 
 	// ios音流app
 	router.GET("/rest/ping", PingHandlerXML)
@@ -38,17 +84,65 @@ func main() {
 	router.GET("/rest/getSong", GetSongXML)
 	// router.HEAD("/rest/getCoverArt", headCoverArtHandler)
 	router.GET("/rest/stream", StreamHandlerXML)
-	router.GET("rest/scrobble", PingHandlerXML)
-	router.GET("/rest/getStarred", StarredHandlerXML)
+	router.GET("/rest/scrobble", ScrobbleHandlerXML)
+	router.GET("/rest/getNowPlaying", GetNowPlayingHandlerXML)
+	router.GET("/rest/getStarred", GetStarredHandlerXML)
+	router.GET("/rest/getStarred2", GetStarred2HandlerXML)
 	router.GET("/rest/star", StarHandlerXML)
 	router.GET("/rest/unstar", UnstarHandlerXML)
+	router.GET("/rest/setRating", SetRatingHandlerXML)
+	router.GET("/rest/setRating.view", SetRatingHandlerXML)
 	router.GET("/rest/getAlbumList2", StarHandlerXML)
 	router.GET("/rest/getPlaylists.view", GetPlaylistsHandlerXML)
 	router.GET("/rest/createPlaylist.view", CreatePlaylistHandlerXML)
 	router.GET("/rest/getPlaylist.view", GetPlaylistHandlerXML)
+	router.GET("/rest/updatePlaylist.view", UpdatePlaylistHandlerXML)
+	router.GET("/rest/deletePlaylist.view", DeletePlaylistHandlerXML)
+	router.GET("/rest/savePlayQueue.view", SavePlayQueueHandlerXML)
+	router.GET("/rest/getPlayQueue.view", GetPlayQueueHandlerXML)
+	router.GET("/rest/createBookmark.view", CreateBookmarkHandlerXML)
+	router.GET("/rest/getBookmarks.view", GetBookmarksHandlerXML)
+	router.GET("/rest/deleteBookmark.view", DeleteBookmarkHandlerXML)
+	router.GET("/rest/getLyrics.view", GetLyricsHandlerXML)
+	router.GET("/rest/getLyricsBySongId.view", GetLyricsBySongIDHandlerXML)
+	router.GET("/rest/getSimilarSongs.view", GetSimilarSongsHandlerXML)
+	router.GET("/rest/getSimilarSongs2.view", GetSimilarSongs2HandlerXML)
+	router.GET("/rest/getTopSongs.view", GetTopSongsHandlerXML)
+	router.GET("/rest/getMusicFolders.view", GetMusicFoldersHandlerXML)
+	router.GET("/rest/getRandomSongs.view", GetRandomSongsHandlerXML)
+	router.GET("/rest/getGenres.view", GetGenresHandlerXML)
+	router.GET("/rest/getSongsByGenre.view", GetSongsByGenreHandlerXML)
 	router.GET("/rest/getPlaylists", GetPlaylistsHandlerXML)
 	router.GET("/rest/createPlaylist", CreatePlaylistHandlerXML)
 	router.GET("/rest/getPlaylist", GetPlaylistHandlerXML)
+	router.GET("/rest/updatePlaylist", UpdatePlaylistHandlerXML)
+	router.GET("/rest/deletePlaylist", DeletePlaylistHandlerXML)
+	router.GET("/rest/savePlayQueue", SavePlayQueueHandlerXML)
+	router.GET("/rest/getPlayQueue", GetPlayQueueHandlerXML)
+	router.GET("/rest/createBookmark", CreateBookmarkHandlerXML)
+	router.GET("/rest/getBookmarks", GetBookmarksHandlerXML)
+	router.GET("/rest/deleteBookmark", DeleteBookmarkHandlerXML)
+	router.GET("/rest/getLyrics", GetLyricsHandlerXML)
+	router.GET("/rest/getSimilarSongs", GetSimilarSongsHandlerXML)
+	router.GET("/rest/getSimilarSongs2", GetSimilarSongs2HandlerXML)
+	router.GET("/rest/getTopSongs", GetTopSongsHandlerXML)
+	router.GET("/rest/getMusicFolders", GetMusicFoldersHandlerXML)
+	router.GET("/rest/getRandomSongs", GetRandomSongsHandlerXML)
+	router.GET("/rest/getGenres", GetGenresHandlerXML)
+	router.GET("/rest/getSongsByGenre", GetSongsByGenreHandlerXML)
+	router.POST("/rest/uploadLyrics", UploadLyricsHandlerXML)
+	router.POST("/rest/uploadLyrics.view", UploadLyricsHandlerXML)
+	router.GET("/rest/getLyricsBySongId", GetLyricsBySongIDHandlerXML)
+
+	// 管理接口，返回 JSON
+	router.GET("/rest/getSongOverrides", getSongOverridesHandler)
+	router.GET("/rest/getSongOverrides.view", getSongOverridesHandler)
+	router.POST("/rest/setSongOverride", setSongOverrideHandler)
+	router.POST("/rest/setSongOverride.view", setSongOverrideHandler)
+	router.GET("/rest/deleteSongOverride", deleteSongOverrideHandler)
+	router.GET("/rest/deleteSongOverride.view", deleteSongOverrideHandler)
+	router.POST("/rest/importSongOverrides", importSongOverridesHandler)
+	router.POST("/rest/importSongOverrides.view", importSongOverridesHandler)
 
 	log.Println("OpenSubsonic proxy running at :8080")
 	router.Run()
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// songOverride returns the manual override of song id, if any.
+func songOverride(id string) SongOverride {
+	if repo == nil {
+		return SongOverride{}
+	}
+	o, _, err := repo.SongOverride(id)
+	if err != nil {
+		log.Println("get song override error:", err)
+	}
+	return o
+}
+
+// validate checks the fields of an override set through the API.
+func (o SongOverride) validate() error {
+	if o.ID == "" {
+		return errors.New("missing id")
+	}
+	if o.Track < 0 {
+		return fmt.Errorf("invalid track: %d", o.Track)
+	}
+	if o.Year < 0 {
+		return fmt.Errorf("invalid year: %d", o.Year)
+	}
+	return nil
+}
+
+// overrideCSVColumns 是 CSV 导入支持的列，第一行为表头，id 列必须存在
+var overrideCSVColumns = []string{"id", "title", "artist", "album", "track", "year", "genre", "coverArt"}
+
+// parseOverridesCSV reads overrides from CSV with a header row naming the
+// columns. Every row replaces the whole override of its song; a row with
+// only an id clears it.
+func parseOverridesCSV(r io.Reader) ([]SongOverride, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %v", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		known := false
+		for _, c := range overrideCSVColumns {
+			if strings.EqualFold(name, c) {
+				columns[c], known = i, true
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown column: %s", name)
+		}
+	}
+	if _, ok := columns["id"]; !ok {
+		return nil, errors.New("missing id column")
+	}
+
+	var overrides []SongOverride
+	now := time.Now()
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return overrides, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		field := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		number := func(name string) (int, error) {
+			s := field(name)
+			if s == "" {
+				return 0, nil
+			}
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return 0, fmt.Errorf("line %d: invalid %s: %s", line, name, s)
+			}
+			return n, nil
+		}
+
+		o := SongOverride{
+			ID:       field("id"),
+			Title:    field("title"),
+			Artist:   field("artist"),
+			Album:    field("album"),
+			Genre:    field("genre"),
+			CoverArt: field("coverArt"),
+			Updated:  now,
+		}
+		if o.Track, err = number("track"); err != nil {
+			return nil, err
+		}
+		if o.Year, err = number("year"); err != nil {
+			return nil, err
+		}
+		if err := o.validate(); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		overrides = append(overrides, o)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSongOverrides(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addVideo("a", "【4K】周杰伦《晴天》Live")
+	fake.addVideo("b", "b")
+	starSong("a")
+	cfg := defaultConfig()
+	router := newTestRouter(fake.client(), &cfg)
+	router.GET("/rest/getSong", GetSongXML)
+	router.GET("/rest/getGenres", GetGenresHandlerXML)
+	router.GET("/rest/getSongOverrides", getSongOverridesHandler)
+	router.POST("/rest/setSongOverride", setSongOverrideHandler)
+	router.GET("/rest/deleteSongOverride", deleteSongOverrideHandler)
+	router.POST("/rest/importSongOverrides", importSongOverridesHandler)
+
+	admin := url.Values{"u": {"voyage"}, "p": {"141592"}}
+	post := func(path string, query url.Values, body string) Response {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", path+"?"+query.Encode(), strings.NewReader(body)))
+		var resp Response
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("bad json: %v", err)
+		}
+		return resp
+	}
+	song := func(id string) *SongXML {
+		var resp SubsonicResponseXML
+		if err := xml.Unmarshal(doGet(router, "/rest/getSong", url.Values{"id": {id}}).Body.Bytes(), &resp); err != nil {
+			t.Fatalf("bad xml: %v", err)
+		}
+		return resp.Song
+	}
+
+	if resp := post("/rest/setSongOverride", url.Values{"u": {"bob"}}, `{"id":"a"}`); resp.SubsonicResponse.Status != "failed" {
+		t.Fatalf("non-admin override accepted: %+v", resp)
+	}
+	if resp := post("/rest/setSongOverride", admin, `{"id":"a","year":-1}`); resp.SubsonicResponse.Status != "failed" {
+		t.Fatalf("invalid override accepted: %+v", resp)
+	}
+	resp := post("/rest/setSongOverride", admin, `{"id":"a","title":"晴天","artist":"周杰伦 & 费玉清","album":"叶惠美","track":3,"year":2003,"genre":"流行","coverArt":"http://cover"}`)
+	if o := resp.SubsonicResponse.SongOverrides; o == nil || len(o.Override) != 1 || o.Override[0].Updated.IsZero() {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	s := song("a")
+	if s.Title != "晴天" || s.Artist != "周杰伦" || s.DisplayArtist != "周杰伦 & 费玉清" || s.Album != "叶惠美" || s.Track != 3 || s.Year != 2003 || s.Genre != "流行" || s.CoverArt != "http://cover" {
+		t.Fatalf("override not applied: %+v", s)
+	}
+	var genres SubsonicResponseXML
+	xml.Unmarshal(doGet(router, "/rest/getGenres", nil).Body.Bytes(), &genres)
+	if last := genres.Genres.Genre[len(genres.Genres.Genre)-1]; last.Value != "流行" || last.SongCount != 1 {
+		t.Fatalf("override genre not listed: %+v", last)
+	}
+
+	// CSV 的每一行替换整条修正，只有 id 时清除
+	csv := "id,title,track\nb,B 的歌名,1\na,,\n"
+	resp = post("/rest/importSongOverrides", admin, csv)
+	if o := resp.SubsonicResponse.SongOverrides; o == nil || len(o.Override) != 2 {
+		t.Fatalf("unexpected import response: %+v", resp)
+	}
+	// 只修正歌名时默认的专辑名也跟着改
+	if s := song("b"); s.Title != "B 的歌名" || s.Album != "B 的歌名" || s.Track != 1 {
+		t.Fatalf("imported override not applied: %+v", s)
+	}
+	if s := song("a"); s.Title != "晴天" || s.Artist != "周杰伦" || s.Album != "晴天" || s.Track != 1 {
+		t.Fatalf("override not cleared: %+v", s)
+	}
+	if resp := post("/rest/importSongOverrides", admin, "id,year\nb,abc\n"); resp.SubsonicResponse.Status != "failed" {
+		t.Fatalf("invalid csv accepted: %+v", resp)
+	}
+
+	doGet(router, "/rest/deleteSongOverride", url.Values{"id": {"b"}, "u": {"voyage"}, "p": {"141592"}})
+	w := doGet(router, "/rest/getSongOverrides", admin)
+	var list Response
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("bad json: %v", err)
+	}
+	if o := list.SubsonicResponse.SongOverrides; o == nil || len(o.Override) != 0 {
+		t.Fatalf("overrides left: %s", w.Body)
+	}
+}
@@ -1,70 +1,225 @@
 package main
 
 import (
-	"encoding/json"
-	"os"
-	"sync"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"example/subsonic/bilibili"
+)
+
+const (
+	// PlaylistKindBili 指向 bilibili 收藏夹的歌单，歌曲列表来自上游，只读
+	PlaylistKindBili = "bili"
+	// PlaylistKindLocal 本地歌单，歌曲 ID 有序保存在数据库中
+	PlaylistKindLocal = "local"
 )
 
+var errPlaylistNotFound = fmt.Errorf("playlist not found")
+var errPlaylistReadOnly = fmt.Errorf("playlist is read-only")
+var errAudioInFolder = fmt.Errorf("audio songs cannot be added to a favorite folder")
+
 type PlaylistInfo struct {
-	ID      string `json:"id"`
-	Name    string `json:"name"`
-	MediaID string `json:"mediaId"`
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	MediaID string    `json:"mediaId,omitempty"`
+	Kind    string    `json:"kind,omitempty"`
+	Comment string    `json:"comment,omitempty"`
+	Public  bool      `json:"public"`
+	SongIDs []string  `json:"songIds,omitempty"`
+	Created time.Time `json:"created"`
+	Changed time.Time `json:"changed"`
 }
 
-var (
-	playlists     []PlaylistInfo
-	playlistsOnce sync.Once
-	playlistsMu   sync.Mutex
-)
+// IsBili reports whether the playlist is backed by a bilibili favorite folder.
+func (p *PlaylistInfo) IsBili() bool {
+	return p.Kind == PlaylistKindBili
+}
 
-func loadPlaylists() error {
-	playlistsOnce.Do(func() {
-		playlists = make([]PlaylistInfo, 0)
-		f, err := os.Open("playlists.dat")
-		if os.IsNotExist(err) {
-			return
-		}
-		if err != nil {
-			return
-		}
-		defer f.Close()
-		json.NewDecoder(f).Decode(&playlists)
-	})
-	return nil
+// IsMenu reports whether the playlist is backed by an audio menu.
+func (p *PlaylistInfo) IsMenu() bool {
+	return p.Kind == PlaylistKindMenu
 }
 
-func getPlaylists() ([]PlaylistInfo, error) {
-	playlistsMu.Lock()
-	defer playlistsMu.Unlock()
+// PlaylistUpdate describes the changes requested by updatePlaylist.
+type PlaylistUpdate struct {
+	Name              *string
+	Comment           *string
+	Public            *bool
+	SongIDsToAdd      []string
+	SongIndexToRemove []int
+}
 
-	if err := loadPlaylists(); err != nil {
-		return nil, err
-	}
-	return playlists, nil
+func newPlaylistID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return "local-" + hex.EncodeToString(b)
 }
 
-func createPlaylist(name string, mediaId string) (string, error) {
-	playlistsMu.Lock()
-	defer playlistsMu.Unlock()
+func getPlaylists() ([]PlaylistInfo, error) {
+	return repo.Playlists()
+}
 
-	if err := loadPlaylists(); err != nil {
-		return "", err
-	}
+// getPlaylist returns the playlist with the given ID.
+func getPlaylist(id string) (PlaylistInfo, error) {
+	return repo.Playlist(id)
+}
 
+func createPlaylist(name string, mediaId string) (string, error) {
+	now := time.Now()
 	newPlaylist := PlaylistInfo{
 		ID:      "bili-" + mediaId,
 		Name:    name,
 		MediaID: mediaId,
+		Kind:    PlaylistKindBili,
+		Public:  true,
+		Created: now,
+		Changed: now,
 	}
 
-	playlists = append(playlists, newPlaylist)
+	return newPlaylist.ID, repo.CreatePlaylist(newPlaylist)
+}
 
-	f, err := os.Create("playlists.dat")
+// createLocalPlaylist creates a local playlist holding the given songs in order.
+func createLocalPlaylist(name string, songIDs []string) (PlaylistInfo, error) {
+	now := time.Now()
+	newPlaylist := PlaylistInfo{
+		ID:      newPlaylistID(),
+		Name:    name,
+		Kind:    PlaylistKindLocal,
+		SongIDs: append([]string{}, songIDs...),
+		Created: now,
+		Changed: now,
+	}
+
+	return newPlaylist, repo.CreatePlaylist(newPlaylist)
+}
+
+// replacePlaylistSongs overwrites the song list of a local playlist,
+// as createPlaylist does when called with an existing playlistId.
+func replacePlaylistSongs(id string, name string, songIDs []string) (PlaylistInfo, error) {
+	return repo.UpdatePlaylist(id, func(p *PlaylistInfo) error {
+		if p.IsBili() || p.IsMenu() {
+			return errPlaylistReadOnly
+		}
+		if name != "" {
+			p.Name = name
+		}
+		p.SongIDs = append([]string{}, songIDs...)
+		p.Changed = time.Now()
+		return nil
+	})
+}
+
+// updatePlaylist applies an updatePlaylist request. Indexes to remove refer
+// to the song list before any song is added. Bilibili playlists only accept
+// metadata changes, as do audio menus.
+func updatePlaylist(id string, u PlaylistUpdate) (PlaylistInfo, error) {
+	return repo.UpdatePlaylist(id, func(p *PlaylistInfo) error {
+		if (p.IsBili() || p.IsMenu()) && (len(u.SongIDsToAdd) > 0 || len(u.SongIndexToRemove) > 0) {
+			return errPlaylistReadOnly
+		}
+		if u.Name != nil {
+			p.Name = *u.Name
+		}
+		if u.Comment != nil {
+			p.Comment = *u.Comment
+		}
+		if u.Public != nil {
+			p.Public = *u.Public
+		}
+		p.SongIDs = removeIndexes(p.SongIDs, u.SongIndexToRemove)
+		p.SongIDs = append(p.SongIDs, u.SongIDsToAdd...)
+		p.Changed = time.Now()
+		return nil
+	})
+}
+
+// deletePlaylist removes a playlist. For bilibili playlists only the local
+// reference is dropped; the favorite folder itself is left untouched.
+func deletePlaylist(id string) error {
+	return repo.DeletePlaylist(id)
+}
+
+// removeIndexes returns songs without the entries at the given indexes.
+// Out of range and duplicate indexes are ignored.
+func removeIndexes(songs []string, indexes []int) []string {
+	if len(indexes) == 0 {
+		return songs
+	}
+	drop := make(map[int]bool, len(indexes))
+	for _, i := range indexes {
+		drop[i] = true
+	}
+
+	result := make([]string, 0, len(songs))
+	for i, id := range songs {
+		if !drop[i] {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// updateBiliPlaylist writes the song changes of u through to the favorite
+// folder behind p. Indexes refer to the current order of the folder.
+func updateBiliPlaylist(client *bilibili.BilibiliClient, p *PlaylistInfo, u PlaylistUpdate) error {
+	if len(u.SongIndexToRemove) > 0 {
+		videos, err := client.GetFavoriteList(p.MediaID)
+		if err != nil {
+			return err
+		}
+		seen := map[int]bool{}
+		var aids []int
+		for _, i := range u.SongIndexToRemove {
+			if i < 0 || i >= len(videos) || seen[i] {
+				continue
+			}
+			seen[i] = true
+			aids = append(aids, videos[i].AVID)
+		}
+		if len(aids) > 0 {
+			if err := client.BatchDelFavResource(p.MediaID, aids); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, id := range u.SongIDsToAdd {
+		if isAudioID(id) {
+			return errAudioInFolder
+		}
+		video, err := client.GetVideoInfo(id)
+		if err != nil {
+			return err
+		}
+		if err := client.DealFavResource(video.AVID, []string{p.MediaID}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createBiliFolderPlaylist creates a new favorite folder holding songIDs and
+// links it as a playlist. In dry-run mode no folder is created, so a local
+// playlist is returned instead.
+func createBiliFolderPlaylist(client *bilibili.BilibiliClient, name string, songIDs []string) (PlaylistInfo, error) {
+	mediaId, err := client.AddFavFolder(name, "", false)
 	if err != nil {
-		return "", err
+		return PlaylistInfo{}, err
+	}
+	if mediaId == "" {
+		return createLocalPlaylist(name, songIDs)
 	}
-	defer f.Close()
 
-	return newPlaylist.ID, json.NewEncoder(f).Encode(playlists)
+	id, err := createPlaylist(name, mediaId)
+	if err != nil {
+		return PlaylistInfo{}, err
+	}
+	p, err := getPlaylist(id)
+	if err != nil {
+		return PlaylistInfo{}, err
+	}
+	return p, updateBiliPlaylist(client, &p, PlaylistUpdate{SongIDsToAdd: songIDs})
 }
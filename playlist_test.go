@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"example/subsonic/bilibili"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRemoveIndexes(t *testing.T) {
+	songs := []string{"a", "b", "c", "d"}
+	got := removeIndexes(songs, []int{3, 1, 1, 9})
+	want := []string{"a", "c"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("removeIndexes = %v, want %v", got, want)
+	}
+}
+
+func TestUpdateLocalPlaylist(t *testing.T) {
+	useTestRepo(t)
+
+	p, err := createLocalPlaylist("mix", []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatalf("createLocalPlaylist failed: %v", err)
+	}
+
+	name := "renamed"
+	public := true
+	_, err = updatePlaylist(p.ID, PlaylistUpdate{
+		Name:              &name,
+		Public:            &public,
+		SongIDsToAdd:      []string{"d"},
+		SongIndexToRemove: []int{0},
+	})
+	if err != nil {
+		t.Fatalf("updatePlaylist failed: %v", err)
+	}
+
+	got, err := getPlaylist(p.ID)
+	if err != nil {
+		t.Fatalf("getPlaylist failed: %v", err)
+	}
+	if got.Name != "renamed" || !got.Public {
+		t.Fatalf("metadata not updated: %+v", got)
+	}
+	if want := []string{"b", "c", "d"}; !reflect.DeepEqual(got.SongIDs, want) {
+		t.Fatalf("SongIDs = %v, want %v", got.SongIDs, want)
+	}
+
+	if err := deletePlaylist(p.ID); err != nil {
+		t.Fatalf("deletePlaylist failed: %v", err)
+	}
+	if _, err := getPlaylist(p.ID); err != errPlaylistNotFound {
+		t.Fatalf("getPlaylist after delete = %v, want errPlaylistNotFound", err)
+	}
+}
+
+func TestBiliPlaylistIsReadOnly(t *testing.T) {
+	useTestRepo(t)
+
+	id, err := createPlaylist("fav", "12345")
+	if err != nil {
+		t.Fatalf("createPlaylist failed: %v", err)
+	}
+	if _, err := updatePlaylist(id, PlaylistUpdate{SongIDsToAdd: []string{"a"}}); err != errPlaylistReadOnly {
+		t.Fatalf("updatePlaylist = %v, want errPlaylistReadOnly", err)
+	}
+
+	comment := "from bilibili"
+	if _, err := updatePlaylist(id, PlaylistUpdate{Comment: &comment}); err != nil {
+		t.Fatalf("updatePlaylist comment failed: %v", err)
+	}
+}
+
+func newPlaylistRouter(client *bilibili.BilibiliClient, cfg *Config) *gin.Engine {
+	router := newTestRouter(client, cfg)
+	router.GET("/rest/createPlaylist", CreatePlaylistHandlerXML)
+	router.GET("/rest/updatePlaylist", UpdatePlaylistHandlerXML)
+	return router
+}
+
+func TestUpdateBiliPlaylistWriteThrough(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addVideo("a", "A")
+	fake.addVideo("b", "B")
+	fake.addVideo("c", "C")
+	fake.folders["100"] = []string{"a", "b"}
+
+	if _, err := createPlaylist("fav", "100"); err != nil {
+		t.Fatalf("createPlaylist failed: %v", err)
+	}
+
+	cfg := defaultConfig()
+	cfg.Playlists.WriteThrough = true
+	router := newPlaylistRouter(fake.client(), &cfg)
+
+	w := doGet(router, "/rest/updatePlaylist", url.Values{
+		"playlistId":        {"bili-100"},
+		"songIdToAdd":       {"c"},
+		"songIndexToRemove": {"0"},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("updatePlaylist status = %d, body %s", w.Code, w.Body)
+	}
+	if got, want := fake.folder("100"), []string{"c", "b"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("folder = %v, want %v", got, want)
+	}
+}
+
+func TestCreatePlaylistCreatesFolder(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addVideo("a", "A")
+
+	cfg := defaultConfig()
+	cfg.Playlists.WriteThrough = true
+	router := newPlaylistRouter(fake.client(), &cfg)
+
+	w := doGet(router, "/rest/createPlaylist", url.Values{"name": {"Mix"}, "songId": {"a"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("createPlaylist status = %d, body %s", w.Code, w.Body)
+	}
+
+	p, err := getPlaylist("bili-1001")
+	if err != nil {
+		t.Fatalf("getPlaylist failed: %v", err)
+	}
+	if p.Name != "Mix" || !p.IsBili() {
+		t.Fatalf("unexpected playlist %+v", p)
+	}
+	if got, want := fake.folder("1001"), []string{"a"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("folder = %v, want %v", got, want)
+	}
+}
+
+func TestWriteThroughDryRun(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addVideo("a", "A")
+	fake.folders["100"] = []string{}
+	createPlaylist("fav", "100")
+
+	cfg := defaultConfig()
+	cfg.Playlists.WriteThrough = true
+	client := fake.client()
+	client.DryRun = true
+	router := newPlaylistRouter(client, &cfg)
+
+	w := doGet(router, "/rest/updatePlaylist", url.Values{"playlistId": {"bili-100"}, "songIdToAdd": {"a"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("updatePlaylist status = %d, body %s", w.Code, w.Body)
+	}
+	w = doGet(router, "/rest/createPlaylist", url.Values{"name": {"Mix"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("createPlaylist status = %d, body %s", w.Code, w.Body)
+	}
+
+	if n := fake.postCount(); n != 0 {
+		t.Fatalf("dry run sent %d write requests", n)
+	}
+	if got := fake.folder("100"); len(got) != 0 {
+		t.Fatalf("folder = %v, want empty", got)
+	}
+}
+
+func TestLocalPlaylistUsesSongCache(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addVideo("a", "A")
+	fake.addVideo("b", "B")
+	cfg := defaultConfig()
+	router := newPlaylistRouter(fake.client(), &cfg)
+	router.GET("/rest/getPlaylist", GetPlaylistHandlerXML)
+
+	p, err := createLocalPlaylist("mix", []string{"a", "gone", "b"})
+	if err != nil {
+		t.Fatalf("createLocalPlaylist failed: %v", err)
+	}
+	entries := func() []string {
+		var resp SubsonicResponseXML
+		w := doGet(router, "/rest/getPlaylist", url.Values{"id": {p.ID}})
+		if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Playlist == nil {
+			t.Fatalf("unexpected response: %s", w.Body)
+		}
+		var ids []string
+		for _, e := range resp.Playlist.Entry {
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+
+	// 无法获取的歌曲保留占位
+	if ids := entries(); !reflect.DeepEqual(ids, []string{"a", "gone", "b"}) {
+		t.Fatalf("entries = %v", ids)
+	}
+	views := fake.viewCount()
+	entries()
+	if n := fake.viewCount(); n != views {
+		t.Fatalf("cached playlist made %d upstream calls", n-views)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+var errBookmarkNotFound = fmt.Errorf("bookmark not found")
+
+// savePlayQueue replaces the play queue of user. current defaults to the first
+// song and must be one of ids. An empty ids clears the queue.
+func savePlayQueue(user string, client string, ids []string, current string, position int64) error {
+	if current == "" && len(ids) > 0 {
+		current = ids[0]
+	}
+	if current != "" && !slices.Contains(ids, current) {
+		return fmt.Errorf("current song %s is not in the queue", current)
+	}
+	return repo.SavePlayQueue(PlayQueue{
+		User:      user,
+		SongIDs:   ids,
+		Current:   current,
+		Position:  position,
+		Changed:   time.Now(),
+		ChangedBy: client,
+	})
+}
+
+// createBookmark creates or updates the bookmark of user in song id.
+func createBookmark(user string, id string, position int64, comment string) error {
+	now := time.Now()
+	return repo.SaveBookmark(Bookmark{
+		User:     user,
+		ID:       id,
+		Position: position,
+		Comment:  comment,
+		Created:  now,
+		Changed:  now,
+	})
+}
+
+// deleteBookmark removes the bookmark of user in song id.
+func deleteBookmark(user string, id string) error {
+	bookmarks, err := repo.Bookmarks(user)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(bookmarks, func(b Bookmark) bool { return b.ID == id }) {
+		return errBookmarkNotFound
+	}
+	return repo.DeleteBookmark(user, id)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newPlayQueueRouter(fake *fakeBilibili) *gin.Engine {
+	cfg := defaultConfig()
+	router := newTestRouter(fake.client(), &cfg)
+	router.GET("/rest/savePlayQueue", SavePlayQueueHandlerXML)
+	router.GET("/rest/getPlayQueue", GetPlayQueueHandlerXML)
+	router.GET("/rest/createBookmark", CreateBookmarkHandlerXML)
+	router.GET("/rest/getBookmarks", GetBookmarksHandlerXML)
+	router.GET("/rest/deleteBookmark", DeleteBookmarkHandlerXML)
+	return router
+}
+
+func TestPlayQueue(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addVideo("a", "A")
+	fake.addVideo("b", "B")
+	router := newPlayQueueRouter(fake)
+
+	w := doGet(router, "/rest/savePlayQueue", url.Values{"u": {"alice"}, "c": {"phone"}, "id": {"a", "b"}, "current": {"b"}, "position": {"4200000"}})
+	if !strings.Contains(w.Body.String(), `status="ok"`) {
+		t.Fatalf("savePlayQueue failed: %s", w.Body)
+	}
+
+	w = doGet(router, "/rest/getPlayQueue", url.Values{"u": {"alice"}, "c": {"desktop"}})
+	var resp SubsonicResponseXML
+	if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad xml: %v", err)
+	}
+	q := resp.PlayQueue
+	if q == nil || q.Current != "b" || q.Position != 4200000 || q.ChangedBy != "phone" || len(q.Entry) != 2 || q.Entry[1].Title != "B" {
+		t.Fatalf("unexpected play queue: %s", w.Body)
+	}
+
+	// 其他用户的队列是独立的
+	w = doGet(router, "/rest/getPlayQueue", url.Values{"u": {"bob"}})
+	if strings.Contains(w.Body.String(), "playQueue") {
+		t.Fatalf("bob got a play queue: %s", w.Body)
+	}
+
+	w = doGet(router, "/rest/savePlayQueue", url.Values{"u": {"alice"}, "id": {"a"}, "current": {"b"}})
+	if !strings.Contains(w.Body.String(), `status="failed"`) {
+		t.Fatalf("current outside the queue accepted: %s", w.Body)
+	}
+
+	doGet(router, "/rest/savePlayQueue", url.Values{"u": {"alice"}})
+	if _, ok, _ := repo.PlayQueue("alice"); ok {
+		t.Fatal("empty savePlayQueue did not clear the queue")
+	}
+}
+
+func TestBookmarks(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addVideo("a", "A")
+	router := newPlayQueueRouter(fake)
+
+	doGet(router, "/rest/createBookmark", url.Values{"u": {"alice"}, "id": {"a"}, "position": {"1000"}, "comment": {"第一讲"}})
+	created, _ := repo.Bookmarks("alice")
+	doGet(router, "/rest/createBookmark", url.Values{"u": {"alice"}, "id": {"a"}, "position": {"5000"}})
+
+	w := doGet(router, "/rest/getBookmarks", url.Values{"u": {"alice"}})
+	var resp SubsonicResponseXML
+	if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad xml: %v", err)
+	}
+	if resp.Bookmarks == nil || len(resp.Bookmarks.Bookmark) != 1 {
+		t.Fatalf("unexpected bookmarks: %s", w.Body)
+	}
+	b := resp.Bookmarks.Bookmark[0]
+	if b.Position != 5000 || b.Entry.ID != "a" || b.Created != formatTime(created[0].Created) {
+		t.Fatalf("unexpected bookmark: %s", w.Body)
+	}
+
+	w = doGet(router, "/rest/getBookmarks", url.Values{"u": {"bob"}})
+	if strings.Contains(w.Body.String(), "<bookmark ") {
+		t.Fatalf("bob got alice's bookmark: %s", w.Body)
+	}
+
+	w = doGet(router, "/rest/deleteBookmark", url.Values{"u": {"bob"}, "id": {"a"}})
+	if !strings.Contains(w.Body.String(), `code="70"`) {
+		t.Fatalf("expected not found: %s", w.Body)
+	}
+	doGet(router, "/rest/deleteBookmark", url.Values{"u": {"alice"}, "id": {"a"}})
+	if bookmarks, _ := repo.Bookmarks("alice"); len(bookmarks) != 0 {
+		t.Fatalf("bookmarks after delete = %+v", bookmarks)
+	}
+}
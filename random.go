@@ -0,0 +1,121 @@
+package main
+
+import (
+	"log"
+	"math/rand/v2"
+	"slices"
+
+	"example/subsonic/bilibili"
+)
+
+// 只有一个音乐文件夹，即 bilibili
+const (
+	musicFolderID   = "1"
+	musicFolderName = "Bilibili"
+)
+
+// randomHistoryLimit 是随机歌曲从播放历史中取的最近播放数
+const randomHistoryLimit = 1000
+
+// randomFilter 是 getRandomSongs 的过滤条件，零值表示不过滤
+type randomFilter struct {
+	Genre    string
+	FromYear int
+	ToYear   int
+	// TagGenres 是作为流派的标签，见 GenresConfig
+	TagGenres []string
+}
+
+// match reports whether m passes the filter. Songs without a known publish
+// date never pass a year filter.
+func (f randomFilter) match(m *SongMeta) bool {
+	if m.Unavailable {
+		return false
+	}
+	if f.Genre != "" && !slices.Contains(songGenres(m, f.TagGenres), f.Genre) {
+		return false
+	}
+	if f.FromYear != 0 || f.ToYear != 0 {
+		if m.Pubdate.IsZero() {
+			return false
+		}
+		year := m.Pubdate.In(bilibiliZone).Year()
+		if f.FromYear != 0 && year < f.FromYear || f.ToYear != 0 && year > f.ToYear {
+			return false
+		}
+	}
+	return true
+}
+
+// librarySongIDs returns the songs of the local library: starred songs, songs
+// of local playlists and recently played songs.
+func librarySongIDs() ([]string, error) {
+	var ids []string
+	stars, err := getStarredSongs()
+	if err != nil {
+		return nil, err
+	}
+	ids = append(ids, stars...)
+
+	playlists, err := getPlaylists()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range playlists {
+		ids = append(ids, p.SongIDs...)
+	}
+
+	plays, err := repo.RecentPlays("", randomHistoryLimit)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range plays {
+		ids = append(ids, p.ID)
+	}
+
+	slices.Sort(ids)
+	return slices.Compact(ids), nil
+}
+
+// randomSongs returns up to size random songs of the library that pass f,
+// topped up from the music ranking when enabled.
+func randomSongs(client *bilibili.BilibiliClient, cfg *Config, size int, f randomFilter) ([]SongMeta, error) {
+	ids, err := librarySongIDs()
+	if err != nil {
+		return nil, err
+	}
+	rand.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+
+	var result []SongMeta
+	seen := map[string]bool{}
+	// 每次只查 size 首的元数据，避免过滤前取回整个曲库
+	for len(ids) > 0 && len(result) < size {
+		chunk := ids[:min(size, len(ids))]
+		ids = ids[len(chunk):]
+		for _, m := range lookupSongMetas(client, chunk, cfg.Metadata.Concurrency) {
+			seen[m.ID] = true
+			if len(result) < size && f.match(&m) {
+				result = append(result, m)
+			}
+		}
+	}
+
+	if len(result) < size && cfg.RandomSongs.RankingTopUp {
+		ranking, err := client.GetRanking(musicTID)
+		if err != nil {
+			log.Println("get ranking error:", err)
+			return result, nil
+		}
+		rand.Shuffle(len(ranking), func(i, j int) { ranking[i], ranking[j] = ranking[j], ranking[i] })
+		for _, v := range ranking {
+			m := SongMeta{BilibiliVideo: v}
+			if len(result) < size && !seen[v.ID] && f.match(&m) {
+				result = append(result, m)
+				if err := saveVideoMeta(&v); err != nil {
+					log.Println("save song meta error:", err)
+				}
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestGetRandomSongs(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	for _, id := range []string{"starred", "listed", "played", "ranked"} {
+		fake.addVideo(id, id)
+		fake.updateVideo(id, func(v *fakeVideo) { v.Pubdate = time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC).Unix() })
+	}
+	fake.updateVideo("listed", func(v *fakeVideo) { v.TID = 28 })
+	fake.updateVideo("played", func(v *fakeVideo) { v.Pubdate = time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC).Unix() })
+	fake.ranking = []string{"starred", "ranked"}
+
+	starSong("starred")
+	createLocalPlaylist("list", []string{"listed"})
+	repo.AddPlay(Play{ID: "played", User: "alice", Time: time.Now()})
+
+	cfg := defaultConfig()
+	router := newTestRouter(fake.client(), &cfg)
+	router.GET("/rest/getRandomSongs", GetRandomSongsHandlerXML)
+	random := func(query url.Values) []string {
+		w := doGet(router, "/rest/getRandomSongs", query)
+		var resp SubsonicResponseXML
+		if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("bad xml: %v", err)
+		}
+		if resp.RandomSongs == nil {
+			t.Fatalf("unexpected response: %s", w.Body)
+		}
+		var ids []string
+		for _, s := range resp.RandomSongs.Song {
+			ids = append(ids, s.ID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+
+	if ids := random(nil); !slices.Equal(ids, []string{"listed", "played", "starred"}) {
+		t.Fatalf("random songs = %v", ids)
+	}
+	if ids := random(url.Values{"size": {"2"}}); len(ids) != 2 {
+		t.Fatalf("random songs with size = %v", ids)
+	}
+	if ids := random(url.Values{"genre": {"原创音乐"}}); !slices.Equal(ids, []string{"listed"}) {
+		t.Fatalf("random songs by genre = %v", ids)
+	}
+	if ids := random(url.Values{"fromYear": {"2010"}, "toYear": {"2016"}}); !slices.Equal(ids, []string{"played"}) {
+		t.Fatalf("random songs by year = %v", ids)
+	}
+	if ids := random(url.Values{"musicFolderId": {"2"}}); len(ids) != 0 {
+		t.Fatalf("random songs of another folder = %v", ids)
+	}
+
+	cfg.RandomSongs.RankingTopUp = true
+	if ids := random(url.Values{"size": {"5"}}); !slices.Equal(ids, []string{"listed", "played", "ranked", "starred"}) {
+		t.Fatalf("random songs topped up = %v", ids)
+	}
+}
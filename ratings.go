@@ -0,0 +1,73 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"example/subsonic/bilibili"
+)
+
+// setRating stores the rating user gave to a song, album or artist. When
+// enabled and logged in, song ratings are mirrored on bilibili: reaching
+// LikeAt likes the video, dropping below it removes the like, and the first
+// 5-star rating adds a coin. Coins cannot be taken back, so a song is only
+// given one however often it is rated 5 again.
+func setRating(client *bilibili.BilibiliClient, cfg *Config, user string, id string, rating int) error {
+	old, err := repo.UserRating(user, id)
+	if err != nil {
+		return err
+	}
+	if err := repo.SetRating(user, id, rating); err != nil {
+		return err
+	}
+
+	if !cfg.Ratings.BilibiliActions || client.CSRF() == "" {
+		return nil
+	}
+	if strings.HasPrefix(id, artistIDPrefix) || strings.HasPrefix(id, albumIDPrefix) {
+		return nil
+	}
+	aid := lookupSongMetas(client, []string{id}, 1)[0].AVID
+	if aid == 0 {
+		return nil
+	}
+
+	likeAt := cfg.Ratings.LikeAt
+	if old < likeAt && rating >= likeAt {
+		if err := client.LikeVideo(aid, true); err != nil {
+			log.Println("like error:", err)
+		}
+	} else if old >= likeAt && rating < likeAt {
+		if err := client.LikeVideo(aid, false); err != nil {
+			log.Println("unlike error:", err)
+		}
+	}
+	if rating == 5 && old != 5 {
+		given, err := repo.CoinGiven(id)
+		if err != nil {
+			return err
+		}
+		if given {
+			return nil
+		}
+		if err := client.AddCoin(aid, 1); err != nil {
+			log.Println("add coin error:", err)
+			return nil
+		}
+		return repo.MarkCoinGiven(id)
+	}
+	return nil
+}
+
+// ratingsOf returns the rating of user and the average rating of id.
+func ratingsOf(user string, id string) (int, float64) {
+	rating, err := repo.UserRating(user, id)
+	if err != nil {
+		log.Println("get rating error:", err)
+	}
+	average, err := repo.AverageRating(id)
+	if err != nil {
+		log.Println("get average rating error:", err)
+	}
+	return rating, average
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSetRating(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addVideo("a", "A")
+	cfg := defaultConfig()
+	router := newTestRouter(fake.client(), &cfg)
+	router.GET("/rest/setRating", SetRatingHandlerXML)
+	router.GET("/rest/getSong", GetSongXML)
+
+	doGet(router, "/rest/setRating", url.Values{"u": {"alice"}, "id": {"a"}, "rating": {"5"}})
+	doGet(router, "/rest/setRating", url.Values{"u": {"bob"}, "id": {"a"}, "rating": {"2"}})
+
+	w := doGet(router, "/rest/getSong", url.Values{"u": {"alice"}, "id": {"a"}})
+	var resp SubsonicResponseXML
+	if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad xml: %v", err)
+	}
+	if resp.Song == nil || resp.Song.UserRating != 5 || resp.Song.AverageRating != 3.5 {
+		t.Fatalf("unexpected song: %s", w.Body)
+	}
+
+	// rating 0 清除评分
+	doGet(router, "/rest/setRating", url.Values{"u": {"alice"}, "id": {"a"}, "rating": {"0"}})
+	if r, _ := repo.UserRating("alice", "a"); r != 0 {
+		t.Fatalf("rating after reset = %d", r)
+	}
+	if avg, _ := repo.AverageRating("a"); avg != 2 {
+		t.Fatalf("average after reset = %v", avg)
+	}
+
+	w = doGet(router, "/rest/setRating", url.Values{"u": {"alice"}, "id": {"a"}, "rating": {"6"}})
+	if !strings.Contains(w.Body.String(), `status="failed"`) {
+		t.Fatalf("invalid rating accepted: %s", w.Body)
+	}
+	if n := fake.postCount(); n != 0 {
+		t.Fatalf("bilibili actions disabled but got %d posts", n)
+	}
+}
+
+func TestSetRatingBilibiliActions(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addVideo("a", "A")
+	cfg := defaultConfig()
+	cfg.Ratings.BilibiliActions = true
+	client := fake.client()
+
+	// 4 星点赞，5 星投币，降到 4 星以下取消点赞
+	for _, rating := range []int{4, 5, 3} {
+		if err := setRating(client, &cfg, "alice", "a", rating); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"/x/web-interface/archive/like?", "/x/web-interface/coin/add?", "/x/web-interface/archive/like?"}
+	if len(fake.posts) != len(want) {
+		t.Fatalf("posts = %v", fake.posts)
+	}
+	for i, p := range fake.posts {
+		if !strings.HasPrefix(p, want[i]) {
+			t.Fatalf("posts = %v", fake.posts)
+		}
+	}
+	if !strings.Contains(fake.posts[2], "like=2") {
+		t.Fatalf("expected unlike, got %s", fake.posts[2])
+	}
+}
+
+func TestSetRatingCoinsOnce(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addVideo("a", "A")
+	cfg := defaultConfig()
+	cfg.Ratings.BilibiliActions = true
+	client := fake.client()
+
+	// 重新评为 5 星不会再投币，其他用户也一样
+	for _, r := range []struct {
+		user   string
+		rating int
+	}{{"alice", 5}, {"alice", 4}, {"alice", 5}, {"alice", 0}, {"alice", 5}, {"bob", 5}} {
+		if err := setRating(client, &cfg, r.user, "a", r.rating); err != nil {
+			t.Fatal(err)
+		}
+	}
+	coins := 0
+	for _, p := range fake.posts {
+		if strings.HasPrefix(p, "/x/web-interface/coin/add?") {
+			coins++
+		}
+	}
+	if coins != 1 {
+		t.Fatalf("coins = %d, posts = %v", coins, fake.posts)
+	}
+}
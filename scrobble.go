@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"example/subsonic/bilibili"
+
+	"github.com/gin-gonic/gin"
+)
+
+// nowPlayingTTL 之后仍没有新的 scrobble 的播放视为已停止
+const nowPlayingTTL = 30 * time.Minute
+
+var errMissingScrobbleID = fmt.Errorf("required parameter id is missing")
+
+// nowPlayingEntry 是某个用户在某个客户端上正在播放的歌曲
+type nowPlayingEntry struct {
+	ID     string
+	User   string
+	Client string
+	Since  time.Time
+}
+
+// nowPlayingTracker 记录每个用户、每个客户端正在播放的歌曲，只保存在内存中
+type nowPlayingTracker struct {
+	mu      sync.Mutex
+	entries map[string]nowPlayingEntry // user + "\x00" + client
+}
+
+var nowPlaying = &nowPlayingTracker{entries: map[string]nowPlayingEntry{}}
+
+func (t *nowPlayingTracker) Set(e nowPlayingEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries[e.User+"\x00"+e.Client] = e
+}
+
+// List returns the entries that have not expired, most recent first.
+func (t *nowPlayingTracker) List() []nowPlayingEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var entries []nowPlayingEntry
+	for k, e := range t.entries {
+		if time.Since(e.Since) > nowPlayingTTL {
+			delete(t.entries, k)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Since.After(entries[j].Since) })
+	return entries
+}
+
+// scrobbleRequest 是 scrobble 的参数，Times 与 IDs 一一对应
+type scrobbleRequest struct {
+	User       string
+	Client     string
+	IDs        []string
+	Times      []time.Time
+	Submission bool
+}
+
+// parseScrobble reads the scrobble parameters. time is in milliseconds since
+// the epoch and defaults to now; submission defaults to true.
+func parseScrobble(c *gin.Context) (scrobbleRequest, error) {
+	req := scrobbleRequest{
+		User:       currentUser(c),
+		Client:     c.Query("c"),
+		IDs:        c.QueryArray("id"),
+		Submission: c.DefaultQuery("submission", "true") != "false",
+	}
+	if len(req.IDs) == 0 {
+		return req, errMissingScrobbleID
+	}
+
+	times := c.QueryArray("time")
+	if len(times) != 0 && len(times) != len(req.IDs) {
+		return req, fmt.Errorf("got %d times for %d ids", len(times), len(req.IDs))
+	}
+	now := time.Now()
+	for i := range req.IDs {
+		if len(times) == 0 {
+			req.Times = append(req.Times, now)
+			continue
+		}
+		ms, err := strconv.ParseInt(times[i], 10, 64)
+		if err != nil {
+			return req, fmt.Errorf("invalid time %q", times[i])
+		}
+		req.Times = append(req.Times, time.UnixMilli(ms))
+	}
+	return req, nil
+}
+
+// recordScrobble adds submitted plays to the play history, or marks the song
+// as now playing for the user's client.
+func recordScrobble(req scrobbleRequest) error {
+	if !req.Submission {
+		last := len(req.IDs) - 1
+		nowPlaying.Set(nowPlayingEntry{ID: req.IDs[last], User: req.User, Client: req.Client, Since: req.Times[last]})
+		return nil
+	}
+	for i, id := range req.IDs {
+		if err := repo.AddPlay(Play{ID: id, User: req.User, Client: req.Client, Time: req.Times[i]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scrobbleSink 是 scrobble 的转发目标，例如 bilibili 历史记录和 ListenBrainz
+type scrobbleSink interface {
+	// NowPlaying is called for the song of a submission=false scrobble.
+	NowPlaying(user string, player string, m SongMeta, at time.Time) error
+	// Listen is called for every submitted play.
+	Listen(user string, player string, m SongMeta, at time.Time) error
+}
+
+// scrobbleSinksFrom 返回请求上下文中的 scrobble 转发目标
+func scrobbleSinksFrom(c *gin.Context) []scrobbleSink {
+	if s, ok := c.Get("scrobbleSinks"); ok {
+		return s.([]scrobbleSink)
+	}
+	return nil
+}
+
+// scrobbleForwards 是正在后台转发的 scrobble，测试用它等待转发完成
+var scrobbleForwards sync.WaitGroup
+
+// forwardScrobbleAsync forwards req in the background, so that a slow or
+// failing upstream does not delay the scrobble response.
+func forwardScrobbleAsync(client *bilibili.BilibiliClient, concurrency int, sinks []scrobbleSink, req scrobbleRequest) {
+	if len(sinks) == 0 {
+		return
+	}
+	scrobbleForwards.Add(1)
+	go func() {
+		defer scrobbleForwards.Done()
+		forwardScrobble(client, concurrency, sinks, req)
+	}()
+}
+
+// forwardScrobble passes the scrobbled songs to every sink, looking up their
+// metadata once. Only the last song of a now-playing update is forwarded.
+// Errors are only logged.
+func forwardScrobble(client *bilibili.BilibiliClient, concurrency int, sinks []scrobbleSink, req scrobbleRequest) {
+	if len(sinks) == 0 {
+		return
+	}
+	ids, times := req.IDs, req.Times
+	if !req.Submission {
+		ids, times = ids[len(ids)-1:], times[len(times)-1:]
+	}
+
+	for i, m := range lookupSongMetas(client, ids, concurrency) {
+		for _, sink := range sinks {
+			var err error
+			if req.Submission {
+				err = sink.Listen(req.User, req.Client, m, times[i])
+			} else {
+				err = sink.NowPlaying(req.User, req.Client, m, times[i])
+			}
+			if err != nil {
+				log.Printf("scrobble %s to %T error: %v", m.ID, sink, err)
+			}
+		}
+	}
+}
+
+// historySink 通过心跳把播放上报到 bilibili 账号的历史记录，只上报开启了的用户
+type historySink struct {
+	client *bilibili.BilibiliClient
+	cfg    HistoryConfig
+}
+
+func newHistorySink(client *bilibili.BilibiliClient, cfg HistoryConfig) *historySink {
+	return &historySink{client: client, cfg: cfg}
+}
+
+// NowPlaying reports the song as just started.
+func (s *historySink) NowPlaying(user string, player string, m SongMeta, at time.Time) error {
+	return s.report(user, m, at, false)
+}
+
+// Listen reports the song as fully played, ending at at.
+func (s *historySink) Listen(user string, player string, m SongMeta, at time.Time) error {
+	return s.report(user, m, at, true)
+}
+
+func (s *historySink) report(user string, m SongMeta, at time.Time, finished bool) error {
+	if !s.cfg.ReportsHistory(user) || s.client.CSRF() == "" || m.Unavailable {
+		return nil
+	}
+	m, err := songMetaWithCID(s.client, m)
+	if err != nil {
+		return err
+	}
+	if m.AVID == 0 || m.CID == 0 {
+		return nil
+	}
+
+	start, played := at, 0
+	if finished {
+		played = m.Duration
+		start = at.Add(-time.Duration(played) * time.Second)
+	}
+	return s.client.Heartbeat(&m.BilibiliVideo, start, played)
+}
+
+// playCountOf returns the play count of id, logging errors.
+func playCountOf(id string) PlayCount {
+	pc, err := repo.PlayCount(id)
+	if err != nil {
+		log.Println("get play count error:", err)
+	}
+	return pc
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"example/subsonic/bilibili"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newScrobbleRouter(fake *fakeBilibili) *gin.Engine {
+	cfg := defaultConfig()
+	router := newTestRouter(fake.client(), &cfg)
+	router.GET("/rest/scrobble", ScrobbleHandlerXML)
+	router.GET("/rest/getNowPlaying", GetNowPlayingHandlerXML)
+	router.GET("/rest/getNowPlaying.view", nowPlayingHandler)
+	router.GET("/rest/getSong", GetSongXML)
+	return router
+}
+
+func TestScrobbleSubmission(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addVideo("a", "A")
+	fake.addVideo("b", "B")
+	router := newScrobbleRouter(fake)
+
+	w := doGet(router, "/rest/scrobble", url.Values{"u": {"alice"}, "c": {"app"}, "id": {"a", "b", "a"}, "time": {"1000", "3000", "2000"}})
+	if !strings.Contains(w.Body.String(), `status="ok"`) {
+		t.Fatalf("scrobble failed: %s", w.Body)
+	}
+
+	w = doGet(router, "/rest/getSong", url.Values{"u": {"alice"}, "id": {"a"}})
+	var resp SubsonicResponseXML
+	if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad xml: %v", err)
+	}
+	if resp.Song == nil || resp.Song.PlayCount != 2 || resp.Song.Played != formatTime(time.UnixMilli(2000)) {
+		t.Fatalf("unexpected song: %s", w.Body)
+	}
+
+	plays, err := repo.RecentPlays("alice", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, p := range plays {
+		ids = append(ids, p.ID)
+	}
+	if strings.Join(ids, ",") != "b,a,a" {
+		t.Fatalf("history = %v", ids)
+	}
+	if plays, _ := repo.RecentPlays("bob", 10); len(plays) != 0 {
+		t.Fatalf("bob history = %v", plays)
+	}
+
+	w = doGet(router, "/rest/scrobble", url.Values{"id": {"a"}, "time": {"x"}})
+	if !strings.Contains(w.Body.String(), `status="failed"`) {
+		t.Fatalf("invalid time accepted: %s", w.Body)
+	}
+}
+
+func TestNowPlaying(t *testing.T) {
+	useTestRepo(t)
+	nowPlaying = &nowPlayingTracker{entries: map[string]nowPlayingEntry{}}
+	fake := newFakeBilibili(t)
+	fake.addVideo("a", "A")
+	fake.addVideo("b", "B")
+	router := newScrobbleRouter(fake)
+
+	doGet(router, "/rest/scrobble", url.Values{"u": {"alice"}, "c": {"app"}, "id": {"a"}, "submission": {"false"}})
+	doGet(router, "/rest/scrobble", url.Values{"u": {"alice"}, "c": {"app"}, "id": {"b"}, "submission": {"false"}})
+	doGet(router, "/rest/scrobble", url.Values{"u": {"bob"}, "c": {"web"}, "id": {"a"}, "submission": {"false"}})
+
+	w := doGet(router, "/rest/getNowPlaying", nil)
+	var resp SubsonicResponseXML
+	if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad xml: %v", err)
+	}
+	if resp.NowPlaying == nil || len(resp.NowPlaying.Entry) != 2 {
+		t.Fatalf("unexpected now playing: %s", w.Body)
+	}
+	playing := map[string]string{}
+	for _, e := range resp.NowPlaying.Entry {
+		playing[e.Username] = e.Title
+	}
+	if playing["alice"] != "B" || playing["bob"] != "A" {
+		t.Fatalf("unexpected now playing: %s", w.Body)
+	}
+
+	// now playing 不计入播放次数
+	if pc, _ := repo.PlayCount("a"); pc.Count != 0 {
+		t.Fatalf("play count = %d", pc.Count)
+	}
+
+	w = doGet(router, "/rest/getNowPlaying.view", nil)
+	var jsonResp Response
+	if err := json.Unmarshal(w.Body.Bytes(), &jsonResp); err != nil {
+		t.Fatalf("bad json: %v", err)
+	}
+	if np := jsonResp.SubsonicResponse.NowPlaying; np == nil || len(np.Entry) != 2 {
+		t.Fatalf("unexpected json now playing: %s", w.Body)
+	}
+}
+
+func TestScrobbleReportsHistory(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addVideo("a", "A")
+	// 没有 cid 的旧缓存需要重新获取
+	repo.SaveSongMeta(SongMeta{BilibiliVideo: bilibili.BilibiliVideo{ID: "a", Title: "A", AVID: 1}})
+	cfg := defaultConfig()
+	cfg.History.Users = []string{"alice"}
+	client := fake.client()
+	router := newTestRouter(client, &cfg)
+	router.Use(func(c *gin.Context) {
+		c.Set("scrobbleSinks", []scrobbleSink{newHistorySink(client, cfg.History)})
+	})
+	router.GET("/rest/scrobble", ScrobbleHandlerXML)
+
+	doGet(router, "/rest/scrobble", url.Values{"u": {"bob"}, "id": {"a"}})
+	scrobbleForwards.Wait()
+	if n := fake.postCount(); n != 0 {
+		t.Fatalf("bob did not opt in but got %d posts", n)
+	}
+
+	doGet(router, "/rest/scrobble", url.Values{"u": {"alice"}, "id": {"a"}, "time": {"1000000"}})
+	scrobbleForwards.Wait()
+	if len(fake.posts) != 1 {
+		t.Fatalf("posts = %v", fake.posts)
+	}
+	form, _ := url.ParseQuery(strings.SplitN(fake.posts[0], "?", 2)[1])
+	if form.Get("bvid") != "BVa" || form.Get("cid") != "10" || form.Get("played_time") != "200" || form.Get("start_ts") != "800" {
+		t.Fatalf("unexpected heartbeat %s", fake.posts[0])
+	}
+}
+
+// blockingSink 收到播放时通知 listened，在 release 关闭之前不返回
+type blockingSink struct {
+	listened chan string
+	release  chan struct{}
+}
+
+func (s blockingSink) NowPlaying(user string, player string, m SongMeta, at time.Time) error {
+	<-s.release
+	return nil
+}
+
+func (s blockingSink) Listen(user string, player string, m SongMeta, at time.Time) error {
+	s.listened <- m.ID
+	<-s.release
+	return nil
+}
+
+func TestScrobbleDoesNotWaitForSinks(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addVideo("a", "A")
+	sink := blockingSink{listened: make(chan string, 1), release: make(chan struct{})}
+	router := newScrobbleRouter(fake)
+	router.Use(func(c *gin.Context) {
+		c.Set("scrobbleSinks", []scrobbleSink{sink})
+	})
+	router.GET("/rest/scrobble.view", ScrobbleHandlerXML)
+
+	done := make(chan struct{})
+	go func() {
+		doGet(router, "/rest/scrobble.view", url.Values{"u": {"alice"}, "id": {"a"}})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scrobble waited for the sink")
+	}
+	if pc, _ := repo.PlayCount("a"); pc.Count != 1 {
+		t.Fatalf("play count = %d", pc.Count)
+	}
+	if id := <-sink.listened; id != "a" {
+		t.Fatalf("forwarded %q", id)
+	}
+	close(sink.release)
+	scrobbleForwards.Wait()
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"example/subsonic/bilibili"
+
+	"github.com/gin-gonic/gin"
+)
+
+// searchPageSize 是 bilibili 搜索每页的条数，以接口返回的 pagesize 为准
+const searchPageSize = 20
+
+// searchMaxPages 是 bilibili 搜索最多返回的页数，之后的结果无法获取
+const searchMaxPages = 50
+
+// albumSearchUsers 是搜索专辑时查看合集的 UP 主个数
+const albumSearchUsers = 3
+
+// searchQuery 是 search2/search3 的参数
+type searchQuery struct {
+	Query        string
+	ArtistCount  int
+	ArtistOffset int
+	AlbumCount   int
+	AlbumOffset  int
+	SongCount    int
+	SongOffset   int
+	// Filter 只用于歌曲（视频）搜索
+	Filter bilibili.SearchFilter
+	// Audio 在视频之前加入音频区的搜索结果
+	Audio bool
+}
+
+// searchQueryFrom reads the search parameters of a request, with the
+// Subsonic defaults of 20 results of each kind. tids, duration and order
+// override the configured video search filter.
+func searchQueryFrom(c *gin.Context) (searchQuery, error) {
+	count := func(name string) int {
+		n, err := strconv.Atoi(c.DefaultQuery(name, "20"))
+		if err != nil || n < 0 {
+			return 20
+		}
+		return n
+	}
+	offset := func(name string) int {
+		n, _ := strconv.Atoi(c.Query(name))
+		return max(n, 0)
+	}
+	q := searchQuery{
+		Query:        c.Query("query"),
+		ArtistCount:  count("artistCount"),
+		ArtistOffset: offset("artistOffset"),
+		AlbumCount:   count("albumCount"),
+		AlbumOffset:  offset("albumOffset"),
+		SongCount:    count("songCount"),
+		SongOffset:   offset("songOffset"),
+		Filter:       configFrom(c).Search.Filter(),
+		Audio:        configFrom(c).Search.Audio,
+	}
+
+	for name, v := range map[string]*int{"tids": &q.Filter.TIDs, "duration": &q.Filter.Duration} {
+		if s, ok := c.GetQuery(name); ok {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return q, fmt.Errorf("Invalid %s: %s", name, s)
+			}
+			*v = n
+		}
+	}
+	if s, ok := c.GetQuery("order"); ok {
+		q.Filter.Order = s
+	}
+	return q, q.Filter.Validate()
+}
+
+// searchResult 是搜索到的 UP 主、合集和视频
+type searchResult struct {
+	Artists []bilibili.BilibiliUser
+	Albums  []bilibili.BilibiliSeason
+	Songs   []SongMeta
+}
+
+// search runs a search2/search3 query: songs from the first page of the audio
+// search followed by the video search, artists from the user search and
+// albums from the seasons of the best matching uploaders. Only the video
+// search is required to succeed. A query without keyword lists the local
+// library instead.
+func search(client *bilibili.BilibiliClient, concurrency int, q searchQuery) (searchResult, error) {
+	if isLibraryQuery(q.Query) {
+		return searchLibrary(client, concurrency, q)
+	}
+
+	var result searchResult
+	// 音频区的第一页排在视频之前，偏移量跨过它们后落到视频上
+	videoOffset, videoCount := q.SongOffset, q.SongCount
+	if q.Audio && q.SongCount > 0 {
+		audio, err := searchAudioSongs(client, q.Query)
+		if err != nil {
+			log.Println("search audio error:", err)
+		}
+		result.Songs = pageOf(audio, q.SongOffset, q.SongCount)
+		videoOffset = max(q.SongOffset-len(audio), 0)
+		videoCount -= len(result.Songs)
+	}
+
+	songs, err := pagedSearch(videoOffset, videoCount, func(page int) ([]bilibili.BilibiliVideo, bilibili.SearchPage, error) {
+		return client.SearchVideos(q.Query, page, q.Filter)
+	})
+	if err != nil {
+		return result, err
+	}
+	for _, v := range songs {
+		if err := saveVideoMeta(&v); err != nil {
+			log.Println("save song meta error:", err)
+		}
+		result.Songs = append(result.Songs, SongMeta{BilibiliVideo: v})
+	}
+
+	// 第一页 UP 主同时用于艺术家和专辑
+	var firstUsers []bilibili.BilibiliUser
+	var firstInfo bilibili.SearchPage
+	var firstErr error
+	firstFetched := false
+	searchUsers := func(page int) ([]bilibili.BilibiliUser, bilibili.SearchPage, error) {
+		if page != 1 {
+			return client.SearchUsers(q.Query, page)
+		}
+		if !firstFetched {
+			firstUsers, firstInfo, firstErr = client.SearchUsers(q.Query, 1)
+			firstFetched = true
+		}
+		return firstUsers, firstInfo, firstErr
+	}
+
+	if q.ArtistCount > 0 {
+		if result.Artists, err = pagedSearch(q.ArtistOffset, q.ArtistCount, searchUsers); err != nil {
+			log.Println("search users error:", err)
+		}
+	}
+	if q.AlbumCount > 0 {
+		if result.Albums, err = searchAlbums(client, searchUsers, q.AlbumOffset, q.AlbumCount); err != nil {
+			log.Println("search seasons error:", err)
+		}
+	}
+	return result, nil
+}
+
+// searchAlbums returns the seasons of the first uploaders found, offset and
+// count applying to the seasons of all of them in order.
+func searchAlbums(client *bilibili.BilibiliClient, searchUsers func(page int) ([]bilibili.BilibiliUser, bilibili.SearchPage, error), offset int, count int) ([]bilibili.BilibiliSeason, error) {
+	users, _, err := searchUsers(1)
+	if err != nil {
+		return nil, err
+	}
+	var seasons []bilibili.BilibiliSeason
+	for _, u := range users[:min(len(users), albumSearchUsers)] {
+		list, err := client.GetUserSeasons(u.MID, searchPageSize)
+		if err != nil {
+			log.Println("get user seasons error:", err)
+			continue
+		}
+		for _, s := range list {
+			s.Author = u.Name
+			seasons = append(seasons, s)
+		}
+	}
+	return pageOf(seasons, offset, count), nil
+}
+
+// pagedSearch returns count results starting at offset from a search whose
+// pages start at 1, requesting only the pages covering that range, up to
+// searchMaxPages. The page size is assumed to be searchPageSize until a
+// response reports otherwise.
+func pagedSearch[T any](offset int, count int, fetch func(page int) ([]T, bilibili.SearchPage, error)) ([]T, error) {
+	var result []T
+	pageSize := searchPageSize
+	page := offset/pageSize + 1
+	for page <= searchMaxPages && len(result) < count {
+		items, info, err := fetch(page)
+		if err != nil {
+			if len(result) > 0 {
+				log.Println("search error:", err)
+				break
+			}
+			return nil, err
+		}
+		if len(result) == 0 && info.PageSize > 0 && info.PageSize != pageSize {
+			// 每页条数与假设不同，从正确的页重新开始
+			pageSize = info.PageSize
+			if p := offset/pageSize + 1; p != page {
+				page = p
+				continue
+			}
+		}
+		if skip := offset - (page-1)*pageSize; skip > 0 {
+			items = items[min(skip, len(items)):]
+		}
+		result = append(result, items[:min(len(items), count-len(result))]...)
+		if len(items) == 0 || (info.NumPages > 0 && page >= info.NumPages) {
+			break
+		}
+		page++
+	}
+	return result, nil
+}
+
+// albumIDOf returns the album ID of a season.
+func albumIDOf(s *bilibili.BilibiliSeason) string {
+	return albumIDPrefix + strconv.Itoa(s.MID) + "-" + strconv.Itoa(s.ID)
+}
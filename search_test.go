@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"example/subsonic/bilibili"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newSearchRouter(t *testing.T) (*fakeBilibili, *gin.Engine) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.pageSize = 3
+	for i := 0; i < 8; i++ {
+		fake.addVideo(fmt.Sprintf("s%d", i), fmt.Sprintf("歌%d", i))
+	}
+	fake.addVideo("x", "other")
+	fake.addUser(1, "歌手")
+	fake.addUser(2, "歌手二")
+	fake.addUser(3, "路人")
+	fake.addSeason(1, 10)
+	fake.addSeason(1, 11)
+	fake.addSeason(2, 20)
+
+	cfg := defaultConfig()
+	router := newTestRouter(fake.client(), &cfg)
+	router.GET("/rest/search2", Search2HandlerXML)
+	router.GET("/rest/search3", Search3HandlerXML)
+	router.GET("/rest/search3.view", Search3Handler)
+	return fake, router
+}
+
+func searchXML(t *testing.T, router *gin.Engine, path string, query url.Values) *SearchResultXML {
+	t.Helper()
+	w := doGet(router, path, query)
+	var resp SubsonicResponseXML
+	if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad xml: %v", err)
+	}
+	result := resp.SearchResult3
+	if path == "/rest/search2" {
+		result = resp.SearchResult2
+	}
+	if result == nil {
+		t.Fatalf("unexpected response: %s", w.Body)
+	}
+	return result
+}
+
+func TestSearch3SongPaging(t *testing.T) {
+	_, router := newSearchRouter(t)
+
+	songIDs := func(query url.Values) []string {
+		query.Set("query", "歌")
+		query.Set("artistCount", "0")
+		query.Set("albumCount", "0")
+		var ids []string
+		for _, s := range searchXML(t, router, "/rest/search3", query).Song {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+
+	if ids := songIDs(url.Values{"songCount": {"4"}, "songOffset": {"2"}}); !slices.Equal(ids, []string{"s2", "s3", "s4", "s5"}) {
+		t.Fatalf("songs = %v", ids)
+	}
+	// 偏移超过第一页时直接从对应的页开始，到最后一页为止
+	if ids := songIDs(url.Values{"songCount": {"10"}, "songOffset": {"5"}}); !slices.Equal(ids, []string{"s5", "s6", "s7"}) {
+		t.Fatalf("songs from offset 5 = %v", ids)
+	}
+	if ids := songIDs(url.Values{"songOffset": {"20"}}); len(ids) != 0 {
+		t.Fatalf("songs past the end = %v", ids)
+	}
+	if m, ok, _ := repo.SongMeta("s2"); !ok || m.Title != "歌2" {
+		t.Fatalf("search result metadata not cached: %+v", m)
+	}
+}
+
+func TestSearchArtistsAndAlbums(t *testing.T) {
+	_, router := newSearchRouter(t)
+
+	result := searchXML(t, router, "/rest/search3", url.Values{
+		"query": {"歌"}, "songCount": {"0"},
+		"artistOffset": {"1"}, "albumCount": {"2"}, "albumOffset": {"1"},
+	})
+	if len(result.Song) != 0 {
+		t.Fatalf("songs with songCount=0: %+v", result.Song)
+	}
+	if len(result.Artist) != 1 || result.Artist[0].ID != "ar-2" || result.Artist[0].Name != "歌手二" {
+		t.Fatalf("artists = %+v", result.Artist)
+	}
+	var albums []string
+	for _, a := range result.Album {
+		albums = append(albums, a.ID+" "+a.Name+" "+a.Artist)
+	}
+	if !slices.Equal(albums, []string{"al-1-11 season11 歌手", "al-2-20 season20 歌手二"}) {
+		t.Fatalf("albums = %v", albums)
+	}
+
+	// search2 的专辑是目录
+	result = searchXML(t, router, "/rest/search2", url.Values{"query": {"歌手二"}})
+	if len(result.Album) != 1 || result.Album[0].Title != "season20" || !result.Album[0].IsDir {
+		t.Fatalf("search2 albums = %+v", result.Album)
+	}
+	if len(result.Artist) != 1 || len(result.Song) != 0 {
+		t.Fatalf("unexpected search2 result: %+v", result)
+	}
+}
+
+func TestSearch3JSON(t *testing.T) {
+	_, router := newSearchRouter(t)
+
+	w := doGet(router, "/rest/search3.view", url.Values{"query": {"歌"}, "songCount": {"2"}})
+	var resp Response
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad json: %v", err)
+	}
+	result := resp.SubsonicResponse.SearchResult3
+	if len(result.Song) != 2 || len(result.Artist) != 2 || len(result.Album) != 3 {
+		t.Fatalf("unexpected result: %s", w.Body)
+	}
+}
+
+func TestSearch3EmptyQueryListsLibrary(t *testing.T) {
+	useTestRepo(t)
+	catalog = &catalogCache{entries: map[string]catalogEntry{}}
+	fake := newFakeBilibili(t)
+	for _, id := range []string{"a", "b", "c", "d", "vlog"} {
+		fake.addVideo(id, id)
+	}
+	fake.updateVideo("vlog", func(v *fakeVideo) { v.TID = 21 })
+	cfg := defaultConfig()
+	router := newTestRouter(fake.client(), &cfg)
+	router.GET("/rest/search3", Search3HandlerXML)
+
+	starSong("d")
+	if _, err := createLocalPlaylist("p", []string{"c"}); err != nil {
+		t.Fatal(err)
+	}
+	repo.Star(StarInfo{ID: "ar-1", Kind: StarKindArtist, Name: "up"})
+	repo.Star(StarInfo{ID: "al-1-5", Kind: StarKindAlbum, Name: "season5", Artist: "up", SongCount: 1})
+
+	// Symfonium 发送的是两个双引号
+	result := searchXML(t, router, "/rest/search3", url.Values{"query": {`""`}})
+	var ids []string
+	for _, s := range result.Song {
+		ids = append(ids, s.ID)
+	}
+	// 收藏的 UP 主的投稿中只有歌曲计入曲库，合集的歌曲 a 不重复
+	if !slices.Equal(ids, []string{"a", "b", "c", "d"}) {
+		t.Fatalf("library songs = %v", ids)
+	}
+	if len(result.Artist) != 1 || result.Artist[0].ID != "ar-1" || len(result.Album) != 1 || result.Album[0].ID != "al-1-5" {
+		t.Fatalf("library artists and albums = %+v %+v", result.Artist, result.Album)
+	}
+
+	result = searchXML(t, router, "/rest/search3", url.Values{"query": {""}, "songCount": {"2"}, "songOffset": {"1"}, "artistOffset": {"1"}})
+	ids = nil
+	for _, s := range result.Song {
+		ids = append(ids, s.ID)
+	}
+	if !slices.Equal(ids, []string{"b", "c"}) || len(result.Artist) != 0 {
+		t.Fatalf("library page = %v %+v", ids, result.Artist)
+	}
+}
+
+func TestSearch3Filter(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	for i, id := range []string{"song", "vlog", "live", "hit"} {
+		fake.addVideo(id, "晴天 "+id)
+		fake.updateVideo(id, func(v *fakeVideo) { v.Plays = i })
+	}
+	fake.updateVideo("vlog", func(v *fakeVideo) { v.TID = 21 })
+	fake.updateVideo("live", func(v *fakeVideo) { v.Duration = 3 * 3600 })
+	fake.updateVideo("hit", func(v *fakeVideo) { v.TID = 193 })
+	cfg := defaultConfig()
+	router := newTestRouter(fake.client(), &cfg)
+	router.GET("/rest/search3", Search3HandlerXML)
+
+	songIDs := func(query url.Values) []string {
+		query.Set("query", "晴天")
+		var ids []string
+		for _, s := range searchXML(t, router, "/rest/search3", query).Song {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+
+	// 默认只搜索音乐区（包括子分区）10 分钟以下的视频
+	if ids := songIDs(url.Values{}); !slices.Equal(ids, []string{"song", "hit"}) {
+		t.Fatalf("default profile = %v", ids)
+	}
+	if ids := songIDs(url.Values{"tids": {"0"}, "duration": {"0"}, "order": {"click"}}); !slices.Equal(ids, []string{"hit", "live", "vlog", "song"}) {
+		t.Fatalf("unfiltered by plays = %v", ids)
+	}
+	if ids := songIDs(url.Values{"tids": {"193"}}); !slices.Equal(ids, []string{"hit"}) {
+		t.Fatalf("sub-partition = %v", ids)
+	}
+
+	cfg.Search = SearchConfig{}
+	if ids := songIDs(url.Values{}); len(ids) != 4 {
+		t.Fatalf("without profile = %v", ids)
+	}
+
+	w := doGet(router, "/rest/search3", url.Values{"query": {"晴天"}, "order": {"random"}})
+	if !strings.Contains(w.Body.String(), `status="failed"`) {
+		t.Fatalf("invalid order accepted: %s", w.Body)
+	}
+}
+
+func TestPagedSearchLimit(t *testing.T) {
+	// 模拟 bilibili 的搜索：每页 20 条，最多 50 页
+	fetch := func(page int) ([]int, bilibili.SearchPage, error) {
+		items := make([]int, 20)
+		for i := range items {
+			items[i] = (page-1)*20 + i
+		}
+		return items, bilibili.SearchPage{PageSize: 20, NumPages: 50}, nil
+	}
+
+	if got, _ := pagedSearch(30, 300, fetch); len(got) != 300 || got[0] != 30 || got[299] != 329 {
+		t.Fatalf("got %d results from %v", len(got), got[:1])
+	}
+	if got, _ := pagedSearch(990, 20, fetch); len(got) != 10 || got[0] != 990 {
+		t.Fatalf("results at the last page = %v", got)
+	}
+	if got, _ := pagedSearch(1000, 20, fetch); len(got) != 0 {
+		t.Fatalf("results past the last page = %v", got)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"example/subsonic/bilibili"
+)
+
+// musicTIDs 是音乐区及其子分区的名称
+var musicTIDs = map[int]string{
+	3:   "音乐",
+	28:  "原创音乐",
+	29:  "音乐现场",
+	30:  "VOCALOID·UTAU",
+	31:  "翻唱",
+	59:  "演奏",
+	130: "音乐综合",
+	193: "MV",
+	194: "电音",
+	243: "乐评盘点",
+	244: "音乐教学",
+}
+
+// musicTID 是音乐区的 ID
+const musicTID = 3
+
+// 歌曲长度的范围，单位秒
+const (
+	minSongDuration = 60
+	maxSongDuration = 15 * 60
+)
+
+// similarRequestLimit 限制一次 getSimilarSongs 请求相关推荐的次数
+const similarRequestLimit = 6
+
+// genreOf returns the genre of v, the name of its music sub-partition.
+func genreOf(v *bilibili.BilibiliVideo) string {
+	return musicTIDs[v.TID]
+}
+
+// isSongLike reports whether v looks like a song: of song length and, when
+// its partition is known, in the music partition.
+func isSongLike(v *bilibili.BilibiliVideo) bool {
+	if _, ok := musicTIDs[v.TID]; v.TID != 0 && !ok {
+		return false
+	}
+	return v.Duration >= minSongDuration && v.Duration <= maxSongDuration
+}
+
+// similarSongs returns up to count songs similar to id, which may be a song,
+// an artist or an album. Artists start from the uploader's most played
+// uploads, albums from their songs; related videos of the seeds, and then of
+// the results, fill up the rest. Audio songs have no related videos.
+func similarSongs(client *bilibili.BilibiliClient, id string, count int) ([]bilibili.BilibiliVideo, error) {
+	var result []bilibili.BilibiliVideo
+	seen := map[string]bool{}
+	add := func(v bilibili.BilibiliVideo) bool {
+		if seen[v.ID] || !isSongLike(&v) || len(result) >= count {
+			return false
+		}
+		seen[v.ID] = true
+		result = append(result, v)
+		if err := saveVideoMeta(&v); err != nil {
+			log.Println("save song meta error:", err)
+		}
+		return true
+	}
+
+	var seeds []string
+	if mid, ok := parseArtistID(id); ok {
+		top, err := topSongs(client, mid, 10)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range top {
+			if add(v) {
+				seeds = append(seeds, v.ID)
+			}
+		}
+	} else if mid, seasonId, ok := parseAlbumID(id); ok {
+		_, videos, err := client.GetSeason(mid, seasonId)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range videos {
+			seen[v.ID] = true
+			seeds = append(seeds, v.ID)
+		}
+	} else if !strings.HasPrefix(id, artistIDPrefix) && !strings.HasPrefix(id, albumIDPrefix) && !isAudioID(id) {
+		seen[id] = true
+		seeds = append(seeds, id)
+	}
+
+	for requests := 0; requests < similarRequestLimit && len(seeds) > 0 && len(result) < count; requests++ {
+		related, err := client.GetRelatedVideos(seeds[0])
+		seeds = seeds[1:]
+		if err != nil {
+			if requests == 0 && len(result) == 0 {
+				return nil, err
+			}
+			log.Println("get related videos error:", err)
+			continue
+		}
+		for _, v := range related {
+			if add(v) {
+				seeds = append(seeds, v.ID)
+			}
+		}
+	}
+	return result, nil
+}
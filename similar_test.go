@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestGetSimilarSongs2(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	for _, id := range []string{"seed", "b", "c", "d", "e", "long", "game"} {
+		fake.addVideo(id, id)
+	}
+	fake.updateVideo("long", func(v *fakeVideo) { v.Duration = 3 * 3600 })
+	fake.updateVideo("game", func(v *fakeVideo) { v.TID = 17 })
+	fake.setRelated("seed", "b", "long", "game", "c", "seed")
+	fake.setRelated("b", "c", "d")
+	fake.setRelated("c", "e")
+	cfg := defaultConfig()
+	router := newTestRouter(fake.client(), &cfg)
+	router.GET("/rest/getSimilarSongs2", GetSimilarSongs2HandlerXML)
+
+	similar := func(query url.Values) []string {
+		w := doGet(router, "/rest/getSimilarSongs2", query)
+		var resp SubsonicResponseXML
+		if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("bad xml: %v", err)
+		}
+		if resp.SimilarSongs2 == nil {
+			t.Fatalf("unexpected response: %s", w.Body)
+		}
+		var ids []string
+		for _, s := range resp.SimilarSongs2.Song {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+
+	// 过长和非音乐区的视频被过滤，结果去重且不包含种子本身
+	if ids := similar(url.Values{"id": {"seed"}}); !slices.Equal(ids, []string{"b", "c", "d", "e"}) {
+		t.Fatalf("similar to seed = %v", ids)
+	}
+	if ids := similar(url.Values{"id": {"seed"}, "count": {"3"}}); !slices.Equal(ids, []string{"b", "c", "d"}) {
+		t.Fatalf("similar to seed with count = %v", ids)
+	}
+
+	// 艺术家以播放最多的投稿开始
+	fake.updateVideo("e", func(v *fakeVideo) { v.Plays = 100 })
+	if ids := similar(url.Values{"id": {"ar-1"}, "count": {"2"}}); !slices.Equal(ids, []string{"e", "seed"}) {
+		t.Fatalf("similar to artist = %v", ids)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"example/subsonic/bilibili"
+)
+
+// saveVideoMeta caches metadata already obtained from another API, e.g. a
+// favorite folder listing.
+func saveVideoMeta(v *bilibili.BilibiliVideo) error {
+	return saveSongMeta(SongMeta{BilibiliVideo: *v, Updated: time.Now()})
+}
+
+// saveSongMeta caches m, keeping the tags and stream format of the cached
+// entry when m has none, as they come from separate requests.
+func saveSongMeta(m SongMeta) error {
+	if !m.TagsFetched || m.Stream == nil {
+		if old, ok, err := repo.SongMeta(m.ID); err == nil && ok {
+			if !m.TagsFetched {
+				m.Tags, m.TagsFetched = old.Tags, old.TagsFetched
+			}
+			if m.Stream == nil {
+				m.Stream = old.Stream
+			}
+		}
+	}
+	return repo.SaveSongMeta(m)
+}
+
+// fetchSongMeta fetches and caches the metadata of one song. A video that was
+// deleted or hidden is cached as unavailable, keeping the details of old.
+func fetchSongMeta(client *bilibili.BilibiliClient, id string, old SongMeta) (SongMeta, error) {
+	video, err := getSongInfo(client, id)
+	if errors.Is(err, bilibili.ErrVideoUnavailable) {
+		m := old
+		m.ID = id
+		if m.Title == "" {
+			m.Title = id
+		}
+		m.Unavailable = true
+		m.Updated = time.Now()
+		return m, saveSongMeta(m)
+	}
+	if err != nil {
+		return old, err
+	}
+
+	m := SongMeta{BilibiliVideo: *video, Updated: time.Now()}
+	return m, saveSongMeta(m)
+}
+
+// songMetaWithCID returns m, refetching it when it was cached before cids
+// were recorded. Audio songs have no cid.
+func songMetaWithCID(client *bilibili.BilibiliClient, m SongMeta) (SongMeta, error) {
+	if m.CID != 0 || m.Unavailable || isAudioID(m.ID) {
+		return m, nil
+	}
+	return fetchSongMeta(client, m.ID, m)
+}
+
+// lookupSongMetas returns the metadata of ids in order. Cached entries are
+// used as is; missing ones are fetched with at most concurrency requests in
+// flight. Songs that cannot be fetched get a placeholder with the ID as title.
+func lookupSongMetas(client *bilibili.BilibiliClient, ids []string, concurrency int) []SongMeta {
+	metas := make([]SongMeta, len(ids))
+	var missing []int
+	for i, id := range ids {
+		m, ok, err := repo.SongMeta(id)
+		if err != nil {
+			log.Println("load song meta error:", err)
+		}
+		if ok {
+			metas[i] = m
+		} else {
+			missing = append(missing, i)
+		}
+	}
+
+	forEachLimit(missing, concurrency, func(i int) {
+		m, err := fetchSongMeta(client, ids[i], SongMeta{})
+		if err != nil {
+			log.Println("get video info error:", err)
+			m = SongMeta{BilibiliVideo: bilibili.BilibiliVideo{ID: ids[i], Title: ids[i]}}
+		}
+		metas[i] = m
+	})
+	return metas
+}
+
+// refreshStarredMetas refetches the cached metadata of starred songs that is
+// older than maxAge.
+func refreshStarredMetas(client *bilibili.BilibiliClient, maxAge time.Duration, concurrency int) error {
+	ids, err := getStarredSongs()
+	if err != nil {
+		return err
+	}
+
+	var stale []int
+	olds := make([]SongMeta, len(ids))
+	for i, id := range ids {
+		m, ok, err := repo.SongMeta(id)
+		if err != nil {
+			return err
+		}
+		if !ok || time.Since(m.Updated) > maxAge {
+			olds[i] = m
+			stale = append(stale, i)
+		}
+	}
+
+	forEachLimit(stale, concurrency, func(i int) {
+		if _, err := fetchSongMeta(client, ids[i], olds[i]); err != nil {
+			log.Println("refresh song meta error:", err)
+		}
+	})
+	return nil
+}
+
+// runMetaRefresh refreshes starred metadata in the background every interval.
+func runMetaRefresh(client *bilibili.BilibiliClient, cfg MetadataConfig) {
+	for {
+		maxAge := time.Duration(cfg.MaxAge) * time.Second
+		if err := refreshStarredMetas(client, maxAge, cfg.Concurrency); err != nil {
+			log.Println("refresh starred metadata error:", err)
+		}
+		time.Sleep(time.Duration(cfg.RefreshInterval) * time.Second)
+	}
+}
+
+// forEachLimit calls fn for every item with at most limit calls running at once.
+func forEachLimit(items []int, limit int, fn func(int)) {
+	if limit < 1 {
+		limit = 1
+	}
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for _, item := range items {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(item int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(item)
+		}(item)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLookupSongMetasCaches(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addVideo("a", "A")
+	fake.addVideo("b", "B")
+	client := fake.client()
+
+	ids := []string{"a", "gone", "b"}
+	metas := lookupSongMetas(client, ids, 2)
+	for i, m := range metas {
+		if m.ID != ids[i] {
+			t.Fatalf("metas[%d].ID = %q, want %q", i, m.ID, ids[i])
+		}
+	}
+	if metas[0].Title != "A" || metas[0].Unavailable {
+		t.Fatalf("unexpected meta %+v", metas[0])
+	}
+	if !metas[1].Unavailable {
+		t.Fatalf("deleted video not marked unavailable: %+v", metas[1])
+	}
+
+	views := fake.viewCount()
+	lookupSongMetas(client, ids, 2)
+	if n := fake.viewCount(); n != views {
+		t.Fatalf("cached lookup made %d upstream calls", n-views)
+	}
+}
+
+func TestRefreshKeepsDetailsOfDeletedVideo(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addVideo("a", "A")
+	client := fake.client()
+
+	starSong("a")
+	lookupSongMetas(client, []string{"a"}, 1)
+
+	delete(fake.videos, "a")
+	if err := refreshStarredMetas(client, -time.Second, 1); err != nil {
+		t.Fatalf("refreshStarredMetas failed: %v", err)
+	}
+
+	m, _, _ := repo.SongMeta("a")
+	if !m.Unavailable || m.Title != "A" {
+		t.Fatalf("unexpected meta %+v", m)
+	}
+	if got := SongFromMetaXML(&m).Title; got != "[已失效] A" {
+		t.Fatalf("title = %q", got)
+	}
+}
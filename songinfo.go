@@ -0,0 +1,156 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"example/subsonic/bilibili"
+)
+
+// songInfo 是返回给客户端的歌曲信息：整理后的歌名和歌手，加上手动修正
+type songInfo struct {
+	trackInfo
+	// 没有修正时每个视频都是一张单曲专辑，专辑名为歌名，年份为发布年份
+	Album    string
+	Track    int
+	Year     int
+	Genre    string
+	CoverArt string
+	// Created 为投稿时间，BitRate（kbps）和 Size 在播放过之前按音频区和视频的音质估算
+	Created time.Time
+	BitRate int
+	Size    int64
+
+	// 以下为 OpenSubsonic 的扩展字段
+	SortName string
+	// Artists 是 DisplayArtist 中的每位歌手，只有 UP 主本人带 ID
+	Artists      []artistRef
+	Contributors []contributor
+	// Stream 和 ReplayGain 在第一次播放之后才有
+	Stream     *StreamInfo
+	ReplayGain *replayGain
+}
+
+type artistRef struct {
+	ID   string
+	Name string
+}
+
+// contributor 是歌手以外参与歌曲的人，例如翻唱的 UP 主
+type contributor struct {
+	Role   string
+	Artist artistRef
+}
+
+type replayGain struct {
+	TrackGain float64
+	TrackPeak float64
+}
+
+// 视频 DASH 音频和音频区歌曲的码率，单位 kbps
+const (
+	videoAudioBitRate = 192
+	audioSongBitRate  = 320
+)
+
+// bilibiliZone 是 bilibili 使用的北京时间，发布年份按它计算，与服务器的时区无关
+var bilibiliZone = time.FixedZone("CST", 8*60*60)
+
+// replayGainReference 是 ReplayGain 2.0 的参考响度，单位 LUFS
+const replayGainReference = -18.0
+
+// uploaderRoles 是 UP 主在各音乐分区中通常的身份
+var uploaderRoles = map[int]string{
+	28: "composer",  // 原创音乐
+	30: "producer",  // VOCALOID·UTAU
+	31: "performer", // 翻唱
+	59: "performer", // 演奏
+}
+
+// songInfoOf returns the metadata of video v shown to clients: its cleaned
+// title with the manual override applied on top, and the format of its audio
+// once it has been played.
+func songInfoOf(v *bilibili.BilibiliVideo) songInfo {
+	info := songInfo{trackInfo: titles.clean(v), Track: 1, Genre: genreOf(v), CoverArt: v.Pic}
+	if !v.Pubdate.IsZero() {
+		info.Year = v.Pubdate.In(bilibiliZone).Year()
+	}
+	info.Created = v.Ctime
+	if info.Created.IsZero() {
+		info.Created = v.Pubdate
+	}
+	if repo != nil {
+		if m, ok, _ := repo.SongMeta(v.ID); ok {
+			info.Stream = m.Stream
+		}
+	}
+	info.BitRate = videoAudioBitRate
+	if isAudioID(v.ID) {
+		info.BitRate = audioSongBitRate
+	}
+	if info.Stream != nil && info.Stream.BitRate > 0 {
+		info.BitRate = info.Stream.BitRate
+	}
+	info.Size = int64(v.Duration) * int64(info.BitRate) * 1000 / 8
+
+	o := songOverride(v.ID)
+	if o.Title != "" {
+		info.Title = o.Title
+	}
+	if o.Artist != "" {
+		info.Artist, info.DisplayArtist = primaryArtist(o.Artist), o.Artist
+	}
+	// 默认的专辑名跟随修正后的歌名
+	info.Album = info.Title
+	if o.Album != "" {
+		info.Album = o.Album
+	}
+	if o.Track != 0 {
+		info.Track = o.Track
+	}
+	if o.Year != 0 {
+		info.Year = o.Year
+	}
+	if o.Genre != "" {
+		info.Genre = o.Genre
+	}
+	if o.CoverArt != "" {
+		info.CoverArt = o.CoverArt
+	}
+
+	info.SortName = sortName(info.Title)
+	uploader := artistRef{ID: artistIDOf(v), Name: v.Author}
+	for _, name := range splitArtists(info.DisplayArtist) {
+		a := artistRef{Name: name}
+		if name == uploader.Name {
+			a.ID = uploader.ID
+		}
+		info.Artists = append(info.Artists, a)
+	}
+	if role := uploaderRoles[v.TID]; role != "" && uploader.Name != "" {
+		info.Contributors = append(info.Contributors, contributor{Role: role, Artist: uploader})
+	}
+	if info.Stream != nil && info.Stream.Loudness != nil {
+		l := info.Stream.Loudness
+		info.ReplayGain = &replayGain{
+			TrackGain: roundTo2(replayGainReference - l.Integrated),
+			TrackPeak: roundTo2(math.Pow(10, l.TruePeak/20)),
+		}
+	}
+	return info
+}
+
+// sortName returns title without a leading English article.
+func sortName(title string) string {
+	for _, article := range []string{"the ", "a ", "an "} {
+		if len(title) > len(article) && strings.EqualFold(title[:len(article)], article) {
+			return strings.TrimSpace(title[len(article):])
+		}
+	}
+	return title
+}
+
+func roundTo2(x float64) float64 {
+	return math.Round(x*100) / 100
+}
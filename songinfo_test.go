@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSongInfoDefaults(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addVideo("a", "周杰伦 - 晴天")
+	fake.updateVideo("a", func(v *fakeVideo) {
+		v.Pubdate = time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC).Unix()
+		v.Ctime = time.Date(2021, 5, 31, 0, 0, 0, 0, time.UTC).Unix()
+		v.Plays, v.Likes = 1000, 10
+	})
+	cfg := defaultConfig()
+	router := newTestRouter(fake.client(), &cfg)
+	router.GET("/rest/getSong", GetSongXML)
+	router.GET("/rest/search3.view", Search3Handler)
+
+	var resp SubsonicResponseXML
+	if err := xml.Unmarshal(doGet(router, "/rest/getSong", url.Values{"id": {"a"}}).Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad xml: %v", err)
+	}
+	s := resp.Song
+	if s.Year != 2021 || s.Created != "2021-05-31T00:00:00Z" || s.Album != "晴天" || s.Track != 1 || s.DiscNumber != 1 {
+		t.Fatalf("unexpected song: %+v", s)
+	}
+	if s.BitRate != 192 || s.Size != 200*192*1000/8 || s.ViewCount != 1000 || s.LikeCount != 10 {
+		t.Fatalf("unexpected statistics: %+v", s)
+	}
+
+	// 搜索结果中的发布时间和统计数据也会保留
+	w := doGet(router, "/rest/search3.view", url.Values{"query": {"晴天"}})
+	var res Response
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("bad json: %v", err)
+	}
+	if songs := res.SubsonicResponse.SearchResult3.Song; len(songs) != 1 || songs[0].Year != 2021 || songs[0].Created == "" || songs[0].ViewCount != 1000 {
+		t.Fatalf("unexpected search result: %s", w.Body)
+	}
+}
+
+func TestMP4AudioFormat(t *testing.T) {
+	info, ok := mp4AudioFormat(fakeMP4Head("fLaC", 2, 24, 96000))
+	if !ok || info.Codec != "fLaC" || info.ChannelCount != 2 || info.SamplingRate != 96000 || info.BitDepth != 24 {
+		t.Fatalf("flac format = %+v, %v", info, ok)
+	}
+	if contentType, suffix, _ := info.fileFormat(); contentType != "audio/flac" || suffix != "flac" {
+		t.Fatalf("flac file format = %s, %s", contentType, suffix)
+	}
+	// 有损音频的 samplesize 没有意义
+	if info, _ := mp4AudioFormat(fakeMP4Head("mp4a", 2, 16, 44100)); info.BitDepth != 0 || info.SamplingRate != 44100 {
+		t.Fatalf("aac format = %+v", info)
+	}
+	if _, ok := mp4AudioFormat([]byte("audio1")); ok {
+		t.Fatal("format found in non-mp4 data")
+	}
+}
+
+func TestOpenSubsonicSongFields(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addVideo("a", "DAOKO × up - 打上花火")
+	cfg := defaultConfig()
+	router := newTestRouter(fake.client(), &cfg)
+	router.GET("/rest/getSong", GetSongXML)
+	router.GET("/rest/stream", StreamHandlerXML)
+	router.GET("/rest/search3.view", Search3Handler)
+
+	song := func() *SongXML {
+		var resp SubsonicResponseXML
+		w := doGet(router, "/rest/getSong", url.Values{"id": {"a"}})
+		if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("bad xml: %v", err)
+		}
+		return resp.Song
+	}
+
+	s := song()
+	if s.MediaType != "song" || s.ReplayGain != nil || s.ChannelCount != 0 || s.ContentType != "audio/mpeg" || s.Suffix != "mp3" {
+		t.Fatalf("unexpected song before playing: %+v", s)
+	}
+	// 只有 UP 主本人带 ID，翻唱区的 UP 主是演唱者
+	if len(s.Artists) != 2 || s.Artists[0] != (ArtistRefXML{Name: "DAOKO"}) || s.Artists[1] != (ArtistRefXML{ID: "ar-1", Name: "up"}) {
+		t.Fatalf("artists = %+v", s.Artists)
+	}
+	if len(s.Contributors) != 1 || s.Contributors[0].Role != "performer" || s.Contributors[0].Artist.ID != "ar-1" {
+		t.Fatalf("contributors = %+v", s.Contributors)
+	}
+
+	// 第一次播放时记录音频格式和响度
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	res, err := http.Get(srv.URL + "/rest/stream?id=a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if m, _, _ := repo.SongMeta("a"); m.Stream != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stream format not recorded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s = song()
+	if s.ChannelCount != 2 || s.SamplingRate != 48000 || s.BitDepth != 0 || s.BitRate != 132 || s.Size != 200*132*1000/8 {
+		t.Fatalf("unexpected format: %+v", s)
+	}
+	if s.ContentType != "audio/mp4" || s.Suffix != "m4a" {
+		t.Fatalf("content type = %s, suffix = %s", s.ContentType, s.Suffix)
+	}
+	// 码率和响度来自打开音频流时的 playurl 请求
+	if n := fake.playCount(); n != 1 {
+		t.Fatalf("playurl requested %d times", n)
+	}
+	if s.ReplayGain == nil || s.ReplayGain.TrackGain != -8 || s.ReplayGain.TrackPeak != 0.89 {
+		t.Fatalf("replay gain = %+v", s.ReplayGain)
+	}
+
+	// JSON 中总是带 musicBrainzId 和 explicitStatus
+	w := doGet(router, "/rest/search3.view", url.Values{"query": {"打上花火"}})
+	body := w.Body.String()
+	if !strings.Contains(body, `"musicBrainzId":""`) || !strings.Contains(body, `"explicitStatus":""`) || !strings.Contains(body, `"replayGain":{"trackGain":-8,"trackPeak":0.89}`) {
+		t.Fatalf("unexpected json: %s", body)
+	}
+	var resp Response
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad json: %v", err)
+	}
+	if songs := resp.SubsonicResponse.SearchResult3.Song; len(songs) != 1 || len(songs[0].Contributors) != 1 || songs[0].Artists[1].ID != "ar-1" {
+		t.Fatalf("unexpected search result: %s", body)
+	}
+}
@@ -1,84 +1,213 @@
 package main
 
 import (
-	"bufio"
-	"os"
+	"fmt"
+	"log"
+	"strconv"
 	"strings"
-	"sync"
+	"time"
+
+	"example/subsonic/bilibili"
 )
 
-const starredFile = "starred.dat"
+// 艺术家对应 UP 主，ID 为 "ar-<mid>"；专辑对应 UP 主的合集，ID 为 "al-<mid>-<seasonId>"
+const (
+	artistIDPrefix = "ar-"
+	albumIDPrefix  = "al-"
+)
 
-var mu sync.Mutex
+// artistIDOf returns the artist ID of a video's uploader. Videos without a
+// known mid fall back to the uploader name.
+func artistIDOf(v *bilibili.BilibiliVideo) string {
+	if v.MID != 0 {
+		return artistIDPrefix + strconv.Itoa(v.MID)
+	}
+	return v.Author
+}
 
-// getStarredSongs_nl reads the starred songs file without locking.
-func getStarredSongs_nl() ([]string, error) {
-	f, err := os.Open(starredFile)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return []string{}, nil
-		}
-		return nil, err
+func parseArtistID(id string) (mid int, ok bool) {
+	if !strings.HasPrefix(id, artistIDPrefix) {
+		return 0, false
 	}
-	defer f.Close()
+	mid, err := strconv.Atoi(strings.TrimPrefix(id, artistIDPrefix))
+	return mid, err == nil
+}
 
-	var songs []string
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		songs = append(songs, scanner.Text())
+func parseAlbumID(id string) (mid int, seasonId int, ok bool) {
+	if !strings.HasPrefix(id, albumIDPrefix) {
+		return 0, 0, false
 	}
-	return songs, scanner.Err()
+	_, err := fmt.Sscanf(strings.TrimPrefix(id, albumIDPrefix), "%d-%d", &mid, &seasonId)
+	return mid, seasonId, err == nil
 }
 
-// starSong adds a song ID to the starred file.
+// starSong adds a song ID to the starred set.
 func starSong(id string) error {
-	mu.Lock()
-	defer mu.Unlock()
+	return repo.Star(StarInfo{ID: id, Kind: StarKindSong})
+}
+
+// unstarSong removes a song ID from the starred set.
+func unstarSong(id string) error {
+	return repo.Unstar(id)
+}
 
-	songs, err := getStarredSongs_nl()
+// getStarredSongs returns a list of starred song IDs, oldest first.
+func getStarredSongs() ([]string, error) {
+	stars, err := repo.Starred()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	songs := make([]string, 0, len(stars))
+	for _, s := range stars {
+		if s.Kind == StarKindSong {
+			songs = append(songs, s.ID)
+		}
 	}
+	return songs, nil
+}
 
-	for _, songID := range songs {
-		if songID == id {
-			return nil // Already starred
+// starArtist stars an uploader, following it on bilibili when configured.
+// The star is kept with the ID as name if the uploader cannot be looked up.
+func starArtist(client *bilibili.BilibiliClient, cfg *Config, id string) error {
+	s := StarInfo{ID: id, Kind: StarKindArtist, Name: id}
+	if mid, ok := parseArtistID(id); ok {
+		user, err := client.GetUserInfo(mid)
+		if err != nil {
+			log.Println("get user info error:", err)
+		} else {
+			s.Name = user.Name
+			s.CoverArt = user.Face
+			s.SongCount = user.ArchiveCount
+		}
+		if cfg.StarSync.FollowArtists {
+			if err := client.ModifyRelation(mid, true); err != nil {
+				log.Println("follow error:", err)
+			}
 		}
 	}
+	return repo.Star(s)
+}
 
-	f, err := os.OpenFile(starredFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
+// unstarArtist removes an artist star, unfollowing the uploader when configured.
+func unstarArtist(client *bilibili.BilibiliClient, cfg *Config, id string) error {
+	if mid, ok := parseArtistID(id); ok && cfg.StarSync.FollowArtists {
+		if err := client.ModifyRelation(mid, false); err != nil {
+			log.Println("unfollow error:", err)
+		}
+	}
+	return repo.Unstar(id)
+}
+
+// starAlbum stars a season, collecting it on bilibili when configured.
+func starAlbum(client *bilibili.BilibiliClient, cfg *Config, id string) error {
+	s := StarInfo{ID: id, Kind: StarKindAlbum, Name: id}
+	if mid, seasonId, ok := parseAlbumID(id); ok {
+		season, _, err := client.GetSeason(mid, seasonId)
+		if err != nil {
+			log.Println("get season error:", err)
+		} else {
+			s.Name = season.Name
+			s.Artist = season.Author
+			s.ArtistID = artistIDPrefix + strconv.Itoa(mid)
+			s.CoverArt = season.Cover
+			s.SongCount = season.Total
+		}
+		if cfg.StarSync.CollectAlbums {
+			if err := client.FavSeason(seasonId, true); err != nil {
+				log.Println("collect season error:", err)
+			}
+		}
+	}
+	return repo.Star(s)
+}
+
+// unstarAlbum removes an album star, uncollecting the season when configured.
+func unstarAlbum(client *bilibili.BilibiliClient, cfg *Config, id string) error {
+	if _, seasonId, ok := parseAlbumID(id); ok && cfg.StarSync.CollectAlbums {
+		if err := client.FavSeason(seasonId, false); err != nil {
+			log.Println("uncollect season error:", err)
+		}
+	}
+	return repo.Unstar(id)
+}
+
+// starByID stars a song, or an artist or album when id carries their prefix,
+// as Subsonic 1.x clients pass every kind as id. syncer may be nil.
+func starByID(client *bilibili.BilibiliClient, cfg *Config, syncer *StarSyncer, id string) error {
+	switch {
+	case strings.HasPrefix(id, artistIDPrefix):
+		return starArtist(client, cfg, id)
+	case strings.HasPrefix(id, albumIDPrefix):
+		return starAlbum(client, cfg, id)
+	}
+
+	if err := starSong(id); err != nil {
+		return err
+	}
+	if _, err := fetchSongMeta(client, id, SongMeta{}); err != nil {
+		log.Println("get video info error:", err)
+	}
+	// 音频不能放进视频收藏夹，只在本地收藏
+	if syncer != nil && !isAudioID(id) {
+		syncer.Star(id)
+	}
+	return nil
+}
+
+// unstarByID is the counterpart of starByID.
+func unstarByID(client *bilibili.BilibiliClient, cfg *Config, syncer *StarSyncer, id string) error {
+	switch {
+	case strings.HasPrefix(id, artistIDPrefix):
+		return unstarArtist(client, cfg, id)
+	case strings.HasPrefix(id, albumIDPrefix):
+		return unstarAlbum(client, cfg, id)
+	}
+
+	if err := unstarSong(id); err != nil {
 		return err
 	}
-	defer f.Close()
+	if syncer != nil && !isAudioID(id) {
+		syncer.Unstar(id)
+	}
+	return nil
+}
 
-	_, err = f.WriteString(id + "\n")
-	return err
+// starredSong 是带收藏时间的歌曲
+type starredSong struct {
+	SongMeta
+	Starred time.Time
 }
 
-// unstarSong removes a song ID from the starred file.
-func unstarSong(id string) error {
-	mu.Lock()
-	defer mu.Unlock()
+type starredResult struct {
+	Artists []StarInfo
+	Albums  []StarInfo
+	Songs   []starredSong
+}
 
-	songs, err := getStarredSongs_nl()
+// loadStarred collects everything starred, using cached song metadata.
+func loadStarred(client *bilibili.BilibiliClient, concurrency int) (starredResult, error) {
+	var result starredResult
+	stars, err := repo.Starred()
 	if err != nil {
-		return err
+		return result, err
 	}
 
-	var newSongs []string
-	for _, songID := range songs {
-		if songID != id {
-			newSongs = append(newSongs, songID)
+	var songIDs []string
+	var songStarred []time.Time
+	for _, s := range stars {
+		switch s.Kind {
+		case StarKindArtist:
+			result.Artists = append(result.Artists, s)
+		case StarKindAlbum:
+			result.Albums = append(result.Albums, s)
+		default:
+			songIDs = append(songIDs, s.ID)
+			songStarred = append(songStarred, s.Starred)
 		}
 	}
 
-	return os.WriteFile(starredFile, []byte(strings.Join(newSongs, "\n")+"\n"), 0644)
+	for i, m := range lookupSongMetas(client, songIDs, concurrency) {
+		result.Songs = append(result.Songs, starredSong{SongMeta: m, Starred: songStarred[i]})
+	}
+	return result, nil
 }
-
-// getStarredSongs returns a list of starred song IDs.
-func getStarredSongs() ([]string, error) {
-	mu.Lock()
-	defer mu.Unlock()
-	return getStarredSongs_nl()
-}
\ No newline at end of file
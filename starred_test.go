@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newStarredRouter(fake *fakeBilibili, cfg *Config) *gin.Engine {
+	router := newTestRouter(fake.client(), cfg)
+	router.GET("/rest/star", StarHandlerXML)
+	router.GET("/rest/unstar", UnstarHandlerXML)
+	router.GET("/rest/getStarred", GetStarredHandlerXML)
+	router.GET("/rest/getStarred2", GetStarred2HandlerXML)
+	router.GET("/rest/getStarred2.view", starred2Handler)
+	return router
+}
+
+func TestStarArtistAndAlbum(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addVideo("a", "A")
+	cfg := defaultConfig()
+	cfg.StarSync.FollowArtists = true
+	router := newStarredRouter(fake, &cfg)
+
+	w := doGet(router, "/rest/star", url.Values{"id": {"a"}, "artistId": {"ar-7"}, "albumId": {"al-7-42"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("star status = %d, body %s", w.Code, w.Body)
+	}
+	if n := fake.postCount(); n != 1 {
+		t.Fatalf("expected one follow request, got %d", n)
+	}
+
+	w = doGet(router, "/rest/getStarred2", nil)
+	var resp SubsonicResponseXML
+	if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad xml: %v", err)
+	}
+	s := resp.Starred2
+	if s == nil || len(s.Artist) != 1 || len(s.Album) != 1 || len(s.Song) != 1 {
+		t.Fatalf("unexpected starred2: %s", w.Body)
+	}
+	if s.Artist[0].Name != "up7" || s.Album[0].Name != "season42" || s.Album[0].ArtistID != "ar-7" {
+		t.Fatalf("unexpected starred2: %s", w.Body)
+	}
+	if s.Song[0].Starred == "" {
+		t.Fatalf("song without starred timestamp: %s", w.Body)
+	}
+
+	// 1.x 的 getStarred 中专辑是目录
+	w = doGet(router, "/rest/getStarred", nil)
+	resp = SubsonicResponseXML{}
+	xml.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Starred == nil || len(resp.Starred.Album) != 1 || !resp.Starred.Album[0].IsDir || resp.Starred.Album[0].Title != "season42" {
+		t.Fatalf("unexpected starred: %s", w.Body)
+	}
+
+	w = doGet(router, "/rest/getStarred2.view", nil)
+	var jsonResp Response
+	if err := json.Unmarshal(w.Body.Bytes(), &jsonResp); err != nil {
+		t.Fatalf("bad json: %v", err)
+	}
+	if s := jsonResp.SubsonicResponse.Starred2; s == nil || len(s.Artist) != 1 || len(s.Album) != 1 || len(s.Song) != 1 {
+		t.Fatalf("unexpected json starred2: %s", w.Body)
+	}
+
+	w = doGet(router, "/rest/unstar", url.Values{"artistId": {"ar-7"}, "id": {"al-7-42"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("unstar status = %d, body %s", w.Code, w.Body)
+	}
+	stars, _ := repo.Starred()
+	if len(stars) != 1 || stars[0].ID != "a" {
+		t.Fatalf("stars after unstar = %+v", stars)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"example/subsonic/bilibili"
+)
+
+const starSyncStateKey = "starSync"
+
+// starSyncState 保存上一次同步完成时远端收藏夹的内容，用于三方合并
+type starSyncState struct {
+	// Base 上一次同步后远端收藏夹中的歌曲 ID
+	Base []string `json:"base"`
+	// Dirty 本地修改但尚未成功推送到远端的歌曲 ID
+	Dirty map[string]bool `json:"dirty"`
+}
+
+// StarSyncer keeps the local starred set and a bilibili favorite folder in
+// sync. Local star/unstar is pushed immediately; remote changes are pulled
+// periodically and merged against the state of the last sync.
+type StarSyncer struct {
+	client  *bilibili.BilibiliClient
+	mediaID string
+
+	// syncing 保证同一时间只有一次同步；mu 只保护 state，请求 bilibili 时不持有
+	syncing sync.Mutex
+	mu      sync.Mutex
+	state   starSyncState
+}
+
+func NewStarSyncer(client *bilibili.BilibiliClient, mediaID string) *StarSyncer {
+	s := &StarSyncer{
+		client:  client,
+		mediaID: mediaID,
+		state:   starSyncState{Dirty: map[string]bool{}},
+	}
+
+	if err := repo.LoadState(starSyncStateKey, &s.state); err != nil {
+		log.Println("load star sync state error:", err)
+	}
+	if s.state.Dirty == nil {
+		s.state.Dirty = map[string]bool{}
+	}
+	return s
+}
+
+// save_nl writes the sync state without locking.
+func (s *StarSyncer) save_nl() error {
+	return repo.SaveState(starSyncStateKey, s.state)
+}
+
+// Star pushes a local star to the favorite folder.
+func (s *StarSyncer) Star(id string) {
+	s.push(id, true)
+}
+
+// Unstar pushes a local unstar to the favorite folder.
+func (s *StarSyncer) Unstar(id string) {
+	s.push(id, false)
+}
+
+func (s *StarSyncer) push(id string, add bool) {
+	err := s.deal(id, 0, add)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		// 推送失败时记录下来，下次同步时本地修改优先
+		log.Println("star sync push error:", err)
+		s.state.Dirty[id] = true
+	} else {
+		delete(s.state.Dirty, id)
+	}
+	if err := s.save_nl(); err != nil {
+		log.Println("star sync save error:", err)
+	}
+}
+
+// deal adds or removes a song in the favorite folder. aid is looked up when
+// it is not known yet.
+func (s *StarSyncer) deal(id string, aid int, add bool) error {
+	if aid == 0 {
+		video, err := s.client.GetVideoInfo(id)
+		if err != nil {
+			return err
+		}
+		aid = video.AVID
+	}
+	if add {
+		return s.client.DealFavResource(aid, []string{s.mediaID}, nil)
+	}
+	return s.client.DealFavResource(aid, nil, []string{s.mediaID})
+}
+
+// Sync pulls the favorite folder and reconciles it with the local starred set.
+func (s *StarSyncer) Sync() error {
+	s.syncing.Lock()
+	defer s.syncing.Unlock()
+
+	s.mu.Lock()
+	base := slices.Clone(s.state.Base)
+	dirty := make(map[string]bool, len(s.state.Dirty))
+	for id := range s.state.Dirty {
+		dirty[id] = true
+	}
+	s.mu.Unlock()
+
+	videos, err := s.client.GetFavoriteList(s.mediaID)
+	if err != nil {
+		return err
+	}
+	remote := make([]string, 0, len(videos))
+	aids := map[string]int{}
+	for _, v := range videos {
+		remote = append(remote, v.ID)
+		aids[v.ID] = v.AVID
+	}
+
+	local, err := getStarredSongs()
+	if err != nil {
+		return err
+	}
+	// 收藏的音频不在收藏夹中，不参与同步
+	local = slices.DeleteFunc(local, isAudioID)
+
+	m := mergeStars(local, remote, base, dirty)
+
+	for _, id := range m.StarLocal {
+		if err := starSong(id); err != nil {
+			return err
+		}
+	}
+	for _, v := range videos {
+		if slices.Contains(m.StarLocal, v.ID) {
+			if err := saveVideoMeta(&v); err != nil {
+				log.Println("save song meta error:", err)
+			}
+		}
+	}
+	for _, id := range m.UnstarLocal {
+		if err := unstarSong(id); err != nil {
+			return err
+		}
+	}
+
+	result := map[string]bool{}
+	for _, id := range remote {
+		result[id] = true
+	}
+	var pushErr error
+	for _, id := range m.AddRemote {
+		if err := s.deal(id, 0, true); err != nil {
+			pushErr = err
+			continue
+		}
+		result[id] = true
+	}
+	for _, id := range m.DelRemote {
+		if err := s.deal(id, aids[id], false); err != nil {
+			pushErr = err
+			continue
+		}
+		delete(result, id)
+	}
+	// 两端已经一致的歌曲不再需要推送
+	final := toSet(local)
+	for _, id := range m.StarLocal {
+		final[id] = true
+	}
+	for _, id := range m.UnstarLocal {
+		delete(final, id)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 同步期间新推送失败的歌曲留到下一次同步
+	for id := range dirty {
+		if final[id] == result[id] {
+			delete(s.state.Dirty, id)
+		}
+	}
+
+	s.state.Base = make([]string, 0, len(result))
+	for id := range result {
+		s.state.Base = append(s.state.Base, id)
+	}
+	if err := s.save_nl(); err != nil {
+		return err
+	}
+	if pushErr != nil {
+		return fmt.Errorf("push to favorite folder: %v", pushErr)
+	}
+	return nil
+}
+
+// Run syncs immediately and then every interval until the process exits.
+func (s *StarSyncer) Run(interval time.Duration) {
+	for {
+		if err := s.Sync(); err != nil {
+			log.Println("star sync error:", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// starMerge 是一次三方合并需要执行的操作
+type starMerge struct {
+	StarLocal   []string
+	UnstarLocal []string
+	AddRemote   []string
+	DelRemote   []string
+}
+
+// mergeStars compares the local and remote sets against base, the remote set
+// at the last sync. A side that differs from base has changed and its change
+// is applied to the other side. When both sides changed the same song, local
+// changes that have not been pushed yet (dirty) win.
+func mergeStars(local, remote, base []string, dirty map[string]bool) starMerge {
+	inLocal := toSet(local)
+	inRemote := toSet(remote)
+	inBase := toSet(base)
+
+	var ids []string
+	seen := map[string]bool{}
+	for _, list := range [][]string{local, remote, base} {
+		for _, id := range list {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	var m starMerge
+	for _, id := range ids {
+		l, r, b := inLocal[id], inRemote[id], inBase[id]
+		if l == r {
+			continue
+		}
+		// 远端相对上次同步没有变化，或者本地有未推送的修改：以本地为准
+		if r == b || dirty[id] {
+			if l {
+				m.AddRemote = append(m.AddRemote, id)
+			} else {
+				m.DelRemote = append(m.DelRemote, id)
+			}
+			continue
+		}
+		if r {
+			m.StarLocal = append(m.StarLocal, id)
+		} else {
+			m.UnstarLocal = append(m.UnstarLocal, id)
+		}
+	}
+	return m
+}
+
+func toSet(list []string) map[string]bool {
+	set := make(map[string]bool, len(list))
+	for _, id := range list {
+		set[id] = true
+	}
+	return set
+}
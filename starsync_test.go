@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func sorted(list []string) []string {
+	sort.Strings(list)
+	return list
+}
+
+func TestMergeStars(t *testing.T) {
+	local := []string{"keep", "localAdd", "remoteDel"}
+	remote := []string{"keep", "remoteAdd", "localDel"}
+	base := []string{"keep", "remoteDel", "localDel"}
+
+	m := mergeStars(local, remote, base, nil)
+
+	if want := []string{"remoteAdd"}; !reflect.DeepEqual(m.StarLocal, want) {
+		t.Errorf("StarLocal = %v, want %v", m.StarLocal, want)
+	}
+	if want := []string{"remoteDel"}; !reflect.DeepEqual(m.UnstarLocal, want) {
+		t.Errorf("UnstarLocal = %v, want %v", m.UnstarLocal, want)
+	}
+	if want := []string{"localAdd"}; !reflect.DeepEqual(m.AddRemote, want) {
+		t.Errorf("AddRemote = %v, want %v", m.AddRemote, want)
+	}
+	if want := []string{"localDel"}; !reflect.DeepEqual(m.DelRemote, want) {
+		t.Errorf("DelRemote = %v, want %v", m.DelRemote, want)
+	}
+}
+
+func TestMergeStarsDirtyLocalWins(t *testing.T) {
+	// 远端删除了 a，同时本地重新收藏了 a 但没能推送
+	local := []string{"a", "b"}
+	remote := []string{"c"}
+	base := []string{"a", "b"}
+	dirty := map[string]bool{"a": true}
+
+	m := mergeStars(local, remote, base, dirty)
+
+	if want := []string{"a"}; !reflect.DeepEqual(m.AddRemote, want) {
+		t.Errorf("AddRemote = %v, want %v", m.AddRemote, want)
+	}
+	if want := []string{"b"}; !reflect.DeepEqual(m.UnstarLocal, want) {
+		t.Errorf("UnstarLocal = %v, want %v", m.UnstarLocal, want)
+	}
+	if want := []string{"c"}; !reflect.DeepEqual(sorted(m.StarLocal), want) {
+		t.Errorf("StarLocal = %v, want %v", m.StarLocal, want)
+	}
+}
+
+func TestStarSyncRequiresMediaID(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.StarSync.Enabled = true
+	if err := cfg.validate(); err == nil {
+		t.Fatal("starSync without mediaId accepted")
+	}
+	cfg.StarSync.MediaID = "123"
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+}
@@ -0,0 +1,804 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"example/subsonic/bilibili"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Repository 保存服务端的全部状态：收藏、歌单、播放次数、用户以及其他模块的内部状态
+type Repository interface {
+	// Starred 返回所有收藏（歌曲、艺术家、专辑），按收藏时间排序
+	Starred() ([]StarInfo, error)
+	// Star 保存收藏，已收藏时只更新元数据，保留原来的收藏时间
+	Star(s StarInfo) error
+	Unstar(id string) error
+
+	Playlists() ([]PlaylistInfo, error)
+	Playlist(id string) (PlaylistInfo, error)
+	CreatePlaylist(p PlaylistInfo) error
+	// UpdatePlaylist runs fn on the stored playlist and saves the result
+	// atomically. Returning an error from fn discards the change.
+	UpdatePlaylist(id string, fn func(p *PlaylistInfo) error) (PlaylistInfo, error)
+	DeletePlaylist(id string) error
+
+	// SongMeta 返回缓存的歌曲元数据，不存在时 ok 为 false
+	SongMeta(id string) (meta SongMeta, ok bool, err error)
+	SaveSongMeta(m SongMeta) error
+	// SongOverride 返回手动修正的歌曲元数据，不存在时 ok 为 false
+	SongOverride(id string) (o SongOverride, ok bool, err error)
+	// SongOverrides 返回所有修正，按歌曲 ID 排序
+	SongOverrides() ([]SongOverride, error)
+	// SaveSongOverrides 保存修正，没有修改任何字段的修正会被删除
+	SaveSongOverrides(overrides ...SongOverride) error
+	DeleteSongOverride(id string) error
+
+	// SetRating 保存用户对歌曲、专辑或艺术家的评分（1-5），0 表示删除评分
+	SetRating(user string, id string, rating int) error
+	UserRating(user string, id string) (int, error)
+	// AverageRating 返回所有用户评分的平均值，没有评分时为 0
+	AverageRating(id string) (float64, error)
+	// CoinGiven 返回是否已经给歌曲投过币；投币无法撤回，每首歌只投一次
+	CoinGiven(id string) (bool, error)
+	MarkCoinGiven(id string) error
+
+	PlayCount(id string) (PlayCount, error)
+	// AddPlay 记录一次播放到播放历史，并更新歌曲的播放次数
+	AddPlay(p Play) error
+	// RecentPlays 返回 user 最近的 limit 次播放，新的在前；user 为空时返回所有用户的
+	RecentPlays(user string, limit int) ([]Play, error)
+
+	// PlayQueue 返回用户保存的播放队列，没有时 ok 为 false
+	PlayQueue(user string) (q PlayQueue, ok bool, err error)
+	SavePlayQueue(q PlayQueue) error
+	// Bookmarks 返回用户的书签，按歌曲 ID 排序
+	Bookmarks(user string) ([]Bookmark, error)
+	// SaveBookmark 创建或覆盖用户对一首歌的书签，保留原来的创建时间
+	SaveBookmark(b Bookmark) error
+	DeleteBookmark(user string, id string) error
+
+	User(name string) (User, error)
+	Users() ([]User, error)
+	SaveUser(u User) error
+
+	// LoadState/SaveState 保存其他模块的 JSON 状态，例如收藏夹同步
+	LoadState(key string, v interface{}) error
+	SaveState(key string, v interface{}) error
+
+	Close() error
+}
+
+const (
+	StarKindSong   = "song"
+	StarKindArtist = "artist"
+	StarKindAlbum  = "album"
+)
+
+type StarInfo struct {
+	ID      string    `json:"id"`
+	Kind    string    `json:"kind"`
+	Starred time.Time `json:"starred"`
+	// 艺术家和专辑的元数据，歌曲的元数据在 SongMeta 中
+	Name      string `json:"name,omitempty"`
+	Artist    string `json:"artist,omitempty"`
+	ArtistID  string `json:"artistId,omitempty"`
+	CoverArt  string `json:"coverArt,omitempty"`
+	SongCount int    `json:"songCount,omitempty"`
+}
+
+// SongMeta 是缓存的歌曲元数据，避免每次请求都访问 bilibili
+type SongMeta struct {
+	bilibili.BilibiliVideo
+	// Unavailable 视频已删除或不可见，保留最后一次获取到的信息
+	Unavailable bool      `json:"unavailable,omitempty"`
+	Updated     time.Time `json:"updated"`
+	// Tags 为视频的标签，只在开启标签流派时获取；TagsFetched 表示已经获取过
+	Tags        []string `json:"tags,omitempty"`
+	TagsFetched bool     `json:"tagsFetched,omitempty"`
+	// Stream 是第一次播放时获得的音频格式和响度
+	Stream *StreamInfo `json:"stream,omitempty"`
+}
+
+// SongOverride 是手动修正的歌曲元数据，覆盖从 bilibili 获取和整理出的信息，
+// 空字段表示不修改
+type SongOverride struct {
+	ID       string    `json:"id"`
+	Title    string    `json:"title,omitempty"`
+	Artist   string    `json:"artist,omitempty"`
+	Album    string    `json:"album,omitempty"`
+	Track    int       `json:"track,omitempty"`
+	Year     int       `json:"year,omitempty"`
+	Genre    string    `json:"genre,omitempty"`
+	CoverArt string    `json:"coverArt,omitempty"`
+	Updated  time.Time `json:"updated"`
+}
+
+// IsEmpty reports whether o changes nothing.
+func (o SongOverride) IsEmpty() bool {
+	return o.Title == "" && o.Artist == "" && o.Album == "" && o.Track == 0 && o.Year == 0 && o.Genre == "" && o.CoverArt == ""
+}
+
+type PlayCount struct {
+	Count      int       `json:"count"`
+	LastPlayed time.Time `json:"lastPlayed"`
+}
+
+// Play 是播放历史中的一条记录
+type Play struct {
+	ID     string    `json:"id"`
+	User   string    `json:"user"`
+	Client string    `json:"client,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// PlayQueue 是用户保存的播放队列，用于在不同设备间继续播放
+type PlayQueue struct {
+	User    string   `json:"user"`
+	SongIDs []string `json:"songIds"`
+	Current string   `json:"current,omitempty"`
+	// Position 为当前歌曲的播放位置，单位毫秒
+	Position  int64     `json:"position"`
+	Changed   time.Time `json:"changed"`
+	ChangedBy string    `json:"changedBy"`
+}
+
+// Bookmark 是用户在一首歌中的播放位置，适合很长的讲座和直播录像
+type Bookmark struct {
+	User     string    `json:"user"`
+	ID       string    `json:"id"`
+	Position int64     `json:"position"`
+	Comment  string    `json:"comment,omitempty"`
+	Created  time.Time `json:"created"`
+	Changed  time.Time `json:"changed"`
+}
+
+type User struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	Admin    bool   `json:"admin"`
+}
+
+var errUserNotFound = fmt.Errorf("user not found")
+
+// repo 是进程内唯一的存储，由 main 打开
+var repo Repository
+
+var (
+	bucketMeta      = []byte("meta")
+	bucketStars     = []byte("stars")
+	bucketPlaylists = []byte("playlists")
+	bucketPlays     = []byte("plays")
+	bucketUsers     = []byte("users")
+	bucketState     = []byte("state")
+	bucketSongs     = []byte("songs")
+	bucketRatings   = []byte("ratings")
+	bucketHistory   = []byte("history")
+	bucketQueues    = []byte("playQueues")
+	bucketBookmarks = []byte("bookmarks")
+	bucketOverrides = []byte("songOverrides")
+	bucketCoins     = []byte("coins")
+
+	keySchemaVersion = []byte("schemaVersion")
+)
+
+// migrations[i] 将数据库从版本 i 升级到 i+1，只能追加不能修改
+var migrations = []func(tx *bolt.Tx) error{
+	migrateInitial,
+	migrateSongs,
+	migrateStarKinds,
+	migrateRatings,
+	migrateHistory,
+	migrateBookmarks,
+	migrateOverrides,
+	migrateCoins,
+}
+
+type boltRepository struct {
+	db *bolt.DB
+}
+
+// openRepository opens (or creates) the bbolt database at path and runs any
+// pending migrations.
+func openRepository(path string) (Repository, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltRepository{db: db}, nil
+}
+
+func migrate(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(bucketMeta)
+		if err != nil {
+			return err
+		}
+		version := 0
+		if v := meta.Get(keySchemaVersion); v != nil {
+			json.Unmarshal(v, &version)
+		}
+		if version > len(migrations) {
+			return fmt.Errorf("database schema version %d is newer than supported version %d", version, len(migrations))
+		}
+		for ; version < len(migrations); version++ {
+			log.Printf("migrating database to schema version %d", version+1)
+			if err := migrations[version](tx); err != nil {
+				return fmt.Errorf("migration %d: %v", version+1, err)
+			}
+		}
+		v, _ := json.Marshal(version)
+		return meta.Put(keySchemaVersion, v)
+	})
+}
+
+// migrateInitial creates the buckets and imports starred.dat, playlists.dat
+// and starsync.dat written by earlier versions. The legacy files are left in
+// place but no longer read.
+func migrateInitial(tx *bolt.Tx) error {
+	for _, name := range [][]byte{bucketStars, bucketPlaylists, bucketPlays, bucketUsers, bucketState} {
+		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+			return err
+		}
+	}
+
+	// 默认用户，与原先硬编码的账号一致
+	if err := putJSON(tx.Bucket(bucketUsers), "voyage", User{Name: "voyage", Password: "141592", Admin: true}); err != nil {
+		return err
+	}
+
+	if data, err := os.ReadFile("starred.dat"); err == nil {
+		now := time.Now()
+		stars := tx.Bucket(bucketStars)
+		for i, id := range strings.Split(string(data), "\n") {
+			if id == "" {
+				continue
+			}
+			// 保持文件中的顺序
+			star := StarInfo{ID: id, Starred: now.Add(time.Duration(i) * time.Millisecond)}
+			if err := putJSON(stars, id, star); err != nil {
+				return err
+			}
+		}
+		log.Println("imported starred.dat")
+	}
+
+	if data, err := os.ReadFile("playlists.dat"); err == nil {
+		var legacy []PlaylistInfo
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return fmt.Errorf("parse playlists.dat: %v", err)
+		}
+		now := time.Now()
+		for i, p := range legacy {
+			// 旧版本的 playlists.dat 只有 bilibili 收藏夹歌单
+			if p.Kind == "" {
+				p.Kind = PlaylistKindBili
+				p.Public = true
+			}
+			if p.Created.IsZero() {
+				p.Created = now.Add(time.Duration(i) * time.Millisecond)
+				p.Changed = p.Created
+			}
+			if err := putJSON(tx.Bucket(bucketPlaylists), p.ID, p); err != nil {
+				return err
+			}
+		}
+		log.Println("imported playlists.dat")
+	}
+
+	if data, err := os.ReadFile("starsync.dat"); err == nil {
+		if err := tx.Bucket(bucketState).Put([]byte("starSync"), data); err != nil {
+			return err
+		}
+		log.Println("imported starsync.dat")
+	}
+	return nil
+}
+
+// migrateSongs adds the song metadata cache.
+func migrateSongs(tx *bolt.Tx) error {
+	_, err := tx.CreateBucketIfNotExists(bucketSongs)
+	return err
+}
+
+// migrateStarKinds marks existing stars, which could only be songs, as such.
+func migrateStarKinds(tx *bolt.Tx) error {
+	b := tx.Bucket(bucketStars)
+	updated := map[string]StarInfo{}
+	err := b.ForEach(func(k, v []byte) error {
+		var s StarInfo
+		if err := json.Unmarshal(v, &s); err != nil {
+			return err
+		}
+		if s.Kind == "" {
+			s.Kind = StarKindSong
+			updated[string(k)] = s
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for k, s := range updated {
+		if err := putJSON(b, k, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateRatings adds per-user ratings, keyed by "<id>\x00<user>".
+func migrateRatings(tx *bolt.Tx) error {
+	_, err := tx.CreateBucketIfNotExists(bucketRatings)
+	return err
+}
+
+// migrateHistory adds the play history, keyed by play time and a sequence
+// number so that plays submitted late still sort chronologically.
+func migrateHistory(tx *bolt.Tx) error {
+	_, err := tx.CreateBucketIfNotExists(bucketHistory)
+	return err
+}
+
+// migrateBookmarks adds per-user play queues, keyed by user, and bookmarks,
+// keyed by "<user>\x00<id>".
+func migrateBookmarks(tx *bolt.Tx) error {
+	if _, err := tx.CreateBucketIfNotExists(bucketQueues); err != nil {
+		return err
+	}
+	_, err := tx.CreateBucketIfNotExists(bucketBookmarks)
+	return err
+}
+
+// migrateOverrides adds manual song metadata overrides, keyed by song ID.
+func migrateOverrides(tx *bolt.Tx) error {
+	_, err := tx.CreateBucketIfNotExists(bucketOverrides)
+	return err
+}
+
+// migrateCoins adds the songs given a coin, keyed by song ID with the time
+// of the coin.
+func migrateCoins(tx *bolt.Tx) error {
+	_, err := tx.CreateBucketIfNotExists(bucketCoins)
+	return err
+}
+
+func ratingKey(id string, user string) []byte {
+	return []byte(id + "\x00" + user)
+}
+
+func putJSON(b *bolt.Bucket, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), data)
+}
+
+func (r *boltRepository) Close() error {
+	return r.db.Close()
+}
+
+func (r *boltRepository) Starred() ([]StarInfo, error) {
+	var stars []StarInfo
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketStars).ForEach(func(k, v []byte) error {
+			var s StarInfo
+			if err := json.Unmarshal(v, &s); err != nil {
+				return err
+			}
+			stars = append(stars, s)
+			return nil
+		})
+	})
+	sort.SliceStable(stars, func(i, j int) bool {
+		return stars[i].Starred.Before(stars[j].Starred)
+	})
+	return stars, err
+}
+
+func (r *boltRepository) Star(s StarInfo) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketStars)
+		if v := b.Get([]byte(s.ID)); v != nil {
+			var old StarInfo
+			if err := json.Unmarshal(v, &old); err != nil {
+				return err
+			}
+			s.Starred = old.Starred
+		}
+		if s.Starred.IsZero() {
+			s.Starred = time.Now()
+		}
+		return putJSON(b, s.ID, s)
+	})
+}
+
+func (r *boltRepository) Unstar(id string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketStars).Delete([]byte(id))
+	})
+}
+
+func (r *boltRepository) Playlists() ([]PlaylistInfo, error) {
+	var playlists []PlaylistInfo
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketPlaylists).ForEach(func(k, v []byte) error {
+			var p PlaylistInfo
+			if err := json.Unmarshal(v, &p); err != nil {
+				return err
+			}
+			playlists = append(playlists, p)
+			return nil
+		})
+	})
+	sort.SliceStable(playlists, func(i, j int) bool {
+		return playlists[i].Created.Before(playlists[j].Created)
+	})
+	return playlists, err
+}
+
+func (r *boltRepository) Playlist(id string) (PlaylistInfo, error) {
+	var p PlaylistInfo
+	err := r.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketPlaylists).Get([]byte(id))
+		if v == nil {
+			return errPlaylistNotFound
+		}
+		return json.Unmarshal(v, &p)
+	})
+	return p, err
+}
+
+func (r *boltRepository) CreatePlaylist(p PlaylistInfo) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketPlaylists), p.ID, p)
+	})
+}
+
+func (r *boltRepository) UpdatePlaylist(id string, fn func(p *PlaylistInfo) error) (PlaylistInfo, error) {
+	var p PlaylistInfo
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketPlaylists)
+		v := b.Get([]byte(id))
+		if v == nil {
+			return errPlaylistNotFound
+		}
+		if err := json.Unmarshal(v, &p); err != nil {
+			return err
+		}
+		if err := fn(&p); err != nil {
+			return err
+		}
+		return putJSON(b, id, p)
+	})
+	return p, err
+}
+
+func (r *boltRepository) DeletePlaylist(id string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketPlaylists)
+		if b.Get([]byte(id)) == nil {
+			return errPlaylistNotFound
+		}
+		return b.Delete([]byte(id))
+	})
+}
+
+func (r *boltRepository) SongMeta(id string) (SongMeta, bool, error) {
+	var m SongMeta
+	var ok bool
+	err := r.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketSongs).Get([]byte(id))
+		if v == nil {
+			return nil
+		}
+		ok = true
+		return json.Unmarshal(v, &m)
+	})
+	return m, ok, err
+}
+
+func (r *boltRepository) SaveSongMeta(m SongMeta) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketSongs), m.ID, m)
+	})
+}
+
+func (r *boltRepository) SongOverride(id string) (SongOverride, bool, error) {
+	var o SongOverride
+	var ok bool
+	err := r.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketOverrides).Get([]byte(id))
+		if v == nil {
+			return nil
+		}
+		ok = true
+		return json.Unmarshal(v, &o)
+	})
+	return o, ok, err
+}
+
+func (r *boltRepository) SongOverrides() ([]SongOverride, error) {
+	var result []SongOverride
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketOverrides).ForEach(func(k, v []byte) error {
+			var o SongOverride
+			if err := json.Unmarshal(v, &o); err != nil {
+				return err
+			}
+			result = append(result, o)
+			return nil
+		})
+	})
+	return result, err
+}
+
+func (r *boltRepository) SaveSongOverrides(overrides ...SongOverride) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketOverrides)
+		for _, o := range overrides {
+			if o.IsEmpty() {
+				if err := b.Delete([]byte(o.ID)); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := putJSON(b, o.ID, o); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *boltRepository) DeleteSongOverride(id string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketOverrides).Delete([]byte(id))
+	})
+}
+
+func (r *boltRepository) SetRating(user string, id string, rating int) error {
+	if rating < 0 || rating > 5 {
+		return fmt.Errorf("invalid rating: %d", rating)
+	}
+	return r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketRatings)
+		if rating == 0 {
+			return b.Delete(ratingKey(id, user))
+		}
+		return putJSON(b, string(ratingKey(id, user)), rating)
+	})
+}
+
+func (r *boltRepository) UserRating(user string, id string) (int, error) {
+	var rating int
+	err := r.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(bucketRatings).Get(ratingKey(id, user)); v != nil {
+			return json.Unmarshal(v, &rating)
+		}
+		return nil
+	})
+	return rating, err
+}
+
+func (r *boltRepository) AverageRating(id string) (float64, error) {
+	var sum, count int
+	err := r.db.View(func(tx *bolt.Tx) error {
+		prefix := []byte(id + "\x00")
+		c := tx.Bucket(bucketRatings).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var rating int
+			if err := json.Unmarshal(v, &rating); err != nil {
+				return err
+			}
+			sum += rating
+			count++
+		}
+		return nil
+	})
+	if count == 0 {
+		return 0, err
+	}
+	return float64(sum) / float64(count), err
+}
+
+func (r *boltRepository) CoinGiven(id string) (bool, error) {
+	var given bool
+	err := r.db.View(func(tx *bolt.Tx) error {
+		given = tx.Bucket(bucketCoins).Get([]byte(id)) != nil
+		return nil
+	})
+	return given, err
+}
+
+func (r *boltRepository) MarkCoinGiven(id string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketCoins), id, time.Now())
+	})
+}
+
+func (r *boltRepository) PlayCount(id string) (PlayCount, error) {
+	var pc PlayCount
+	err := r.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(bucketPlays).Get([]byte(id)); v != nil {
+			return json.Unmarshal(v, &pc)
+		}
+		return nil
+	})
+	return pc, err
+}
+
+func (r *boltRepository) AddPlay(p Play) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		history := tx.Bucket(bucketHistory)
+		seq, err := history.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 16)
+		binary.BigEndian.PutUint64(key, uint64(p.Time.UnixNano()))
+		binary.BigEndian.PutUint64(key[8:], seq)
+		data, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		if err := history.Put(key, data); err != nil {
+			return err
+		}
+
+		b := tx.Bucket(bucketPlays)
+		var pc PlayCount
+		if v := b.Get([]byte(p.ID)); v != nil {
+			if err := json.Unmarshal(v, &pc); err != nil {
+				return err
+			}
+		}
+		pc.Count++
+		if p.Time.After(pc.LastPlayed) {
+			pc.LastPlayed = p.Time
+		}
+		return putJSON(b, p.ID, pc)
+	})
+}
+
+func (r *boltRepository) RecentPlays(user string, limit int) ([]Play, error) {
+	var plays []Play
+	err := r.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketHistory).Cursor()
+		for k, v := c.Last(); k != nil && len(plays) < limit; k, v = c.Prev() {
+			var p Play
+			if err := json.Unmarshal(v, &p); err != nil {
+				return err
+			}
+			if user == "" || p.User == user {
+				plays = append(plays, p)
+			}
+		}
+		return nil
+	})
+	return plays, err
+}
+
+func (r *boltRepository) PlayQueue(user string) (PlayQueue, bool, error) {
+	var q PlayQueue
+	var ok bool
+	err := r.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketQueues).Get([]byte(user))
+		if v == nil {
+			return nil
+		}
+		ok = true
+		return json.Unmarshal(v, &q)
+	})
+	return q, ok, err
+}
+
+func (r *boltRepository) SavePlayQueue(q PlayQueue) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketQueues)
+		if len(q.SongIDs) == 0 {
+			return b.Delete([]byte(q.User))
+		}
+		return putJSON(b, q.User, q)
+	})
+}
+
+func (r *boltRepository) Bookmarks(user string) ([]Bookmark, error) {
+	var bookmarks []Bookmark
+	err := r.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketBookmarks).Cursor()
+		prefix := []byte(user + "\x00")
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var b Bookmark
+			if err := json.Unmarshal(v, &b); err != nil {
+				return err
+			}
+			bookmarks = append(bookmarks, b)
+		}
+		return nil
+	})
+	return bookmarks, err
+}
+
+func (r *boltRepository) SaveBookmark(bm Bookmark) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketBookmarks)
+		key := bm.User + "\x00" + bm.ID
+		if v := b.Get([]byte(key)); v != nil {
+			var old Bookmark
+			if err := json.Unmarshal(v, &old); err != nil {
+				return err
+			}
+			bm.Created = old.Created
+		}
+		return putJSON(b, key, bm)
+	})
+}
+
+func (r *boltRepository) DeleteBookmark(user string, id string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketBookmarks).Delete([]byte(user + "\x00" + id))
+	})
+}
+
+func (r *boltRepository) User(name string) (User, error) {
+	var u User
+	err := r.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketUsers).Get([]byte(name))
+		if v == nil {
+			return errUserNotFound
+		}
+		return json.Unmarshal(v, &u)
+	})
+	return u, err
+}
+
+func (r *boltRepository) Users() ([]User, error) {
+	var users []User
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketUsers).ForEach(func(k, v []byte) error {
+			var u User
+			if err := json.Unmarshal(v, &u); err != nil {
+				return err
+			}
+			users = append(users, u)
+			return nil
+		})
+	})
+	return users, err
+}
+
+func (r *boltRepository) SaveUser(u User) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketUsers), u.Name, u)
+	})
+}
+
+func (r *boltRepository) LoadState(key string, v interface{}) error {
+	return r.db.View(func(tx *bolt.Tx) error {
+		if data := tx.Bucket(bucketState).Get([]byte(key)); data != nil {
+			return json.Unmarshal(data, v)
+		}
+		return nil
+	})
+}
+
+func (r *boltRepository) SaveState(key string, v interface{}) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketState), key, v)
+	})
+}
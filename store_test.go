@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// useTestRepo points repo at a fresh database in a temporary working directory.
+func useTestRepo(t *testing.T) {
+	t.Chdir(t.TempDir())
+	r, err := openRepository("test.db")
+	if err != nil {
+		t.Fatalf("openRepository failed: %v", err)
+	}
+	repo = r
+	t.Cleanup(func() { r.Close() })
+}
+
+func TestMigrateImportsLegacyFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	os.WriteFile("starred.dat", []byte("b\na\n"), 0644)
+	os.WriteFile("playlists.dat", []byte(`[{"id":"bili-1","name":"fav","mediaId":"1"}]`+"\n"), 0644)
+
+	r, err := openRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("openRepository failed: %v", err)
+	}
+	defer r.Close()
+
+	stars, err := r.Starred()
+	if err != nil {
+		t.Fatalf("Starred failed: %v", err)
+	}
+	var ids []string
+	for _, s := range stars {
+		if s.Kind != StarKindSong {
+			t.Fatalf("legacy star %q has kind %q", s.ID, s.Kind)
+		}
+		ids = append(ids, s.ID)
+	}
+	if want := []string{"b", "a"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("starred = %v, want %v", ids, want)
+	}
+
+	p, err := r.Playlist("bili-1")
+	if err != nil {
+		t.Fatalf("Playlist failed: %v", err)
+	}
+	if !p.IsBili() || p.MediaID != "1" || !p.Public {
+		t.Fatalf("unexpected playlist %+v", p)
+	}
+
+	if _, err := r.User("voyage"); err != nil {
+		t.Fatalf("default user missing: %v", err)
+	}
+}
+
+func TestMigrateOnlyOnce(t *testing.T) {
+	t.Chdir(t.TempDir())
+	r, err := openRepository("test.db")
+	if err != nil {
+		t.Fatalf("openRepository failed: %v", err)
+	}
+	r.Close()
+
+	// 已经迁移过的数据库不会再导入旧文件
+	os.WriteFile("starred.dat", []byte("a\n"), 0644)
+	r, err = openRepository("test.db")
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer r.Close()
+
+	stars, _ := r.Starred()
+	if len(stars) != 0 {
+		t.Fatalf("legacy file imported twice: %v", stars)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"log"
+	"strings"
+	"sync"
+
+	"example/subsonic/bilibili"
+)
+
+// StreamInfo 是音频流的格式，来自 DASH 信息和音频文件开头的 MP4 头
+type StreamInfo struct {
+	// Codec 为 MP4 中音频的类型，例如 "mp4a"、"fLaC"、"ec-3"
+	Codec string `json:"codec,omitempty"`
+	// BitRate 单位为 kbps
+	BitRate      int `json:"bitRate,omitempty"`
+	ChannelCount int `json:"channelCount,omitempty"`
+	SamplingRate int `json:"samplingRate,omitempty"`
+	// BitDepth 只对无损音频有意义
+	BitDepth int                `json:"bitDepth,omitempty"`
+	Loudness *bilibili.Loudness `json:"loudness,omitempty"`
+}
+
+// fileFormat returns the content type and suffix of audio in codec s.Codec,
+// and ok=false when the codec is unknown.
+func (s *StreamInfo) fileFormat() (contentType, suffix string, ok bool) {
+	switch s.Codec {
+	case "":
+		return "", "", false
+	case "fLaC":
+		return "audio/flac", "flac", true
+	default:
+		// 其余音频都装在 MP4 中
+		return "audio/mp4", "m4a", true
+	}
+}
+
+// streamHeadSize 是解析格式时读取的音频开头长度，DASH 的初始化段通常不到 1KB
+const streamHeadSize = 4096
+
+// mp4AudioEntries 是 MP4 中音频 sample entry 的类型
+var mp4AudioEntries = []string{"mp4a", "fLaC", "ec-3", "ac-3", "Opus"}
+
+// mp4AudioFormat finds the audio sample entry in the head of an MP4 file and
+// returns its format. DASH segments from bilibili start with the moov box.
+func mp4AudioFormat(head []byte) (StreamInfo, bool) {
+	for _, codec := range mp4AudioEntries {
+		i := bytes.Index(head, []byte(codec))
+		// 类型前是 4 字节的长度，之后是 28 字节的 AudioSampleEntry
+		if i < 4 || len(head) < i+4+28 {
+			continue
+		}
+		entry := head[i+4:]
+		channels := int(binary.BigEndian.Uint16(entry[16:18]))
+		sampleSize := int(binary.BigEndian.Uint16(entry[18:20]))
+		sampleRate := int(binary.BigEndian.Uint32(entry[24:28]) >> 16)
+		info := StreamInfo{Codec: codec, ChannelCount: channels, SamplingRate: sampleRate}
+		if codec == "fLaC" {
+			info.BitDepth = sampleSize
+			// 采样率超过 65535 时只有 dfLa 中的 STREAMINFO 是准确的
+			if rate, bits, ok := flacStreamInfo(head); ok {
+				info.SamplingRate, info.BitDepth = rate, bits
+			}
+		}
+		if channels == 0 || channels > 8 || info.SamplingRate == 0 {
+			continue
+		}
+		return info, true
+	}
+	return StreamInfo{}, false
+}
+
+// flacStreamInfo reads the sample rate and bit depth from the STREAMINFO
+// block in the dfLa box of FLAC in MP4.
+func flacStreamInfo(head []byte) (sampleRate int, bitDepth int, ok bool) {
+	i := bytes.Index(head, []byte("dfLa"))
+	// 类型之后是 4 字节的 version/flags、4 字节的块头和 34 字节的 STREAMINFO
+	if i < 4 || len(head) < i+4+4+4+14 {
+		return 0, 0, false
+	}
+	si := head[i+12:]
+	sampleRate = int(si[10])<<12 | int(si[11])<<4 | int(si[12])>>4
+	bitDepth = (int(si[12]&1)<<4 | int(si[13])>>4) + 1
+	return sampleRate, bitDepth, sampleRate > 0
+}
+
+// streamSniffer 记录音频流的开头，读够 streamHeadSize 或关闭时调用一次 done
+type streamSniffer struct {
+	io.ReadCloser
+	head []byte
+	once sync.Once
+	done func(head []byte)
+}
+
+func (s *streamSniffer) Read(p []byte) (int, error) {
+	n, err := s.ReadCloser.Read(p)
+	if len(s.head) < streamHeadSize {
+		s.head = append(s.head, p[:min(n, streamHeadSize-len(s.head))]...)
+		if len(s.head) == streamHeadSize {
+			s.finish()
+		}
+	}
+	return n, err
+}
+
+func (s *streamSniffer) Close() error {
+	s.finish()
+	return s.ReadCloser.Close()
+}
+
+func (s *streamSniffer) finish() {
+	s.once.Do(func() { s.done(s.head) })
+}
+
+// sniffStream wraps the audio stream of song id so that its format is
+// recorded the first time it is played. play is the play info the stream of a
+// video was opened from, nil for audio songs.
+func sniffStream(client *bilibili.BilibiliClient, id string, rc io.ReadCloser, play *bilibili.PlayInfo) io.ReadCloser {
+	if m, ok, _ := repo.SongMeta(id); ok && m.Stream != nil {
+		return rc
+	}
+	return &streamSniffer{ReadCloser: rc, done: func(head []byte) {
+		go recordStreamInfo(client, id, head, play)
+	}}
+}
+
+// recordStreamInfo saves the format of song id parsed from the head of its
+// audio, with the bit rate and loudness from play when it is known.
+func recordStreamInfo(client *bilibili.BilibiliClient, id string, head []byte, play *bilibili.PlayInfo) {
+	info, _ := mp4AudioFormat(head)
+	if play != nil {
+		info.BitRate = play.Bandwidth / 1000
+		info.Loudness = play.Loudness
+		if info.Codec == "" {
+			info.Codec, _, _ = strings.Cut(play.Codecs, ".")
+		}
+	}
+	if info == (StreamInfo{}) {
+		return
+	}
+	m := lookupSongMetas(client, []string{id}, 1)[0]
+	if m.Updated.IsZero() || m.Unavailable {
+		return
+	}
+	m.Stream = &info
+	if err := saveSongMeta(m); err != nil {
+		log.Println("save song meta error:", err)
+	}
+}
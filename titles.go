@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"example/subsonic/bilibili"
+)
+
+// trackInfo 是从视频标题中整理出的歌名和歌手
+type trackInfo struct {
+	Title string
+	// Artist 为第一位歌手，DisplayArtist 为完整的署名，例如 "DAOKO × 米津玄師"
+	Artist        string
+	DisplayArtist string
+}
+
+// uploaderTitleRule 是单个 UP 主的整理规则
+type uploaderTitleRule struct {
+	artist    string
+	keepTitle bool
+	pattern   *regexp.Regexp
+}
+
+// titleCleaner 按顺序整理视频标题：UP 主的规则、规则文件中的删除和提取规则、
+// 内置的【】等标注删除、“歌手 - 歌名”和《》提取，都不匹配时使用 UP 主作为歌手
+type titleCleaner struct {
+	enabled   bool
+	strip     []*regexp.Regexp
+	extract   []*regexp.Regexp
+	uploaders map[int]uploaderTitleRule
+}
+
+// titles 是全局的标题整理规则，main 按配置替换
+var titles = &titleCleaner{enabled: true}
+
+// newTitleCleaner compiles the title rules of cfg, reading its rules file.
+func newTitleCleaner(cfg TitlesConfig) (*titleCleaner, error) {
+	tc := &titleCleaner{enabled: cfg.Enabled, uploaders: map[int]uploaderTitleRule{}}
+	if cfg.RulesFile != "" {
+		if err := tc.loadRules(cfg.RulesFile); err != nil {
+			return nil, err
+		}
+	}
+	for key, r := range cfg.Uploaders {
+		mid, err := strconv.Atoi(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uploader mid: %s", key)
+		}
+		rule := uploaderTitleRule{artist: r.Artist, keepTitle: r.KeepTitle}
+		if r.Pattern != "" {
+			if rule.pattern, err = regexp.Compile(r.Pattern); err != nil {
+				return nil, fmt.Errorf("uploader %d: %v", mid, err)
+			}
+			if rule.pattern.SubexpIndex("title") < 0 {
+				return nil, fmt.Errorf("uploader %d: pattern has no title group", mid)
+			}
+		}
+		tc.uploaders[mid] = rule
+	}
+	return tc, nil
+}
+
+// loadRules reads a rules file: one regular expression per line, blank lines
+// and lines starting with # ignored. Rules with a (?P<title>) group, and
+// optionally (?P<artist>), extract the song; the others are removed from the
+// title.
+func (tc *titleCleaner) loadRules(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		re, err := regexp.Compile(line)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		if re.SubexpIndex("title") >= 0 {
+			tc.extract = append(tc.extract, re)
+		} else {
+			tc.strip = append(tc.strip, re)
+		}
+	}
+	return scanner.Err()
+}
+
+// clean returns the song of video v.
+func (tc *titleCleaner) clean(v *bilibili.BilibiliVideo) trackInfo {
+	if !tc.enabled {
+		return trackInfo{Title: v.Title, Artist: v.Author, DisplayArtist: v.Author}
+	}
+
+	rule := tc.uploaders[v.MID]
+	var artist, title string
+	switch {
+	case rule.keepTitle:
+		title = v.Title
+	case rule.pattern != nil:
+		artist, title = matchTrack(rule.pattern, v.Title)
+	}
+	if title == "" {
+		t := v.Title
+		for _, re := range tc.strip {
+			t = re.ReplaceAllString(t, " ")
+		}
+		for _, re := range tc.extract {
+			if artist, title = matchTrack(re, t); title != "" {
+				break
+			}
+		}
+		if title == "" {
+			artist, title = cleanTrack(t, "")
+		}
+	}
+
+	if rule.artist != "" {
+		artist = rule.artist
+	}
+	if artist == "" {
+		artist = v.Author
+	}
+	return trackInfo{Title: title, Artist: primaryArtist(artist), DisplayArtist: artist}
+}
+
+// matchTrack applies an extraction rule to title.
+func matchTrack(re *regexp.Regexp, title string) (artist string, track string) {
+	m := re.FindStringSubmatch(title)
+	if m == nil {
+		return "", ""
+	}
+	if i := re.SubexpIndex("artist"); i >= 0 {
+		artist = strings.TrimSpace(m[i])
+	}
+	return artist, strings.TrimSpace(m[re.SubexpIndex("title")])
+}
+
+// 多位歌手之间的分隔符
+var artistSeparators = []string{" × ", " x ", " X ", " feat. ", " ft. ", "&", "、", "/", "，"}
+
+// splitArtists returns the artists credited in artist.
+func splitArtists(artist string) []string {
+	names := []string{artist}
+	for _, sep := range artistSeparators {
+		var split []string
+		for _, name := range names {
+			split = append(split, strings.Split(name, sep)...)
+		}
+		names = split
+	}
+	result := names[:0]
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// primaryArtist returns the first of the artists credited in artist.
+func primaryArtist(artist string) string {
+	if names := splitArtists(artist); len(names) > 0 {
+		return names[0]
+	}
+	return strings.TrimSpace(artist)
+}
+
+var (
+	// 【中字】、[MV]、(Official Video) 之类的标注
+	titleTagPattern = regexp.MustCompile(`【[^】]*】|\[[^\]]*\]|[(（][^)）]*(?i:mv|pv|official|官方|字幕|翻唱|cover|live|4k|1080p|hi-?res|无损)[^)）]*[)）]`)
+	spacesPattern   = regexp.MustCompile(`\s+`)
+)
+
+// cleanTrack strips the tags uploaders put around video titles and splits
+// "artist - title", "artist《title》" or "「title」artist". Without an artist
+// the uploader is used.
+func cleanTrack(title string, uploader string) (artist string, track string) {
+	t := titleTagPattern.ReplaceAllString(title, " ")
+	t = strings.TrimSpace(spacesPattern.ReplaceAllString(t, " "))
+	if t == "" {
+		return uploader, title
+	}
+	for _, sep := range []string{" - ", " – ", " — ", "－"} {
+		if a, b, ok := strings.Cut(t, sep); ok && strings.TrimSpace(a) != "" && strings.TrimSpace(b) != "" {
+			return strings.TrimSpace(a), strings.Trim(strings.TrimSpace(b), "「」《》")
+		}
+	}
+	for _, quote := range [][2]string{{"《", "》"}, {"「", "」"}} {
+		start := strings.Index(t, quote[0])
+		if start < 0 {
+			continue
+		}
+		end := strings.Index(t[start:], quote[1])
+		if end < 0 {
+			continue
+		}
+		name := strings.TrimSpace(t[start+len(quote[0]) : start+end])
+		if name == "" {
+			continue
+		}
+		// 书名号前面是歌手，例如 "周杰伦《晴天》Live"；在开头时后面是歌手
+		if before := strings.TrimSpace(strings.TrimRight(t[:start], " -:：")); before != "" {
+			return before, name
+		}
+		if after := strings.TrimSpace(t[start+end+len(quote[1]):]); after != "" {
+			return after, name
+		}
+		return uploader, name
+	}
+	return uploader, t
+}
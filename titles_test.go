@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"example/subsonic/bilibili"
+)
+
+func TestCleanTrack(t *testing.T) {
+	tests := []struct {
+		title, artist, track string
+	}{
+		{"【中字】YOASOBI - 夜に駆ける (Official Music Video)", "YOASOBI", "夜に駆ける"},
+		{"[MV] 周杰伦 - 晴天", "周杰伦", "晴天"},
+		{"「打上花火」DAOKO × 米津玄師", "DAOKO × 米津玄師", "打上花火"},
+		{"晴天（翻唱）", "up", "晴天"},
+		{"【4K】", "up", "【4K】"},
+	}
+	for _, tt := range tests {
+		artist, track := cleanTrack(tt.title, "up")
+		if artist != tt.artist || track != tt.track {
+			t.Errorf("cleanTrack(%q) = %q, %q; want %q, %q", tt.title, artist, track, tt.artist, tt.track)
+		}
+	}
+}
+
+func TestCleanTrackBookTitle(t *testing.T) {
+	tests := []struct {
+		title, artist, track string
+	}{
+		{"【4K】周杰伦《晴天》Live 2004 无与伦比演唱会 高音质", "周杰伦", "晴天"},
+		{"《晴天》", "up", "晴天"},
+	}
+	for _, tt := range tests {
+		artist, track := cleanTrack(tt.title, "up")
+		if artist != tt.artist || track != tt.track {
+			t.Errorf("cleanTrack(%q) = %q, %q; want %q, %q", tt.title, artist, track, tt.artist, tt.track)
+		}
+	}
+}
+
+func TestTitleCleaner(t *testing.T) {
+	rules := filepath.Join(t.TempDir(), "titles.txt")
+	os.WriteFile(rules, []byte("# 删除规则\n高音质\n\n^翻自(?P<artist>.+?)的(?P<title>.+)$\n"), 0o644)
+	tc, err := newTitleCleaner(TitlesConfig{
+		Enabled:   true,
+		RulesFile: rules,
+		Uploaders: map[string]UploaderTitleConfig{
+			"1": {Artist: "周杰伦"},
+			"2": {KeepTitle: true},
+			"3": {Pattern: `^(?P<title>\S+) 官方`},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		mid   int
+		title string
+		want  trackInfo
+	}{
+		{0, "翻自陈奕迅的十年 高音质", trackInfo{"十年", "陈奕迅", "陈奕迅"}},
+		{0, "DAOKO × 米津玄師 - 打上花火", trackInfo{"打上花火", "DAOKO", "DAOKO × 米津玄師"}},
+		{0, "随便唱唱", trackInfo{"随便唱唱", "up", "up"}},
+		{1, "【MV】晴天", trackInfo{"晴天", "周杰伦", "周杰伦"}},
+		{2, "【MV】晴天", trackInfo{"【MV】晴天", "up", "up"}},
+		{3, "晴天 官方 MV", trackInfo{"晴天", "up", "up"}},
+	}
+	for _, tt := range tests {
+		got := tc.clean(&bilibili.BilibiliVideo{Title: tt.title, Author: "up", MID: tt.mid})
+		if got != tt.want {
+			t.Errorf("clean(%d, %q) = %+v; want %+v", tt.mid, tt.title, got, tt.want)
+		}
+	}
+
+	if _, err := newTitleCleaner(TitlesConfig{Uploaders: map[string]UploaderTitleConfig{"1": {Pattern: "no group"}}}); err == nil {
+		t.Fatal("pattern without title group accepted")
+	}
+	disabled, _ := newTitleCleaner(TitlesConfig{})
+	if got := disabled.clean(&bilibili.BilibiliVideo{Title: "【MV】晴天", Author: "up"}); got.Title != "【MV】晴天" {
+		t.Fatalf("disabled cleaner = %+v", got)
+	}
+}
+
+func TestSongTitleKeepsOriginalAsComment(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addVideo("a", "【4K】周杰伦《晴天》Live")
+	cfg := defaultConfig()
+	router := newTestRouter(fake.client(), &cfg)
+	router.GET("/rest/getSong", GetSongXML)
+
+	w := doGet(router, "/rest/getSong", url.Values{"id": {"a"}})
+	var resp SubsonicResponseXML
+	if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad xml: %v", err)
+	}
+	s := resp.Song
+	if s == nil || s.Title != "晴天" || s.Artist != "周杰伦" || s.DisplayArtist != "周杰伦" || s.Comment != "【4K】周杰伦《晴天》Live" || s.ArtistID != "ar-1" {
+		t.Fatalf("unexpected song: %s", w.Body)
+	}
+}
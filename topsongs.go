@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"example/subsonic/bilibili"
+)
+
+// 获取热门歌曲时最多翻的投稿页数，每页 topSongsPageSize 个
+const (
+	topSongsPageSize = 50
+	topSongsMaxPages = 4
+)
+
+var errArtistNotFound = fmt.Errorf("artist not found")
+
+// resolveArtist returns the mid of the uploader called name. Artist IDs and
+// starred artists are resolved locally; other names are searched, preferring
+// an exact match over the first result.
+func resolveArtist(client *bilibili.BilibiliClient, name string) (int, error) {
+	if mid, ok := parseArtistID(name); ok {
+		return mid, nil
+	}
+	stars, err := repo.Starred()
+	if err != nil {
+		return 0, err
+	}
+	for _, s := range stars {
+		if s.Kind == StarKindArtist && s.Name == name {
+			if mid, ok := parseArtistID(s.ID); ok {
+				return mid, nil
+			}
+		}
+	}
+
+	users, _, err := client.SearchUsers(name, 1)
+	if err != nil {
+		return 0, err
+	}
+	for _, u := range users {
+		if u.Name == name {
+			return u.MID, nil
+		}
+	}
+	if len(users) == 0 {
+		return 0, errArtistNotFound
+	}
+	return users[0].MID, nil
+}
+
+// topSongs returns up to count of the uploader's most played uploads that
+// look like songs.
+func topSongs(client *bilibili.BilibiliClient, mid int, count int) ([]bilibili.BilibiliVideo, error) {
+	var result []bilibili.BilibiliVideo
+	for page := 1; page <= topSongsMaxPages && len(result) < count; page++ {
+		videos, err := client.GetUserVideos(mid, bilibili.OrderClick, page, topSongsPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range videos {
+			if len(result) < count && isSongLike(&v) {
+				result = append(result, v)
+				if err := saveVideoMeta(&v); err != nil {
+					log.Println("save song meta error:", err)
+				}
+			}
+		}
+		if len(videos) < topSongsPageSize {
+			break
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestGetTopSongs(t *testing.T) {
+	useTestRepo(t)
+	fake := newFakeBilibili(t)
+	fake.addUser(2, "up主二号")
+	fake.addUser(1, "up")
+	for i, id := range []string{"a", "b", "c", "vlog"} {
+		fake.addVideo(id, id)
+		fake.updateVideo(id, func(v *fakeVideo) { v.Plays = i })
+	}
+	fake.updateVideo("vlog", func(v *fakeVideo) { v.TID = 21 })
+	cfg := defaultConfig()
+	router := newTestRouter(fake.client(), &cfg)
+	router.GET("/rest/getTopSongs", GetTopSongsHandlerXML)
+
+	top := func(query url.Values) []string {
+		w := doGet(router, "/rest/getTopSongs", query)
+		var resp SubsonicResponseXML
+		if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("bad xml: %v", err)
+		}
+		if resp.TopSongs == nil {
+			t.Fatalf("unexpected response: %s", w.Body)
+		}
+		var ids []string
+		for _, s := range resp.TopSongs.Song {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+
+	// 精确匹配的 UP 主优先于第一个搜索结果，非音乐区的投稿被过滤
+	if ids := top(url.Values{"artist": {"up"}, "count": {"2"}}); !slices.Equal(ids, []string{"c", "b"}) {
+		t.Fatalf("top songs = %v", ids)
+	}
+	if ids := top(url.Values{"artist": {"ar-1"}}); !slices.Equal(ids, []string{"c", "b", "a"}) {
+		t.Fatalf("top songs by id = %v", ids)
+	}
+	if ids := top(url.Values{"artist": {"nobody"}}); len(ids) != 0 {
+		t.Fatalf("top songs of unknown artist = %v", ids)
+	}
+	if m, ok, _ := repo.SongMeta("c"); !ok || m.Title != "c" {
+		t.Fatalf("top song metadata not cached: %+v", m)
+	}
+}